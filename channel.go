@@ -0,0 +1,261 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// channelVersion is the version of the channel record format, sealed with AES-256-GCM.
+	channelVersion byte = 1
+
+	// version and 2-byte ciphertext length.
+	channelHeaderLength = 3
+
+	// maxChannelPlaintext is the maximum plaintext length of a single record. Larger writes are split.
+	maxChannelPlaintext = 1 << 14
+
+	channelKeyLength = 32
+)
+
+var (
+	// ErrChannelAuthentication indicates that a received channel record could not be authenticated, because it has been
+	// tampered with, replayed, reordered, or sent in another session. The channel can't be read from afterwards.
+	ErrChannelAuthentication = errors.New("channel record authentication failed")
+
+	// ErrChannelExhausted indicates that the channel has sent or received the maximum number of records, and a new
+	// session must be established.
+	ErrChannelExhausted = errors.New("channel sequence number exhausted")
+
+	// ErrChannelClosed indicates a write to a Channel after CloseWrite.
+	ErrChannelClosed = errors.New("channel is closed for writing")
+
+	errChannelRecordLength = errors.New("invalid channel record length")
+)
+
+// channelDirection holds the keys and sequence number of one direction of a Channel.
+type channelDirection struct {
+	aead     cipher.AEAD
+	iv       []byte
+	sequence uint64
+}
+
+func newChannelDirection(key, iv []byte) (*channelDirection, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &channelDirection{aead: aead, iv: iv}, nil
+}
+
+// nonce returns the nonce of the next record, i.e. the IV xor-ed with the sequence number, as in TLS 1.3.
+func (d *channelDirection) nonce() ([]byte, error) {
+	if d.sequence == math.MaxUint64 {
+		return nil, ErrChannelExhausted
+	}
+
+	nonce := make([]byte, len(d.iv))
+	copy(nonce, d.iv)
+
+	var sequence [8]byte
+	binary.BigEndian.PutUint64(sequence[:], d.sequence)
+
+	for i, b := range sequence {
+		nonce[len(nonce)-8+i] ^= b
+	}
+
+	d.sequence++
+
+	return nonce, nil
+}
+
+// Channel is an encrypted and authenticated record layer over an io.ReadWriter, keyed with the traffic keys of a
+// finished login session. Each party reads with the other party's keys, and records are bound to their order, so
+// that replayed, reordered, or dropped records are detected. The end of the stream is an empty record written by
+// CloseWrite, so that a stream truncated after any record is detected too. A Channel may be read from and written to
+// concurrently, but concurrent reads, or concurrent writes, must be synchronized by the caller.
+type Channel struct {
+	rw       io.ReadWriter
+	writer   *channelDirection
+	reader   *channelDirection
+	pending  []byte
+	readErr  error
+	writeErr error
+	closed   bool
+}
+
+// Channel returns a Channel over rw, keyed with the session's traffic keys in the direction of the party the exporter
+// was obtained by.
+func (e *SessionExporter) Channel(rw io.ReadWriter) (*Channel, error) {
+	directions := make([]*channelDirection, 2)
+
+	for i, secret := range [][]byte{e.clientTraffic, e.serverTraffic} {
+		d, err := newChannelDirection(
+			e.trafficKey(secret, labelKey, channelKeyLength),
+			e.trafficKey(secret, labelIV, 12),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		directions[i] = d
+	}
+
+	c := &Channel{rw: rw, writer: directions[0], reader: directions[1]}
+	if !e.isClient {
+		c.writer, c.reader = c.reader, c.writer
+	}
+
+	return c, nil
+}
+
+// Write encrypts p in one or more records, and writes them to the underlying writer. It fails with ErrChannelClosed
+// after CloseWrite. Once a record could not be written, the peer can't read the next ones, so all later writes fail
+// with the same error.
+func (c *Channel) Write(p []byte) (int, error) {
+	if c.writeErr != nil {
+		return 0, c.writeErr
+	}
+
+	if c.closed {
+		return 0, ErrChannelClosed
+	}
+
+	written := 0
+
+	for len(p) != 0 {
+		n := len(p)
+		if n > maxChannelPlaintext {
+			n = maxChannelPlaintext
+		}
+
+		if err := c.writeRecord(p[:n]); err != nil {
+			return written, err
+		}
+
+		written += n
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+// CloseWrite writes the end of the stream, after which the peer's reads return io.EOF, and this Channel can't be
+// written to. It doesn't close the underlying writer.
+func (c *Channel) CloseWrite() error {
+	if c.writeErr != nil {
+		return c.writeErr
+	}
+
+	if c.closed {
+		return ErrChannelClosed
+	}
+
+	c.closed = true
+
+	// Writes never produce empty records, which only mark the end of the stream.
+	return c.writeRecord(nil)
+}
+
+// writeRecord seals and writes a record. Its sequence number is consumed even if the write fails, so the error is kept
+// for all later writes.
+func (c *Channel) writeRecord(plaintext []byte) error {
+	nonce, err := c.writer.nonce()
+	if err != nil {
+		c.writeErr = err
+		return err
+	}
+
+	header := make([]byte, channelHeaderLength)
+	header[0] = channelVersion
+	binary.BigEndian.PutUint16(header[1:], uint16(len(plaintext)+c.writer.aead.Overhead()))
+
+	if _, err := c.rw.Write(c.writer.aead.Seal(header, nonce, plaintext, header)); err != nil {
+		c.writeErr = fmt.Errorf("writing channel record: %w", err)
+		return c.writeErr
+	}
+
+	return nil
+}
+
+// Read reads and decrypts records from the underlying reader into p. It returns io.EOF once the peer's CloseWrite
+// record is read, and io.ErrUnexpectedEOF if the underlying reader ends before it, which may be a truncation.
+func (c *Channel) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	for len(c.pending) == 0 {
+		if c.readErr != nil {
+			return 0, c.readErr
+		}
+
+		c.pending, c.readErr = c.readRecord()
+	}
+
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+
+	return n, nil
+}
+
+func (c *Channel) readRecord() ([]byte, error) {
+	header := make([]byte, channelHeaderLength)
+	if _, err := io.ReadFull(c.rw, header); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		return nil, err
+	}
+
+	length := int(binary.BigEndian.Uint16(header[1:]))
+	if header[0] != channelVersion || length < c.reader.aead.Overhead() ||
+		length > maxChannelPlaintext+c.reader.aead.Overhead() {
+		return nil, errChannelRecordLength
+	}
+
+	ciphertext := make([]byte, length)
+	if _, err := io.ReadFull(c.rw, ciphertext); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		return nil, err
+	}
+
+	nonce, err := c.reader.nonce()
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := c.reader.aead.Open(nil, nonce, ciphertext, header)
+	if err != nil {
+		return nil, ErrChannelAuthentication
+	}
+
+	if len(plaintext) == 0 {
+		return nil, io.EOF
+	}
+
+	return plaintext, nil
+}
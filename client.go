@@ -24,19 +24,55 @@ import (
 )
 
 var (
+	// ErrStateFinalized indicates that a client registration or login state has already been successfully finalized,
+	// or that a login state has already been given to LoginFinish, and can't be used again.
+	ErrStateFinalized = errors.New("client state has already been finalized")
+
 	// errInvalidMaskedLength happens when unmasking a masked response.
 	errInvalidMaskedLength = errors.New("invalid masked response length")
 
 	// errKe1Missing happens when LoginFinish is called and the client has no Ke1 in state.
 	errKe1Missing = errors.New("missing KE1 in client state")
+
+	// errRegistrationStateMissing happens when RegistrationFinalize is called without a registration state.
+	errRegistrationStateMissing = errors.New("missing client registration state")
 )
 
-// Client represents an OPAQUE Client, exposing its functions and holding its state.
+// Client represents an OPAQUE Client, exposing its functions. It holds no session state: each registration and login
+// returns its own state, so that a single instance can run several of them.
 type Client struct {
 	Deserialize *Deserializer
-	OPRF        *oprf.Client
-	Ake         *ake.Client
 	conf        *internal.Configuration
+	akeMode     ake.Identifier
+}
+
+// ClientRegistrationState holds the client's state of a single registration, between RegistrationInit and
+// RegistrationFinalize. It can only be finalized once.
+type ClientRegistrationState struct {
+	OPRF      *oprf.Client
+	finalized bool
+}
+
+// ClientLoginState holds the client's state of a single login, between LoginInit and LoginFinish. It can only be
+// finalized once.
+type ClientLoginState struct {
+	OPRF      *oprf.Client
+	Ake       *ake.Client
+	exportKey []byte
+	finalized bool
+
+	// used is set by LoginFinish whatever its outcome, so that the ephemeral secret key and nonce are never reused.
+	used bool
+}
+
+// SessionKey returns the session key if the previous call to LoginFinish() with this state was successful.
+func (s *ClientLoginState) SessionKey() []byte {
+	return s.Ake.SessionKey()
+}
+
+// ExportKey returns the export key if the previous call to LoginFinish() with this state was successful.
+func (s *ClientLoginState) ExportKey() []byte {
+	return s.exportKey
 }
 
 // NewClient returns a new Client instantiation given the application Configuration.
@@ -51,10 +87,9 @@ func NewClient(c *Configuration) (*Client, error) {
 	}
 
 	return &Client{
-		OPRF:        conf.OPRF.Client(),
-		Ake:         ake.NewClient(),
-		Deserialize: &Deserializer{conf: conf},
+		Deserialize: &Deserializer{conf: conf, encodedConf: c.Serialize()},
 		conf:        conf,
+		akeMode:     c.akeMode(),
 	}, nil
 }
 
@@ -63,46 +98,71 @@ func (c *Client) GetConf() *internal.Configuration {
 	return c.conf
 }
 
-// buildPRK derives the randomized password from the OPRF output.
-func (c *Client) buildPRK(evaluation *group.Point) []byte {
-	output := c.OPRF.Finalize(evaluation)
-	stretched := c.conf.KSF.Harden(output, nil, c.conf.OPRFPointLength)
+// buildPRK derives the randomized password from the OPRF output, stretched with the KSF and its salt.
+func (c *Client) buildPRK(client *oprf.Client, evaluation *group.Point) []byte {
+	output := client.Finalize(evaluation)
+	stretched := c.conf.KSF.Harden(output, c.conf.KSFSalt, c.conf.OPRFPointLength)
 
 	return c.conf.KDF.Extract(nil, encoding.Concat(output, stretched))
 }
 
-// RegistrationInit returns a RegistrationRequest message blinding the given password.
-func (c *Client) RegistrationInit(password []byte) *message.RegistrationRequest {
-	m := c.OPRF.Blind(password)
+// RegistrationInit returns a RegistrationRequest message blinding the given password, and the registration state to
+// be given to RegistrationFinalize.
+func (c *Client) RegistrationInit(password []byte) (*message.RegistrationRequest, *ClientRegistrationState) {
+	return c.RegistrationInitWithBlind(password, nil)
+}
+
+// RegistrationInitWithBlind returns a RegistrationRequest message blinding the given password with the given blind,
+// and the registration state. A nil blind is replaced by a random one.
+// This function is primarily used for testing purposes and will most probably be removed at some point.
+func (c *Client) RegistrationInitWithBlind(
+	password []byte,
+	blind *group.Scalar,
+) (*message.RegistrationRequest, *ClientRegistrationState) {
+	state := &ClientRegistrationState{OPRF: c.conf.OPRF.Client()}
+	state.OPRF.SetBlind(blind)
+	m := state.OPRF.Blind(password)
 
 	return &message.RegistrationRequest{
 		C:              c.conf.OPRF,
 		BlindedMessage: m,
-	}
+	}, state
 }
 
 // RegistrationFinalizeWithNonce returns a RegistrationRecord message given the identities, server's
-// RegistrationResponse, and the envelope nonce to be used.
+// RegistrationResponse, the envelope nonce to be used, and the registration state.
 // This function is primarily used for testing purposes and will most probably be removed at some point.
 func (c *Client) RegistrationFinalizeWithNonce(
 	resp *message.RegistrationResponse,
 	clientIdentity, serverIdentity, envelopeNonce []byte,
-) (upload *message.RegistrationRecord, exportKey []byte) {
-	return c.registrationFinalize(clientIdentity, serverIdentity, envelopeNonce, resp)
+	state *ClientRegistrationState,
+) (upload *message.RegistrationRecord, exportKey []byte, err error) {
+	return c.registrationFinalize(clientIdentity, serverIdentity, envelopeNonce, resp, state)
 }
 
-// RegistrationFinalize returns a RegistrationRecord message given the identities and the server's RegistrationResponse.
+// RegistrationFinalize returns a RegistrationRecord message given the identities, the server's RegistrationResponse,
+// and the registration state returned by RegistrationInit.
 func (c *Client) RegistrationFinalize(
 	resp *message.RegistrationResponse,
 	clientIdentity, serverIdentity []byte,
-) (record *message.RegistrationRecord, exportKey []byte) {
-	return c.registrationFinalize(clientIdentity, serverIdentity, nil, resp)
+	state *ClientRegistrationState,
+) (record *message.RegistrationRecord, exportKey []byte, err error) {
+	return c.registrationFinalize(clientIdentity, serverIdentity, nil, resp, state)
 }
 
 func (c *Client) registrationFinalize(
 	clientIdentity, serverIdentity, envelopeNonce []byte,
 	resp *message.RegistrationResponse,
-) (upload *message.RegistrationRecord, exportKey []byte) {
+	state *ClientRegistrationState,
+) (upload *message.RegistrationRecord, exportKey []byte, err error) {
+	if state == nil || state.OPRF == nil {
+		return nil, nil, errRegistrationStateMissing
+	}
+
+	if state.finalized {
+		return nil, nil, ErrStateFinalized
+	}
+
 	creds2 := &keyrecovery.Credentials{
 		ClientIdentity: clientIdentity,
 		ServerIdentity: serverIdentity,
@@ -114,7 +174,7 @@ func (c *Client) registrationFinalize(
 	//	return nil, nil, fmt.Errorf("%s : %w", errInvalidPKS, err)
 	// }
 
-	randomizedPwd := c.buildPRK(resp.EvaluatedMessage)
+	randomizedPwd := c.buildPRK(state.OPRF, resp.EvaluatedMessage)
 	maskingKey := c.conf.KDF.Expand(randomizedPwd, []byte(tag.MaskingKey), c.conf.KDF.Size())
 	envelope, clientPublicKey, exportKey := keyrecovery.Store(
 		c.conf,
@@ -123,46 +183,75 @@ func (c *Client) registrationFinalize(
 		creds2,
 	)
 
+	state.finalized = true
+
 	return &message.RegistrationRecord{
 		G:          c.conf.Group,
 		PublicKey:  clientPublicKey,
 		MaskingKey: maskingKey,
 		Envelope:   envelope.Serialize(),
-	}, exportKey
+	}, exportKey, nil
 }
 
-// LoginInit initiates the authentication process, returning a KE1 message blinding the given password.
-// clientInfo is optional client information sent in clear, and only authenticated in KE3.
-func (c *Client) LoginInit(password []byte) *message.KE1 {
-	m := c.OPRF.Blind(password)
+// LoginInit initiates the authentication process, returning a KE1 message blinding the given password, and the login
+// state to be given to LoginFinish.
+func (c *Client) LoginInit(password []byte) (*message.KE1, *ClientLoginState) {
+	return c.LoginInitWithValues(password, nil, nil, nil)
+}
+
+// LoginInitWithValues initiates the authentication process with the given OPRF blind, and AKE ephemeral secret key
+// and nonce. Nil values are replaced by random ones.
+// This function is primarily used for testing purposes and will most probably be removed at some point.
+func (c *Client) LoginInitWithValues(
+	password []byte,
+	blind, esk *group.Scalar,
+	nonce []byte,
+) (*message.KE1, *ClientLoginState) {
+	state := &ClientLoginState{
+		OPRF: c.conf.OPRF.Client(),
+		Ake:  ake.NewClient(c.akeMode),
+	}
+	state.OPRF.SetBlind(blind)
+	state.Ake.SetValues(c.conf.Group, esk, nonce, c.conf.NonceLen)
+
+	m := state.OPRF.Blind(password)
 	credReq := &message.CredentialRequest{
 		C:              c.conf.OPRF,
 		BlindedMessage: m,
 	}
-	ke1 := c.Ake.Start(c.conf.Group)
+	ke1 := state.Ake.Start(c.conf.Group)
 	ke1.CredentialRequest = credReq
-	c.Ake.Ke1 = ke1.Serialize()
+	state.Ake.Ke1 = ke1.Serialize()
 
-	return ke1
+	return ke1, state
 }
 
-// LoginFinish returns a KE3 message given the server's KE2 response message and the identities. If the idc
-// or ids parameters are nil, the client and server's public keys are taken as identities for both.
+// LoginFinish returns a KE3 message given the server's KE2 response message, the identities, and the login state
+// returned by LoginInit. If the idc or ids parameters are nil, the client and server's public keys are taken as
+// identities for both. The state can only be given once: it can't be used again, even if the login fails, and a new
+// login must start with LoginInit.
 func (c *Client) LoginFinish(
 	clientIdentity, serverIdentity []byte,
 	ke2 *message.KE2,
+	state *ClientLoginState,
 ) (ke3 *message.KE3, exportKey []byte, err error) {
-	if len(c.Ake.Ke1) == 0 {
+	if state == nil || state.Ake == nil || len(state.Ake.Ke1) == 0 {
 		return nil, nil, errKe1Missing
 	}
 
+	if state.finalized || state.used {
+		return nil, nil, ErrStateFinalized
+	}
+
+	state.used = true
+
 	// This test is very important as it avoids buffer overflows in subsequent parsing.
 	if len(ke2.MaskedResponse) != c.conf.AkePointLength+c.conf.EnvelopeSize {
 		return nil, nil, errInvalidMaskedLength
 	}
 
 	// Finalize the OPRF.
-	randomizedPwd := c.buildPRK(ke2.EvaluatedMessage)
+	randomizedPwd := c.buildPRK(state.OPRF, ke2.EvaluatedMessage)
 
 	// Decrypt the masked response.
 	serverPublicKey, serverPublicKeyBytes,
@@ -193,15 +282,13 @@ func (c *Client) LoginFinish(
 		serverIdentity = serverPublicKeyBytes
 	}
 
-	ke3, err = c.Ake.Finalize(c.conf, clientIdentity, clientSecretKey, serverIdentity, serverPublicKey, ke2)
+	ke3, err = state.Ake.Finalize(c.conf, clientIdentity, clientSecretKey, serverIdentity, serverPublicKey, ke2)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	return ke3, exportKey, nil
-}
+	state.exportKey = exportKey
+	state.finalized = true
 
-// SessionKey returns the session key if the previous call to LoginFinish() was successful.
-func (c *Client) SessionKey() []byte {
-	return c.Ake.SessionKey()
+	return ke3, exportKey, nil
 }
@@ -0,0 +1,270 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/bytemare/opaque/internal/ake"
+	"github.com/bytemare/opaque/internal/encoding"
+	"github.com/bytemare/opaque/internal/oprf"
+	"github.com/bytemare/opaque/internal/tag"
+)
+
+// clientStateVersion is the version of the client state encoding.
+const clientStateVersion byte = 1
+
+const (
+	clientStateRegistration byte = 1
+	clientStateLogin        byte = 2
+
+	clientStateUnauthenticated byte = 0
+	clientStateAuthenticated   byte = 1
+
+	// version, kind, configuration identifier, and authentication flag.
+	clientStateHeaderLength = 2 + ConfigurationIDLength + 1
+)
+
+var (
+	// ErrClientStateAuthentication indicates that an authenticated client state could not be verified, either because
+	// it has been tampered with, or because the wrong key or none was given.
+	ErrClientStateAuthentication = errors.New("client state authentication failed")
+
+	// ErrClientStateVersion indicates that the encoded client state has an unsupported version.
+	ErrClientStateVersion = errors.New("unsupported client state version")
+
+	errClientStateInvalid  = errors.New("invalid client state encoding")
+	errClientStateKind     = errors.New("unexpected client state kind")
+	errClientStateConf     = errors.New("client state was exported in a different configuration")
+	errClientStateNotBlind = errors.New("client state has no blinded input")
+)
+
+// SerializeRegistrationState returns an encoding of the registration state, enabling a client to persist it between
+// RegistrationInit and RegistrationFinalize, e.g. in another process. If key is not empty, the encoding is
+// authenticated with it. The encoding contains the password: it must be stored with the same care.
+func (c *Client) SerializeRegistrationState(state *ClientRegistrationState, key []byte) ([]byte, error) {
+	if state == nil || state.OPRF == nil {
+		return nil, errRegistrationStateMissing
+	}
+
+	if state.finalized {
+		return nil, ErrStateFinalized
+	}
+
+	input, blind := state.OPRF.State()
+	if blind == nil {
+		return nil, errClientStateNotBlind
+	}
+
+	body := encoding.Concat(encoding.EncodeVector(input), encoding.EncodeVector(blind.Bytes()))
+
+	return c.sealClientState(clientStateRegistration, body, key), nil
+}
+
+// DeserializeRegistrationState decodes a state encoded by SerializeRegistrationState, verifying it with key if it was
+// authenticated. The returned state can be given to RegistrationFinalize.
+func (c *Client) DeserializeRegistrationState(encoded, key []byte) (*ClientRegistrationState, error) {
+	body, err := c.openClientState(clientStateRegistration, encoded, key)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := decodeClientStateVectors(body, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := c.restoreOPRF(v[0], v[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClientRegistrationState{OPRF: client}, nil
+}
+
+// SerializeLoginState returns an encoding of the login state, enabling a client to persist it between LoginInit and
+// LoginFinish, e.g. when the application may be killed while waiting for KE2. If key is not empty, the encoding is
+// authenticated with it. The encoding contains the password and ephemeral secret key: it must be stored with the same
+// care.
+func (c *Client) SerializeLoginState(state *ClientLoginState, key []byte) ([]byte, error) {
+	if state == nil || state.Ake == nil || len(state.Ake.Ke1) == 0 {
+		return nil, errKe1Missing
+	}
+
+	if state.finalized || state.used {
+		return nil, ErrStateFinalized
+	}
+
+	input, blind := state.OPRF.State()
+	if blind == nil {
+		return nil, errClientStateNotBlind
+	}
+
+	esk, nonce := state.Ake.Values()
+	body := encoding.Concatenate(
+		encoding.EncodeVector(input),
+		encoding.EncodeVector(blind.Bytes()),
+		encoding.EncodeVector(esk.Bytes()),
+		encoding.EncodeVector(nonce),
+		encoding.EncodeVector(state.Ake.Ke1),
+	)
+
+	return c.sealClientState(clientStateLogin, body, key), nil
+}
+
+// DeserializeLoginState decodes a state encoded by SerializeLoginState, verifying it with key if it was
+// authenticated. The returned state can be given to LoginFinish.
+func (c *Client) DeserializeLoginState(encoded, key []byte) (*ClientLoginState, error) {
+	body, err := c.openClientState(clientStateLogin, encoded, key)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := decodeClientStateVectors(body, 5)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := c.restoreOPRF(v[0], v[1])
+	if err != nil {
+		return nil, err
+	}
+
+	esk, err := c.conf.Group.NewScalar().Decode(v[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errClientStateInvalid, err)
+	}
+
+	if len(v[3]) != c.conf.NonceLen {
+		return nil, errClientStateInvalid
+	}
+
+	ke1, err := c.Deserialize.KE1(v[4])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errClientStateInvalid, err)
+	}
+
+	// The ephemeral secret key must correspond to the one used in KE1.
+	a := ake.NewClient(c.akeMode)
+
+	epk := a.SetValues(c.conf.Group, esk, v[3], c.conf.NonceLen)
+	if !bytes.Equal(epk.Bytes(), ke1.EpkU.Bytes()) {
+		return nil, errClientStateInvalid
+	}
+
+	a.Ke1 = v[4]
+
+	return &ClientLoginState{
+		OPRF: client,
+		Ake:  a,
+	}, nil
+}
+
+func (c *Client) restoreOPRF(input, encodedBlind []byte) (*oprf.Client, error) {
+	blind, err := c.conf.OPRF.Group().NewScalar().Decode(encodedBlind)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errClientStateInvalid, err)
+	}
+
+	client := c.conf.OPRF.Client()
+	client.SetBlind(blind)
+	client.SetInput(input)
+
+	return client, nil
+}
+
+// clientStateMac returns the MAC of the encoded state with the key, which also covers the full configuration, as the
+// header only holds its identifier.
+func (c *Client) clientStateMac(key, encoded []byte) []byte {
+	macKey := c.conf.KDF.Expand(key, []byte(tag.ClientState), c.conf.KDF.Size())
+	return c.conf.MAC.MAC(macKey, encoding.Concat(encoded, encoding.EncodeVector(c.Deserialize.encodedConf)))
+}
+
+func (c *Client) sealClientState(kind byte, body, key []byte) []byte {
+	flag := clientStateUnauthenticated
+	if len(key) != 0 {
+		flag = clientStateAuthenticated
+	}
+
+	encoded := encoding.Concatenate(
+		[]byte{clientStateVersion, kind},
+		configurationID(c.Deserialize.encodedConf),
+		[]byte{flag},
+		body,
+	)
+
+	if flag == clientStateAuthenticated {
+		encoded = append(encoded, c.clientStateMac(key, encoded)...)
+	}
+
+	return encoded
+}
+
+func (c *Client) openClientState(kind byte, encoded, key []byte) ([]byte, error) {
+	if len(encoded) < clientStateHeaderLength {
+		return nil, errClientStateInvalid
+	}
+
+	if encoded[0] != clientStateVersion {
+		return nil, ErrClientStateVersion
+	}
+
+	if encoded[1] != kind {
+		return nil, errClientStateKind
+	}
+
+	if !bytes.Equal(encoded[2:2+ConfigurationIDLength], configurationID(c.Deserialize.encodedConf)) {
+		return nil, errClientStateConf
+	}
+
+	switch encoded[clientStateHeaderLength-1] {
+	case clientStateUnauthenticated:
+		// Refuse to silently downgrade when the caller expects an authenticated state.
+		if len(key) != 0 {
+			return nil, ErrClientStateAuthentication
+		}
+
+		return encoded[clientStateHeaderLength:], nil
+	case clientStateAuthenticated:
+		if len(key) == 0 || len(encoded) < clientStateHeaderLength+c.conf.MAC.Size() {
+			return nil, ErrClientStateAuthentication
+		}
+
+		offset := len(encoded) - c.conf.MAC.Size()
+		if !c.conf.MAC.Equal(c.clientStateMac(key, encoded[:offset]), encoded[offset:]) {
+			return nil, ErrClientStateAuthentication
+		}
+
+		return encoded[clientStateHeaderLength:offset], nil
+	default:
+		return nil, errClientStateInvalid
+	}
+}
+
+func decodeClientStateVectors(in []byte, n int) ([][]byte, error) {
+	vectors := make([][]byte, n)
+
+	for i := range vectors {
+		v, offset, err := encoding.DecodeVector(in)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errClientStateInvalid, err)
+		}
+
+		vectors[i] = v
+		in = in[offset:]
+	}
+
+	if len(in) != 0 {
+		return nil, errClientStateInvalid
+	}
+
+	return vectors, nil
+}
@@ -10,10 +10,13 @@ package opaque
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/bytemare/crypto/group"
 
 	"github.com/bytemare/opaque/internal"
+	"github.com/bytemare/opaque/internal/ake"
+	"github.com/bytemare/opaque/internal/encoding"
 	"github.com/bytemare/opaque/message"
 )
 
@@ -25,11 +28,14 @@ var (
 	errInvalidServerEPK     = errors.New("invalid ephemeral server public key")
 	errInvalidServerPK      = errors.New("invalid server public key")
 	errInvalidClientPK      = errors.New("invalid client public key")
+	errInvalidAkePoint      = errors.New("point is the identity or not in the prime-order subgroup")
+	errInvalidJSON          = errors.New("invalid JSON message encoding")
 )
 
 // Deserializer exposes the message deserialization functions.
 type Deserializer struct {
-	conf *internal.Configuration
+	conf        *internal.Configuration
+	encodedConf []byte
 }
 
 // RegistrationRequest takes a serialized RegistrationRequest message and returns a deserialized
@@ -65,7 +71,7 @@ func (d *Deserializer) RegistrationResponse(registrationResponse []byte) (*messa
 		return nil, errInvalidEvaluatedData
 	}
 
-	pks, err := d.conf.Group.NewElement().Decode(registrationResponse[d.conf.OPRFPointLength:])
+	pks, err := d.decodeAkePoint(registrationResponse[d.conf.OPRFPointLength:])
 	if err != nil {
 		return nil, errInvalidServerPK
 	}
@@ -78,6 +84,24 @@ func (d *Deserializer) RegistrationResponse(registrationResponse []byte) (*messa
 	}, nil
 }
 
+// PasswordChangeResponse takes a serialized PasswordChangeResponse message and returns a deserialized
+// PasswordChangeResponse structure.
+func (d *Deserializer) PasswordChangeResponse(response []byte) (*message.PasswordChangeResponse, error) {
+	if len(response) != d.registrationResponseLength()+d.conf.MAC.Size() {
+		return nil, errInvalidMessageLength
+	}
+
+	r, err := d.RegistrationResponse(response[:d.registrationResponseLength()])
+	if err != nil {
+		return nil, err
+	}
+
+	return &message.PasswordChangeResponse{
+		RegistrationResponse: r,
+		Mac:                  response[d.registrationResponseLength():],
+	}, nil
+}
+
 func (d *Deserializer) recordLength() int {
 	return d.conf.AkePointLength + d.conf.Hash.Size() + d.conf.EnvelopeSize
 }
@@ -93,7 +117,7 @@ func (d *Deserializer) RegistrationRecord(record []byte) (*message.RegistrationR
 	maskingKey := record[d.conf.AkePointLength : d.conf.AkePointLength+d.conf.Hash.Size()]
 	env := record[d.conf.AkePointLength+d.conf.Hash.Size():]
 
-	pku, err := d.conf.Group.NewElement().Decode(pk)
+	pku, err := d.decodeAkePoint(pk)
 	if err != nil {
 		return nil, errInvalidClientPK
 	}
@@ -106,11 +130,29 @@ func (d *Deserializer) RegistrationRecord(record []byte) (*message.RegistrationR
 	}, nil
 }
 
+// PasswordChangeRecord takes a serialized PasswordChangeRecord message and returns a deserialized
+// PasswordChangeRecord structure.
+func (d *Deserializer) PasswordChangeRecord(record []byte) (*message.PasswordChangeRecord, error) {
+	if len(record) != d.recordLength()+d.conf.MAC.Size() {
+		return nil, errInvalidMessageLength
+	}
+
+	r, err := d.RegistrationRecord(record[:d.recordLength()])
+	if err != nil {
+		return nil, err
+	}
+
+	return &message.PasswordChangeRecord{
+		RegistrationRecord: r,
+		Mac:                record[d.recordLength():],
+	}, nil
+}
+
 func (d *Deserializer) deserializeCredentialResponse(
 	input []byte,
 	maxResponseLength int,
 ) (*message.CredentialResponse, error) {
-	data, err := d.conf.Group.NewElement().Decode(input[:d.conf.OPRFPointLength])
+	data, err := d.conf.OPRF.Group().NewElement().Decode(input[:d.conf.OPRFPointLength])
 	if err != nil {
 		return nil, errInvalidEvaluatedData
 	}
@@ -133,14 +175,14 @@ func (d *Deserializer) KE1(ke1 []byte) (*message.KE1, error) {
 		return nil, errInvalidMessageLength
 	}
 
-	blindedMessage, err := d.conf.Group.NewElement().Decode(ke1[:d.conf.OPRFPointLength])
+	blindedMessage, err := d.conf.OPRF.Group().NewElement().Decode(ke1[:d.conf.OPRFPointLength])
 	if err != nil {
 		return nil, errInvalidBlindedData
 	}
 
 	nonceU := ke1[d.conf.OPRFPointLength : d.conf.OPRFPointLength+d.conf.NonceLen]
 
-	epku, err := d.conf.Group.NewElement().Decode(ke1[d.conf.OPRFPointLength+d.conf.NonceLen:])
+	epku, err := d.decodeAkePoint(ke1[d.conf.OPRFPointLength+d.conf.NonceLen:])
 	if err != nil {
 		return nil, errInvalidClientEPK
 	}
@@ -157,7 +199,7 @@ func (d *Deserializer) KE1(ke1 []byte) (*message.KE1, error) {
 }
 
 func (d *Deserializer) ke2LengthWithoutCreds() int {
-	return d.conf.NonceLen + d.conf.AkePointLength + d.conf.MAC.Size()
+	return d.conf.NonceLen + d.conf.AkePointLength + d.conf.SignatureLength + d.conf.MAC.Size()
 }
 
 func (d *Deserializer) credentialResponseLength() int {
@@ -183,9 +225,11 @@ func (d *Deserializer) KE2(ke2 []byte) (*message.KE2, error) {
 	offset := maxResponseLength + d.conf.NonceLen
 	epk := ke2[offset : offset+d.conf.AkePointLength]
 	offset += d.conf.AkePointLength
+	signature := ke2[offset : offset+d.conf.SignatureLength]
+	offset += d.conf.SignatureLength
 	mac := ke2[offset:]
 
-	epks, err := d.conf.Group.NewElement().Decode(epk)
+	epks, err := d.decodeAkePoint(epk)
 	if err != nil {
 		return nil, errInvalidServerEPK
 	}
@@ -195,17 +239,30 @@ func (d *Deserializer) KE2(ke2 []byte) (*message.KE2, error) {
 		CredentialResponse: cresp,
 		NonceS:             nonceS,
 		EpkS:               epks,
+		Signature:          nilIfEmpty(signature),
 		Mac:                mac,
 	}, nil
 }
 
 // KE3 takes a serialized KE3 message and returns a deserialized KE3 structure.
 func (d *Deserializer) KE3(ke3 []byte) (*message.KE3, error) {
-	if len(ke3) != d.conf.MAC.Size() {
+	if len(ke3) != d.conf.SignatureLength+d.conf.MAC.Size() {
 		return nil, errInvalidMessageLength
 	}
 
-	return &message.KE3{Mac: ke3}, nil
+	return &message.KE3{
+		Signature: nilIfEmpty(ke3[:d.conf.SignatureLength]),
+		Mac:       ke3[d.conf.SignatureLength:],
+	}, nil
+}
+
+// nilIfEmpty returns nil for empty input, so that messages without signatures hold none.
+func nilIfEmpty(in []byte) []byte {
+	if len(in) == 0 {
+		return nil
+	}
+
+	return in
 }
 
 // DecodeAkePrivateKey takes a serialized private key (a scalar) and attempts to return it's decoded form.
@@ -215,5 +272,198 @@ func (d *Deserializer) DecodeAkePrivateKey(encoded []byte) (*group.Scalar, error
 
 // DecodeAkePublicKey takes a serialized public key (a point) and attempts to return it's decoded form.
 func (d *Deserializer) DecodeAkePublicKey(encoded []byte) (*group.Point, error) {
-	return d.conf.Group.NewElement().Decode(encoded)
+	return d.decodeAkePoint(encoded)
+}
+
+// decodeAkePoint decodes a public key in the AKE group, rejecting the identity, and points of low or mixed order in
+// Curve25519.
+func (d *Deserializer) decodeAkePoint(encoded []byte) (*group.Point, error) {
+	p, err := d.conf.Group.NewElement().Decode(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ake.ValidPublicKey(d.conf.Group, p) {
+		return nil, errInvalidAkePoint
+	}
+
+	return p, nil
+}
+
+// jsonField is a field of the JSON encoding of a message, with its length in the configuration.
+type jsonField struct {
+	name   string
+	length int
+}
+
+// decodeJSON returns the binary encoding of the message from the fields of its JSON encoding, which must all have the
+// length of the configuration, so that the binary deserialization validates them exactly as it does binary messages.
+func (d *Deserializer) decodeJSON(encoded []byte, fields ...jsonField) ([]byte, error) {
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.name
+	}
+
+	values, err := encoding.UnmarshalJSON(encoded, names...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidJSON, err)
+	}
+
+	for i, f := range fields {
+		if len(values[i]) != f.length {
+			return nil, errInvalidMessageLength
+		}
+	}
+
+	return encoding.Concatenate(values...), nil
+}
+
+func (d *Deserializer) credentialRequestFields() []jsonField {
+	return []jsonField{{"blinded_message", d.conf.OPRFPointLength}}
+}
+
+func (d *Deserializer) credentialResponseFields() []jsonField {
+	return []jsonField{
+		{"evaluated_message", d.conf.OPRFPointLength},
+		{"masking_nonce", d.conf.NonceLen},
+		{"masked_response", d.conf.AkePointLength + d.conf.EnvelopeSize},
+	}
+}
+
+func (d *Deserializer) recordFields() []jsonField {
+	return []jsonField{
+		{"client_public_key", d.conf.AkePointLength},
+		{"masking_key", d.conf.Hash.Size()},
+		{"envelope", d.conf.EnvelopeSize},
+	}
+}
+
+// RegistrationRequestJSON takes a RegistrationRequest encoded with its MarshalJSON method and returns the decoded
+// RegistrationRequest.
+func (d *Deserializer) RegistrationRequestJSON(encoded []byte) (*message.RegistrationRequest, error) {
+	m, err := d.decodeJSON(encoded, d.credentialRequestFields()...)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.RegistrationRequest(m)
+}
+
+// RegistrationResponseJSON takes a RegistrationResponse encoded with its MarshalJSON method and returns the decoded
+// RegistrationResponse.
+func (d *Deserializer) RegistrationResponseJSON(encoded []byte) (*message.RegistrationResponse, error) {
+	m, err := d.decodeJSON(
+		encoded,
+		jsonField{"evaluated_message", d.conf.OPRFPointLength},
+		jsonField{"server_public_key", d.conf.AkePointLength},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.RegistrationResponse(m)
+}
+
+// PasswordChangeResponseJSON takes a PasswordChangeResponse encoded with its MarshalJSON method and returns the
+// decoded PasswordChangeResponse.
+func (d *Deserializer) PasswordChangeResponseJSON(encoded []byte) (*message.PasswordChangeResponse, error) {
+	m, err := d.decodeJSON(
+		encoded,
+		jsonField{"evaluated_message", d.conf.OPRFPointLength},
+		jsonField{"server_public_key", d.conf.AkePointLength},
+		jsonField{"mac", d.conf.MAC.Size()},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.PasswordChangeResponse(m)
+}
+
+// RegistrationRecordJSON takes a RegistrationRecord encoded with its MarshalJSON method and returns the decoded
+// RegistrationRecord.
+func (d *Deserializer) RegistrationRecordJSON(encoded []byte) (*message.RegistrationRecord, error) {
+	m, err := d.decodeJSON(encoded, d.recordFields()...)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.RegistrationRecord(m)
+}
+
+// PasswordChangeRecordJSON takes a PasswordChangeRecord encoded with its MarshalJSON method and returns the decoded
+// PasswordChangeRecord.
+func (d *Deserializer) PasswordChangeRecordJSON(encoded []byte) (*message.PasswordChangeRecord, error) {
+	m, err := d.decodeJSON(encoded, append(d.recordFields(), jsonField{"mac", d.conf.MAC.Size()})...)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.PasswordChangeRecord(m)
+}
+
+// CredentialRequestJSON takes a CredentialRequest encoded with its MarshalJSON method and returns the decoded
+// CredentialRequest.
+func (d *Deserializer) CredentialRequestJSON(encoded []byte) (*message.CredentialRequest, error) {
+	r, err := d.RegistrationRequestJSON(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return &message.CredentialRequest{C: r.C, BlindedMessage: r.BlindedMessage}, nil
+}
+
+// CredentialResponseJSON takes a CredentialResponse encoded with its MarshalJSON method and returns the decoded
+// CredentialResponse.
+func (d *Deserializer) CredentialResponseJSON(encoded []byte) (*message.CredentialResponse, error) {
+	m, err := d.decodeJSON(encoded, d.credentialResponseFields()...)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.deserializeCredentialResponse(m, d.credentialResponseLength())
+}
+
+// KE1JSON takes a KE1 encoded with its MarshalJSON method and returns the decoded KE1.
+func (d *Deserializer) KE1JSON(encoded []byte) (*message.KE1, error) {
+	m, err := d.decodeJSON(encoded, append(
+		d.credentialRequestFields(),
+		jsonField{"client_nonce", d.conf.NonceLen},
+		jsonField{"client_ephemeral_pk", d.conf.AkePointLength},
+	)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.KE1(m)
+}
+
+// KE2JSON takes a KE2 encoded with its MarshalJSON method and returns the decoded KE2.
+func (d *Deserializer) KE2JSON(encoded []byte) (*message.KE2, error) {
+	m, err := d.decodeJSON(encoded, append(
+		d.credentialResponseFields(),
+		jsonField{"server_nonce", d.conf.NonceLen},
+		jsonField{"server_ephemeral_pk", d.conf.AkePointLength},
+		jsonField{"server_signature", d.conf.SignatureLength},
+		jsonField{"server_mac", d.conf.MAC.Size()},
+	)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.KE2(m)
+}
+
+// KE3JSON takes a KE3 encoded with its MarshalJSON method and returns the decoded KE3.
+func (d *Deserializer) KE3JSON(encoded []byte) (*message.KE3, error) {
+	m, err := d.decodeJSON(
+		encoded,
+		jsonField{"client_signature", d.conf.SignatureLength},
+		jsonField{"client_mac", d.conf.MAC.Size()},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.KE3(m)
 }
@@ -22,8 +22,8 @@ import (
 )
 
 var (
-	exampleClientRecord                               *opaque.ClientRecord
-	secretOprfSeed, serverPrivateKey, serverPublicKey []byte
+	exampleClientRecord *opaque.ClientRecord
+	serverKeyMaterial   *opaque.ServerKeyMaterial
 )
 
 func isSameConf(a, b *opaque.Configuration) bool {
@@ -32,7 +32,8 @@ func isSameConf(a, b *opaque.Configuration) bool {
 		a.MAC != b.MAC ||
 		a.Hash != b.Hash ||
 		a.KSF != b.KSF ||
-		a.AKE != b.AKE {
+		a.AKE != b.AKE ||
+		a.Mode != b.Mode {
 		return false
 	}
 
@@ -54,6 +55,7 @@ func Example_configuration() {
 		Hash:    crypto.SHA512,
 		KSF:     ksf.Scrypt,
 		AKE:     opaque.RistrettoSha512,
+		Mode:    opaque.TripleDH,
 		Context: nil,
 	}
 
@@ -92,13 +94,24 @@ func Example_serverSetup() {
 	// This a straightforward way to use a secure and efficient configuration.
 	// They have to be run only once in the application's lifecycle, and the output values must be stored appropriately.
 	conf := opaque.DefaultConfiguration()
-	secretOprfSeed = conf.GenerateOPRFSeed()
-	serverPrivateKey, serverPublicKey = conf.KeyGen()
+	secretOprfSeed := conf.GenerateOPRFSeed()
+	serverPrivateKey, serverPublicKey := conf.KeyGen()
 
-	if serverPrivateKey == nil || serverPublicKey == nil || secretOprfSeed == nil {
-		log.Fatalf("Oh no! Something went wrong setting up the server secrets!")
+	// The server key material bundles and validates these values once, to be used in all subsequent sessions.
+	// conf.GenerateServerKeyMaterial() does all of the above in one call.
+	keys, err := conf.NewServerKeyMaterial(serverPrivateKey, serverPublicKey, secretOprfSeed)
+	if err != nil {
+		log.Fatalf("Oh no! Something went wrong setting up the server secrets! %v", err)
+	}
+
+	// The key material can be encoded to be stored, and later decoded and validated again.
+	keys, err = conf.DeserializeServerKeyMaterial(keys.Serialize())
+	if err != nil {
+		log.Fatalf("Oh no! Something went wrong decoding the server secrets! %v", err)
 	}
 
+	serverKeyMaterial = keys
+
 	fmt.Println("OPAQUE server values initialized.")
 
 	// Output: OPAQUE server values initialized.
@@ -205,9 +218,13 @@ func Example_registration() {
 	var message1, message2, message3 []byte
 	var credID []byte
 
+	// The client's registration state, which it must keep between message1 and message3.
+	var clientState *opaque.ClientRegistrationState
+
 	// The client starts, serializes the message, and sends it to the server.
 	{
-		c1 := client.RegistrationInit(password)
+		c1, state := client.RegistrationInit(password)
+		clientState = state
 		message1 = c1.Serialize()
 	}
 
@@ -221,14 +238,13 @@ func Example_registration() {
 		// The server creates a database entry for the client and creates a credential identifier that must absolutely
 		// be unique among all clients.
 		credID = opaque.RandomBytes(64)
-		pks, err := server.Deserialize.DecodeAkePublicKey(serverPublicKey)
+
+		// The server uses its public key and secret OPRF seed created at the setup.
+		response, err := server.RegistrationResponse(request, serverKeyMaterial, credID)
 		if err != nil {
 			log.Fatalln(err)
 		}
 
-		// The server uses its public key and secret OPRF seed created at the setup.
-		response := server.RegistrationResponse(request, pks, credID, secretOprfSeed)
-
 		// The server responds with its serialized response.
 		message2 = response.Serialize()
 	}
@@ -242,7 +258,11 @@ func Example_registration() {
 
 		// The client produces its record and a client-only-known secret export_key, that the client can use for other purposes (e.g. encrypt
 		// information to store on the server, and that the server can't decrypt). We don't use in the example here.
-		record, _ := client.RegistrationFinalize(response, clientID, serverID)
+		record, _, err := client.RegistrationFinalize(response, clientID, serverID, clientState)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
 		message3 = record.Serialize()
 	}
 
@@ -299,9 +319,14 @@ func Example_loginKeyExchange() {
 	var message1, message2, message3 []byte
 	var clientSessionKey, serverSessionKey []byte
 
+	// The client and server's session states, which they must keep until the end of the login.
+	var clientState *opaque.ClientLoginState
+	var serverState *opaque.ServerLoginState
+
 	// The client initiates the ball and sends the serialized ke1 to the server.
 	{
-		ke1 := client.LoginInit(password)
+		ke1, state := client.LoginInit(password)
+		clientState = state
 		message1 = ke1.Serialize()
 	}
 
@@ -312,12 +337,13 @@ func Example_loginKeyExchange() {
 			log.Fatalln(err)
 		}
 
-		ke2, err := server.LoginInit(ke1, serverID, serverPrivateKey, serverPublicKey, secretOprfSeed,
-			exampleClientRecord)
+		ke2, state, err := server.LoginInit(ke1, serverID, serverKeyMaterial, exampleClientRecord)
 		if err != nil {
 			log.Fatalln(err)
 		}
 
+		serverState = state
+
 		message2 = ke2.Serialize()
 	}
 
@@ -330,7 +356,7 @@ func Example_loginKeyExchange() {
 		}
 
 		// In this example, we don't use the secret export key. The client sends the serialized ke3 to the server.
-		ke3, _, err := client.LoginFinish(clientID, serverID, ke2)
+		ke3, _, err := client.LoginFinish(clientID, serverID, ke2, clientState)
 		if err != nil {
 			log.Fatalln(err)
 		}
@@ -338,7 +364,7 @@ func Example_loginKeyExchange() {
 		message3 = ke3.Serialize()
 
 		// If no error occurred, the server can be trusted, and the client can use the session key.
-		clientSessionKey = client.SessionKey()
+		clientSessionKey = clientState.SessionKey()
 	}
 
 	// The server must absolutely validate this last message to authenticate the client and continue. If this message
@@ -350,12 +376,12 @@ func Example_loginKeyExchange() {
 			log.Fatalln(err)
 		}
 
-		if err := server.LoginFinish(ke3); err != nil {
+		if err := server.LoginFinish(ke3, serverState); err != nil {
 			log.Fatalln(err)
 		}
 
 		// If no error occurred at this point, the server can trust the client and safely extract the shared session key.
-		serverSessionKey = server.SessionKey()
+		serverSessionKey = serverState.SessionKey()
 	}
 
 	// The following test does not exist in the real world and simply proves the point that the keys match.
@@ -409,7 +435,7 @@ func Example_fakeResponse() {
 			log.Fatalln(err)
 		}
 
-		ke2, err := server.LoginInit(ke1, serverID, serverPrivateKey, serverPublicKey, secretOprfSeed, fakeRecord)
+		ke2, _, err := server.LoginInit(ke1, serverID, serverKeyMaterial, fakeRecord)
 		if err != nil {
 			log.Fatalln(err)
 		}
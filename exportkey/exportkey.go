@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+// Package exportkey turns the client's OPAQUE export key into usable keys, and protects client-side encrypted blobs,
+// e.g. backups, that can be stored on the server next to the client's record without the server being able to read
+// them.
+package exportkey
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+
+	"github.com/bytemare/opaque"
+	"github.com/bytemare/opaque/internal"
+	"github.com/bytemare/opaque/internal/encoding"
+	"github.com/bytemare/opaque/internal/tag"
+)
+
+const (
+	// blobVersion is the version of the blob encoding, sealed with AES-256-GCM.
+	blobVersion byte = 1
+
+	aeadKeyLength = 32
+)
+
+var (
+	// ErrBlobVersion indicates that the blob has an unsupported version.
+	ErrBlobVersion = errors.New("unsupported blob version")
+
+	// ErrBlobAuthentication indicates that the blob could not be opened, because it has been tampered with, or was
+	// sealed under another export key, for another purpose, or with other additional data.
+	ErrBlobAuthentication = errors.New("blob authentication failed")
+
+	// ErrNoPurpose indicates that no purpose label was given.
+	ErrNoPurpose = errors.New("missing purpose label")
+
+	// ErrNoExportKey indicates that the export key is empty.
+	ErrNoExportKey = errors.New("missing export key")
+
+	// ErrKeyLength indicates that the requested key length is zero, negative, or too long for the KDF.
+	ErrKeyLength = errors.New("invalid derived key length")
+
+	errBlobTooShort = errors.New("blob is too short")
+)
+
+// Keys derives purpose-labelled keys from an export key, through the configuration's KDF.
+type Keys struct {
+	conf      *internal.Configuration
+	exportKey []byte
+}
+
+// New returns the Keys of the export key, as returned by LoginFinish, RegistrationFinalize, or
+// PasswordChangeFinalize, in the configuration the client uses.
+func New(conf *opaque.Configuration, exportKey []byte) (*Keys, error) {
+	if len(exportKey) == 0 {
+		return nil, ErrNoExportKey
+	}
+
+	client, err := conf.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Keys{
+		conf:      client.GetConf(),
+		exportKey: append([]byte(nil), exportKey...),
+	}, nil
+}
+
+// Derive returns a key of the given length for the purpose. Different purposes or lengths yield independent keys, and
+// the same purpose and length always yield the same key for an export key. Applications should use a distinct purpose for every use. The
+// length must be positive and at most 255 times the KDF's output size.
+func (k *Keys) Derive(purpose string, length int) ([]byte, error) {
+	if purpose == "" {
+		return nil, ErrNoPurpose
+	}
+
+	if length <= 0 || length > 255*k.conf.KDF.Size() {
+		return nil, ErrKeyLength
+	}
+
+	info := encoding.Concat(encoding.I2OSP(length, 2), []byte(tag.ExportKeyPurpose+purpose))
+
+	return k.conf.KDF.Expand(k.exportKey, info, length), nil
+}
+
+// aead returns the AEAD sealing the purpose's blobs. Its key is separated from the ones returned by Derive.
+func (k *Keys) aead(purpose string) (cipher.AEAD, error) {
+	if purpose == "" {
+		return nil, ErrNoPurpose
+	}
+
+	key := k.conf.KDF.Expand(k.exportKey, []byte(tag.ExportKeyBlob+purpose), aeadKeyLength)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// blobAD returns the additional data authenticated with a blob, binding it to its version, purpose, and the caller's
+// additional data.
+func blobAD(purpose string, ad []byte) []byte {
+	return encoding.Concat3([]byte{blobVersion}, encoding.EncodeVector([]byte(purpose)), encoding.EncodeVector(ad))
+}
+
+// Seal encrypts and authenticates the plaintext with the purpose's key, and binds it to the additional data, e.g. the
+// client's credential identifier. It returns a versioned blob that can be opened with Open.
+func (k *Keys) Seal(purpose string, plaintext, ad []byte) ([]byte, error) {
+	aead, err := k.aead(purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := internal.RandomBytes(aead.NonceSize())
+
+	return aead.Seal(encoding.Concat([]byte{blobVersion}, nonce), nonce, plaintext, blobAD(purpose, ad)), nil
+}
+
+// Open decrypts and verifies a blob sealed with Seal for the purpose and additional data, and returns the plaintext.
+func (k *Keys) Open(purpose string, blob, ad []byte) ([]byte, error) {
+	aead, err := k.aead(purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(blob) == 0 {
+		return nil, errBlobTooShort
+	}
+
+	if blob[0] != blobVersion {
+		return nil, ErrBlobVersion
+	}
+
+	if len(blob) < 1+aead.NonceSize()+aead.Overhead() {
+		return nil, errBlobTooShort
+	}
+
+	nonce := blob[1 : 1+aead.NonceSize()]
+
+	plaintext, err := aead.Open(nil, nonce, blob[1+aead.NonceSize():], blobAD(purpose, ad))
+	if err != nil {
+		return nil, ErrBlobAuthentication
+	}
+
+	return plaintext, nil
+}
+
+// Reencrypt opens the blobs with the old keys and seals them again with the new ones, e.g. after a password change
+// where the old export key is given by ClientPasswordChangeState.OldExportKey and the new one by
+// PasswordChangeFinalize. The blobs are returned in the same order. Nothing is returned if a single blob fails to
+// open, so that the caller never stores a partially migrated set.
+func Reencrypt(oldKeys, newKeys *Keys, purpose string, ad []byte, blobs ...[]byte) ([][]byte, error) {
+	out := make([][]byte, len(blobs))
+
+	for i, blob := range blobs {
+		plaintext, err := oldKeys.Open(purpose, blob, ad)
+		if err != nil {
+			return nil, fmt.Errorf("blob %d: %w", i, err)
+		}
+
+		out[i], err = newKeys.Seal(purpose, plaintext, ad)
+		if err != nil {
+			return nil, fmt.Errorf("blob %d: %w", i, err)
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,206 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/bytemare/opaque/internal/encoding"
+	"github.com/bytemare/opaque/message"
+)
+
+// MessageType identifies the message held in a frame.
+type MessageType byte
+
+const (
+	// MessageRegistrationRequest identifies a RegistrationRequest.
+	MessageRegistrationRequest MessageType = iota + 1
+
+	// MessageRegistrationResponse identifies a RegistrationResponse.
+	MessageRegistrationResponse
+
+	// MessageRegistrationRecord identifies a RegistrationRecord.
+	MessageRegistrationRecord
+
+	// MessagePasswordChangeRecord identifies a PasswordChangeRecord.
+	MessagePasswordChangeRecord
+
+	// MessageKE1 identifies a KE1.
+	MessageKE1
+
+	// MessageKE2 identifies a KE2.
+	MessageKE2
+
+	// MessageKE3 identifies a KE3.
+	MessageKE3
+
+	// MessagePasswordChangeResponse identifies a PasswordChangeResponse.
+	MessagePasswordChangeResponse
+)
+
+// frameVersion is the version of the frame encoding.
+const frameVersion byte = 1
+
+// ConfigurationIDLength is the length of a configuration identifier.
+const ConfigurationIDLength = 8
+
+// frameHeaderLength is the length of the message type, the version, and the configuration identifier.
+const frameHeaderLength = 2 + ConfigurationIDLength
+
+var (
+	// ErrFrameVersion indicates that the frame has an unsupported version.
+	ErrFrameVersion = errors.New("unsupported frame version")
+
+	// ErrFrameConfiguration indicates that the frame was created under another configuration.
+	ErrFrameConfiguration = errors.New("frame was created under a different configuration")
+
+	errFrameEncoding    = errors.New("invalid frame encoding")
+	errFrameMessageType = errors.New("invalid frame message type")
+)
+
+// Message is a protocol message of the message package.
+type Message interface {
+	Serialize() []byte
+}
+
+// FrameHeader holds the fields that precede the message in a frame.
+type FrameHeader struct {
+	// ConfigurationID identifies the configuration the message was created under, as returned by
+	// Configuration.ID.
+	ConfigurationID []byte
+
+	// Type identifies the message.
+	Type MessageType
+
+	// Version is the version of the frame encoding.
+	Version byte
+}
+
+func configurationID(encodedConf []byte) []byte {
+	h := sha256.Sum256(encodedConf)
+	return h[:ConfigurationIDLength]
+}
+
+// ID returns the identifier of the configuration in frames, the first bytes of the SHA-256 hash of its encoding.
+func (c *Configuration) ID() []byte {
+	return configurationID(c.Serialize())
+}
+
+func messageType(m Message) (MessageType, error) {
+	switch m.(type) {
+	case *message.RegistrationRequest:
+		return MessageRegistrationRequest, nil
+	case *message.RegistrationResponse:
+		return MessageRegistrationResponse, nil
+	case *message.RegistrationRecord:
+		return MessageRegistrationRecord, nil
+	case *message.PasswordChangeResponse:
+		return MessagePasswordChangeResponse, nil
+	case *message.PasswordChangeRecord:
+		return MessagePasswordChangeRecord, nil
+	case *message.KE1:
+		return MessageKE1, nil
+	case *message.KE2:
+		return MessageKE2, nil
+	case *message.KE3, message.KE3:
+		return MessageKE3, nil
+	default:
+		return 0, errFrameMessageType
+	}
+}
+
+// Frame returns the self-describing encoding of the message, which prefixes its byte encoding with the message type,
+// the frame version, the configuration identifier, and the message length, so that a receiver supporting several
+// configurations can pick the one of the message. It can be decoded with Deserializer.Decode.
+func (c *Configuration) Frame(m Message) ([]byte, error) {
+	t, err := messageType(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return encoding.Concatenate(
+		[]byte{byte(t), frameVersion},
+		c.ID(),
+		encoding.EncodeVector(m.Serialize()),
+	), nil
+}
+
+// DecodeFrameHeader returns the header of the frame, e.g. to select the Deserializer of its configuration. It
+// returns ErrFrameVersion if the frame has an unsupported version, and doesn't verify the message.
+func DecodeFrameHeader(frame []byte) (*FrameHeader, error) {
+	if len(frame) < frameHeaderLength {
+		return nil, errFrameEncoding
+	}
+
+	if frame[1] != frameVersion {
+		return nil, ErrFrameVersion
+	}
+
+	return &FrameHeader{
+		ConfigurationID: frame[2:frameHeaderLength],
+		Type:            MessageType(frame[0]),
+		Version:         frame[1],
+	}, nil
+}
+
+// Decode takes a frame encoded with Configuration.Frame, and returns the decoded message, validated as by the
+// Deserializer function of its type, e.g. a *message.KE1 for a frame of type MessageKE1. It returns
+// ErrFrameConfiguration if the frame was created under a different configuration than the Deserializer's.
+func (d *Deserializer) Decode(frame []byte) (Message, error) {
+	header, err := DecodeFrameHeader(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(header.ConfigurationID, configurationID(d.encodedConf)) {
+		return nil, ErrFrameConfiguration
+	}
+
+	m, offset, err := encoding.DecodeVector(frame[frameHeaderLength:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errFrameEncoding, err)
+	}
+
+	if frameHeaderLength+offset != len(frame) {
+		return nil, errFrameEncoding
+	}
+
+	var decoded Message
+
+	switch header.Type {
+	case MessageRegistrationRequest:
+		decoded, err = d.RegistrationRequest(m)
+	case MessageRegistrationResponse:
+		decoded, err = d.RegistrationResponse(m)
+	case MessageRegistrationRecord:
+		decoded, err = d.RegistrationRecord(m)
+	case MessagePasswordChangeResponse:
+		decoded, err = d.PasswordChangeResponse(m)
+	case MessagePasswordChangeRecord:
+		decoded, err = d.PasswordChangeRecord(m)
+	case MessageKE1:
+		decoded, err = d.KE1(m)
+	case MessageKE2:
+		decoded, err = d.KE2(m)
+	case MessageKE3:
+		decoded, err = d.KE3(m)
+	default:
+		return nil, errFrameMessageType
+	}
+
+	// Not returning decoded on error, which would be a non-nil interface holding a nil message.
+	if err != nil {
+		return nil, err
+	}
+
+	return decoded, nil
+}
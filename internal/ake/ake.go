@@ -0,0 +1,193 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+// Package ake provides high-level functions for the AKEs, 3DH, HMQV, and SIGMA-I, that share the same messages,
+// transcript, and key schedule, and differ in how they compute the input keying material. SIGMA-I additionally
+// authenticates both parties with signatures, carried in KE2 and KE3.
+package ake
+
+import (
+	"github.com/bytemare/crypto/group"
+
+	"github.com/bytemare/opaque/internal"
+	"github.com/bytemare/opaque/internal/encoding"
+	"github.com/bytemare/opaque/internal/tag"
+	"github.com/bytemare/opaque/message"
+)
+
+// Identifier identifies an AKE.
+type Identifier byte
+
+const (
+	// TripleDH identifies the 3DH AKE.
+	TripleDH Identifier = 1 + iota
+
+	// HMQV identifies the HMQV AKE.
+	HMQV
+
+	// SigmaI identifies the SIGMA-I signature-based AKE.
+	SigmaI
+)
+
+// keyExchange computes the input keying material of an AKE, from a party's secret keys, its peer's public keys, and
+// both identities.
+type keyExchange interface {
+	clientIKM(
+		g group.Group,
+		esk, secretKey *group.Scalar,
+		serverEpk, serverPublicKey *group.Point,
+		clientIdentity, serverIdentity []byte,
+	) []byte
+	serverIKM(
+		g group.Group,
+		esk, secretKey *group.Scalar,
+		clientEpk, clientPublicKey *group.Point,
+		clientIdentity, serverIdentity []byte,
+	) []byte
+}
+
+var keyExchanges = map[Identifier]keyExchange{
+	TripleDH: tripleDH{},
+	HMQV:     hmqv{},
+	SigmaI:   sigmaI{},
+}
+
+// Available returns whether the AKE is implemented.
+func (i Identifier) Available() bool {
+	_, ok := keyExchanges[i]
+	return ok
+}
+
+// Supports returns whether the AKE can be used in the group. HMQV adds points, which the x-only encoding of Curve25519
+// doesn't allow, and SIGMA-I needs a signature scheme in the group.
+func (i Identifier) Supports(g group.Group) bool {
+	switch i {
+	case HMQV:
+		return g != group.Curve25519Sha512
+	case SigmaI:
+		return SignatureLength(g) != 0
+	default:
+		return true
+	}
+}
+
+func (i Identifier) get() keyExchange {
+	kex, ok := keyExchanges[i]
+	if !ok {
+		panic("invalid AKE identifier")
+	}
+
+	return kex
+}
+
+// KeyGen returns private and public keys in the group. In Curve25519, the private key is clamped as in X25519.
+func KeyGen(id group.Group) (privateKey, publicKey []byte) {
+	scalar := randomSecretKey(id)
+
+	return encoding.SerializeScalar(scalar, id), DerivePublicKey(id, scalar)
+}
+
+// DerivePublicKey returns the encoding of the public key corresponding to the private key.
+func DerivePublicKey(id group.Group, privateKey *group.Scalar) []byte {
+	return encoding.SerializePoint(id.Base().Mult(privateKey), id)
+}
+
+// setValues - testing: integrated to support testing, to force values.
+// There's no effect if esk, epk, and nonce have already been set in a previous call.
+func setValues(g group.Group, scalar *group.Scalar, nonce []byte, nonceLen int) (s *group.Scalar, n []byte) {
+	if scalar != nil {
+		s = scalar
+	} else {
+		s = randomSecretKey(g)
+	}
+
+	if len(nonce) == 0 {
+		nonce = internal.RandomBytes(nonceLen)
+	}
+
+	return s, nonce
+}
+
+func buildLabel(length int, label, context []byte) []byte {
+	return encoding.Concat3(
+		encoding.I2OSP(length, 2),
+		encoding.EncodeVectorLen(append([]byte(tag.LabelPrefix), label...), 1),
+		encoding.EncodeVectorLen(context, 1))
+}
+
+func expand(h *internal.KDF, secret, hkdfLabel []byte) []byte {
+	return h.Expand(secret, hkdfLabel, h.Size())
+}
+
+func expandLabel(h *internal.KDF, secret, label, context []byte) []byte {
+	hkdfLabel := buildLabel(h.Size(), label, context)
+	return expand(h, secret, hkdfLabel)
+}
+
+func deriveSecret(h *internal.KDF, secret, label, context []byte) []byte {
+	return expandLabel(h, secret, label, context)
+}
+
+func initTranscript(
+	conf *internal.Configuration,
+	transcript *internal.Hash,
+	clientIdentity, serverIdentity, ke1 []byte,
+	ke2 *message.KE2,
+) {
+	encodedClientID := encoding.EncodeVector(clientIdentity)
+	encodedServerID := encoding.EncodeVector(serverIdentity)
+	transcript.Write(encoding.Concatenate([]byte(tag.VersionTag), encoding.EncodeVector(conf.Context),
+		encodedClientID, ke1,
+		encodedServerID, ke2.CredentialResponse.Serialize(), ke2.NonceS, encoding.SerializePoint(ke2.EpkS, conf.Group)))
+}
+
+func deriveKeys(h *internal.KDF, ikm, context []byte) (serverMacKey, clientMacKey, sessionSecret []byte) {
+	prk := h.Extract(nil, ikm)
+	handshakeSecret := deriveSecret(h, prk, []byte(tag.Handshake), context)
+	sessionSecret = deriveSecret(h, prk, []byte(tag.SessionKey), context)
+	serverMacKey = expandLabel(h, handshakeSecret, []byte(tag.MacServer), nil)
+	clientMacKey = expandLabel(h, handshakeSecret, []byte(tag.MacClient), nil)
+
+	return serverMacKey, clientMacKey, sessionSecret
+}
+
+// sessionKeys holds the outputs of the key schedule. The server's and the client's transcripts are the hashes their
+// MACs, and their signatures in SIGMA-I, are computed over.
+type sessionKeys struct {
+	sessionSecret    []byte
+	serverMac        []byte
+	clientMac        []byte
+	serverTranscript []byte
+	clientTranscript []byte
+}
+
+// keySchedule derives the session secret and both MACs from the input keying material and the transcript.
+func keySchedule(
+	conf *internal.Configuration,
+	ikm, clientIdentity, serverIdentity, ke1 []byte,
+	ke2 *message.KE2,
+) *sessionKeys {
+	// Each session gets its own running hash, so that concurrent sessions never share transcript state.
+	transcript := conf.Hash.New()
+	initTranscript(conf, transcript, clientIdentity, serverIdentity, ke1, ke2)
+
+	transcript2 := transcript.Sum()
+	serverMacKey, clientMacKey, sessionSecret := deriveKeys(conf.KDF, ikm, transcript2) // preamble
+	serverMac := conf.MAC.MAC(serverMacKey, transcript2)
+	transcript.Write(serverMac)
+	transcript3 := transcript.Sum()
+	clientMac := conf.MAC.MAC(clientMacKey, transcript3)
+
+	return &sessionKeys{
+		sessionSecret:    sessionSecret,
+		serverMac:        serverMac,
+		clientMac:        clientMac,
+		serverTranscript: transcript2,
+		clientTranscript: transcript3,
+	}
+}
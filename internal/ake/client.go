@@ -14,22 +14,29 @@ import (
 	"github.com/bytemare/crypto/group"
 
 	"github.com/bytemare/opaque/internal"
+	"github.com/bytemare/opaque/internal/tag"
 	"github.com/bytemare/opaque/message"
 )
 
-var errAkeInvalidServerMac = errors.New(" AKE finalization: invalid server mac")
+var (
+	errAkeInvalidServerMac       = errors.New(" AKE finalization: invalid server mac")
+	errAkeInvalidServerSignature = errors.New(" AKE finalization: invalid server signature")
+)
 
 // Client exposes the client's AKE functions and holds its state.
 type Client struct {
+	kex           keyExchange
+	signatures    bool
 	esk           *group.Scalar
 	Ke1           []byte
 	sessionSecret []byte
+	clientMac     []byte
 	nonceU        []byte // testing: integrated to support testing, to force values.
 }
 
-// NewClient returns a new, empty, 3DH client.
-func NewClient() *Client {
-	return &Client{}
+// NewClient returns a new, empty, client for the AKE.
+func NewClient(id Identifier) *Client {
+	return &Client{kex: id.get(), signatures: id == SigmaI}
 }
 
 // SetValues - testing: integrated to support testing, to force values.
@@ -47,7 +54,12 @@ func (c *Client) SetValues(g group.Group, esk *group.Scalar, nonce []byte, nonce
 	return g.Base().Mult(c.esk)
 }
 
-// Start initiates the 3DH protocol, and returns a KE1 message with clientInfo.
+// Values returns the ephemeral secret key and nonce of the client, to allow exporting its state.
+func (c *Client) Values() (esk *group.Scalar, nonce []byte) {
+	return c.esk, c.nonceU
+}
+
+// Start initiates the AKE, and returns a KE1 message with clientInfo.
 func (c *Client) Start(cs group.Group) *message.KE1 {
 	epk := c.SetValues(cs, nil, nil, 32)
 
@@ -59,7 +71,8 @@ func (c *Client) Start(cs group.Group) *message.KE1 {
 }
 
 // Finalize verifies and responds to KE3. If the handshake is successful, the session key is stored and this functions
-// returns a KE3 message.
+// returns a KE3 message. With signatures, the server's signature is verified, and KE3 is signed with the client's
+// secret key.
 func (c *Client) Finalize(
 	conf *internal.Configuration,
 	clientIdentity []byte,
@@ -68,19 +81,51 @@ func (c *Client) Finalize(
 	serverPublicKey *group.Point,
 	ke2 *message.KE2,
 ) (*message.KE3, error) {
-	ikm := k3dh(conf.Group, ke2.EpkS, c.esk, serverPublicKey, c.esk, ke2.EpkS, clientSecretKey)
-	sessionSecret, serverMac, clientMac := core3DH(conf, ikm, clientIdentity, serverIdentity, c.Ke1, ke2)
-
-	if !conf.MAC.Equal(serverMac, ke2.Mac) {
+	ikm := c.kex.clientIKM(
+		conf.Group,
+		c.esk,
+		clientSecretKey,
+		ke2.EpkS,
+		serverPublicKey,
+		clientIdentity,
+		serverIdentity,
+	)
+	keys := keySchedule(conf, ikm, clientIdentity, serverIdentity, c.Ke1, ke2)
+
+	if !conf.MAC.Equal(keys.serverMac, ke2.Mac) {
 		return nil, errAkeInvalidServerMac
 	}
 
-	c.sessionSecret = sessionSecret
+	ke3 := &message.KE3{Mac: keys.clientMac}
+
+	if c.signatures {
+		if !verify(conf.Group, serverPublicKey, tag.SigmaServer, keys.serverTranscript, ke2.Signature) {
+			return nil, errAkeInvalidServerSignature
+		}
+
+		signer := SigningKey(conf.Group, clientSecretKey)
+
+		signature, err := sign(conf.Group, signer, tag.SigmaClient, keys.clientTranscript)
+		if err != nil {
+			return nil, err
+		}
+
+		ke3.Signature = signature
+	}
+
+	c.sessionSecret = keys.sessionSecret
+	c.clientMac = keys.clientMac
 
-	return &message.KE3{Mac: clientMac}, nil
+	return ke3, nil
 }
 
 // SessionKey returns the secret shared session key if a previous call to Finalize() was successful.
 func (c *Client) SessionKey() []byte {
 	return c.sessionSecret
 }
+
+// ClientMac returns the client's MAC, authenticating the whole transcript, if a previous call to Finalize() was
+// successful.
+func (c *Client) ClientMac() []byte {
+	return c.clientMac
+}
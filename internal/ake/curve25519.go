@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package ake
+
+import (
+	"crypto/sha512"
+	"math/big"
+
+	"github.com/bytemare/crypto/group"
+
+	"github.com/bytemare/opaque/internal"
+	"github.com/bytemare/opaque/internal/encoding"
+	"github.com/bytemare/opaque/internal/oprf"
+	"github.com/bytemare/opaque/internal/tag"
+)
+
+const curve25519ScalarLength = 32
+
+// order25519 is the order of the prime-order subgroup of Curve25519, 2^252 + 27742317777372353535851937790883648493.
+var order25519, _ = new(big.Int).SetString(
+	"7237005577332262213973186563042994240857116359379907606001950938285454250989",
+	10,
+)
+
+// clampedScalar returns the X25519 scalar of the 32 input bytes, i.e. clamped as in RFC 7748, and reduced modulo the
+// subgroup order. On points of the prime-order subgroup, it yields the same results as X25519. It's never zero, since
+// clamped values are multiples of 8 between 2^254 and 2^255, and none of the multiples of the odd order in that range
+// is one.
+func clampedScalar(g group.Group, in []byte) *group.Scalar {
+	k := make([]byte, curve25519ScalarLength)
+	copy(k, in)
+
+	k[0] &= 248
+	k[31] &= 127
+	k[31] |= 64
+
+	return reduce25519(g, k)
+}
+
+// reduce25519 returns the scalar of the little-endian integer, reduced modulo the subgroup order.
+func reduce25519(g group.Group, in []byte) *group.Scalar {
+	n := new(big.Int).SetBytes(reverse(in))
+	n.Mod(n, order25519)
+
+	s, err := g.NewScalar().Decode(reverse(n.FillBytes(make([]byte, curve25519ScalarLength))))
+	if err != nil {
+		// Can't happen: the value is reduced and of canonical length.
+		panic(err)
+	}
+
+	return s
+}
+
+func reverse(in []byte) []byte {
+	out := make([]byte, len(in))
+	for i, b := range in {
+		out[len(in)-1-i] = b
+	}
+
+	return out
+}
+
+// DeriveKey returns the secret key deterministically derived from the seed and info. In Curve25519, it is the clamped
+// scalar of the hashed input, as X25519 key generation does, and otherwise the OPRF's key derivation in the group.
+func DeriveKey(g group.Group, seed, info []byte) *group.Scalar {
+	if g != group.Curve25519Sha512 {
+		return oprf.Ciphersuite(g).DeriveKey(seed, info)
+	}
+
+	h := sha512.New()
+	_, _ = h.Write([]byte(tag.DeriveKeyPair))
+	_, _ = h.Write(seed)
+	_, _ = h.Write(encoding.EncodeVector(info))
+
+	return clampedScalar(g, h.Sum(nil)[:curve25519ScalarLength])
+}
+
+// hashToScalar returns the scalar hashed from the input and the domain separation tag. In Curve25519, the group
+// backend reduces modulo the field order instead of the group order, and its output is thus replaced by a wide
+// reduction of a SHA-512 hash, as in Ed25519.
+func hashToScalar(g group.Group, input, dst []byte) *group.Scalar {
+	if g != group.Curve25519Sha512 {
+		return g.HashToScalar(input, dst)
+	}
+
+	h := sha512.New()
+	_, _ = h.Write(encoding.EncodeVector(dst))
+	_, _ = h.Write(input)
+
+	return reduce25519(g, h.Sum(nil))
+}
+
+// randomSecretKey returns a random secret key in the group, clamped in Curve25519.
+func randomSecretKey(g group.Group) *group.Scalar {
+	if g != group.Curve25519Sha512 {
+		return g.NewScalar().Random()
+	}
+
+	return clampedScalar(g, internal.RandomBytes(curve25519ScalarLength))
+}
+
+// ValidPublicKey returns whether the point is a valid peer public key in the group, i.e. is not the identity and is in
+// the prime-order subgroup. Only Curve25519 has a cofactor: its points of low or mixed order are rejected, since they
+// could reveal information about the secret keys they're multiplied with. P is in the subgroup if (order-1)P + P is
+// the identity, (order-1) being the scalar -1.
+func ValidPublicKey(g group.Group, p *group.Point) bool {
+	if p == nil || p.IsIdentity() {
+		return false
+	}
+
+	if g != group.Curve25519Sha512 {
+		return true
+	}
+
+	one, err := g.NewScalar().Decode(append([]byte{1}, make([]byte, curve25519ScalarLength-1)...))
+	if err != nil {
+		panic(err)
+	}
+
+	minusOne := g.NewScalar().Sub(one)
+
+	return p.Mult(minusOne).Add(p).IsIdentity()
+}
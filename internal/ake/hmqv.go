@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package ake
+
+import (
+	"github.com/bytemare/crypto/group"
+
+	"github.com/bytemare/opaque/internal/encoding"
+	"github.com/bytemare/opaque/internal/tag"
+)
+
+// hmqv implements the HMQV key exchange, which needs fewer scalar multiplications than 3DH. With X and Y the client's
+// and server's ephemeral public keys, A and B their long-term public keys, d = H(X, idS), and e = H(Y, idC), both
+// parties compute the same point (X·A^d)^(y+e·b) = (Y·B^e)^(x+d·a).
+type hmqv struct{}
+
+// hmqvExponents returns d and e.
+func hmqvExponents(g group.Group, clientEpk, serverEpk *group.Point, clientIdentity, serverIdentity []byte) (
+	d, e *group.Scalar,
+) {
+	d = hashToScalar(
+		g,
+		encoding.Concat(encoding.SerializePoint(clientEpk, g), encoding.EncodeVector(serverIdentity)),
+		[]byte(tag.HMQVClient),
+	)
+	e = hashToScalar(
+		g,
+		encoding.Concat(encoding.SerializePoint(serverEpk, g), encoding.EncodeVector(clientIdentity)),
+		[]byte(tag.HMQVServer),
+	)
+
+	return d, e
+}
+
+func (hmqv) clientIKM(
+	g group.Group,
+	esk, secretKey *group.Scalar,
+	serverEpk, serverPublicKey *group.Point,
+	clientIdentity, serverIdentity []byte,
+) []byte {
+	d, e := hmqvExponents(g, g.Base().Mult(esk), serverEpk, clientIdentity, serverIdentity)
+	sigma := serverEpk.Add(serverPublicKey.Mult(e)).Mult(esk.Add(d.Mult(secretKey)))
+
+	return encoding.SerializePoint(sigma, g)
+}
+
+func (hmqv) serverIKM(
+	g group.Group,
+	esk, secretKey *group.Scalar,
+	clientEpk, clientPublicKey *group.Point,
+	clientIdentity, serverIdentity []byte,
+) []byte {
+	d, e := hmqvExponents(g, clientEpk, g.Base().Mult(esk), clientIdentity, serverIdentity)
+	sigma := clientEpk.Add(clientPublicKey.Mult(d)).Mult(esk.Add(e.Mult(secretKey)))
+
+	return encoding.SerializePoint(sigma, g)
+}
@@ -9,107 +9,177 @@
 package ake
 
 import (
+	"crypto"
 	"errors"
 
 	"github.com/bytemare/crypto/group"
 
 	"github.com/bytemare/opaque/internal"
+	"github.com/bytemare/opaque/internal/encoding"
+	"github.com/bytemare/opaque/internal/tag"
 	"github.com/bytemare/opaque/message"
 )
 
-var errStateNotEmpty = errors.New("existing state is not empty")
+var errAkeNoSigner = errors.New("AKE response: missing server signing key")
 
-// Server exposes the server's AKE functions and holds its state.
+// Server exposes the server's AKE functions. It holds no session state and can be used concurrently.
 type Server struct {
-	clientMac     []byte
-	sessionSecret []byte
+	kex        keyExchange
+	signatures bool
 
 	// testing: integrated to support testing, to force values.
 	esk    *group.Scalar
 	nonceS []byte
 }
 
-// NewServer returns a new, empty, 3DH server.
-func NewServer() *Server {
-	return &Server{}
+// NewServer returns a new server for the AKE.
+func NewServer(id Identifier) *Server {
+	return &Server{kex: id.get(), signatures: id == SigmaI}
 }
 
 // SetValues - testing: integrated to support testing, to force values.
-// There's no effect if esk, epk, and nonce have already been set in a previous call.
+// Forced values are used in every subsequent session, and must therefore never be set outside of tests.
 func (s *Server) SetValues(g group.Group, esk *group.Scalar, nonce []byte, nonceLen int) *group.Point {
-	es, nonce := setValues(g, esk, nonce, nonceLen)
-	if s.esk == nil || (esk != nil && s.esk != es) {
-		s.esk = es
+	s.esk, s.nonceS = setValues(g, esk, nonce, nonceLen)
+	return g.Base().Mult(s.esk)
+}
+
+// ServerState holds the server's state of a single AKE session, between Response and Finalize. With signatures, it
+// also holds the client's transcript and the client's public key to verify the client's signature with.
+type ServerState struct {
+	clientMac        []byte
+	sessionSecret    []byte
+	clientTranscript []byte
+	clientPublicKey  []byte
+
+	// finished is only set once Finalize authenticated the client. It's not part of the serialized state, and is
+	// restored with SetFinished.
+	finished bool
+}
+
+// NewServerState returns a ServerState holding the given expected client MAC and session secret.
+func NewServerState(clientMac, sessionSecret []byte) *ServerState {
+	return &ServerState{
+		clientMac:     clientMac,
+		sessionSecret: sessionSecret,
 	}
+}
 
-	if s.nonceS == nil {
-		s.nonceS = nonce
+// NewSignedServerState returns a ServerState holding the given expected client MAC, session secret, and what's needed
+// to verify the client's signature.
+func NewSignedServerState(clientMac, sessionSecret, clientTranscript, clientPublicKey []byte) *ServerState {
+	return &ServerState{
+		clientMac:        clientMac,
+		sessionSecret:    sessionSecret,
+		clientTranscript: clientTranscript,
+		clientPublicKey:  clientPublicKey,
 	}
+}
 
-	return g.Base().Mult(s.esk)
+// SessionKey returns the secret shared session key.
+func (s *ServerState) SessionKey() []byte {
+	return s.sessionSecret
 }
 
-// Response produces a 3DH server response message.
+// Finished returns whether Finalize successfully authenticated the client with this state.
+func (s *ServerState) Finished() bool {
+	return s.finished
+}
+
+// SetFinished marks a state restored from its serialization as finished, for states that Finalize had already
+// authenticated the client with.
+func SetFinished(state *ServerState) {
+	state.finished = true
+}
+
+// ExpectedMAC returns the expected client MAC.
+func (s *ServerState) ExpectedMAC() []byte {
+	return s.clientMac
+}
+
+// Serialize returns a []byte containing the state.
+func (s *ServerState) Serialize() []byte {
+	return encoding.Concatenate(s.clientMac, s.sessionSecret, s.clientTranscript, s.clientPublicKey)
+}
+
+// Response produces an AKE server response message, and the session state to keep until Finalize. The signer is only
+// used, and must then be set, with signatures.
 func (s *Server) Response(
 	conf *internal.Configuration,
 	serverIdentity []byte,
 	serverSecretKey *group.Scalar,
+	signer crypto.Signer,
 	clientIdentity []byte,
 	clientPublicKey *group.Point,
 	ke1 *message.KE1,
 	response *message.CredentialResponse,
-) *message.KE2 {
-	epk := s.SetValues(conf.Group, nil, nil, conf.NonceLen)
+) (*message.KE2, *ServerState, error) {
+	esk, nonce := setValues(conf.Group, s.esk, s.nonceS, conf.NonceLen)
 
 	ke2 := &message.KE2{
 		G:                  conf.Group,
 		CredentialResponse: response,
-		NonceS:             s.nonceS,
-		EpkS:               epk,
+		NonceS:             nonce,
+		EpkS:               conf.Group.Base().Mult(esk),
 	}
 
-	ikm := k3dh(conf.Group, ke1.EpkU, s.esk, ke1.EpkU, serverSecretKey, clientPublicKey, s.esk)
-	sessionSecret, serverMac, clientMac := core3DH(conf, ikm, clientIdentity, serverIdentity, ke1.Serialize(), ke2)
-	s.sessionSecret = sessionSecret
-	s.clientMac = clientMac
-	ke2.Mac = serverMac
+	ikm := s.kex.serverIKM(conf.Group, esk, serverSecretKey, ke1.EpkU, clientPublicKey, clientIdentity, serverIdentity)
+	keys := keySchedule(conf, ikm, clientIdentity, serverIdentity, ke1.Serialize(), ke2)
+	ke2.Mac = keys.serverMac
 
-	return ke2
-}
+	if !s.signatures {
+		return ke2, NewServerState(keys.clientMac, keys.sessionSecret), nil
+	}
 
-// Finalize verifies the authentication tag contained in ke3.
-func (s *Server) Finalize(conf *internal.Configuration, ke3 *message.KE3) bool {
-	return conf.MAC.Equal(s.clientMac, ke3.Mac)
-}
+	if signer == nil {
+		return nil, nil, errAkeNoSigner
+	}
 
-// SessionKey returns the secret shared session key if a previous call to Response() was successful.
-func (s *Server) SessionKey() []byte {
-	return s.sessionSecret
-}
+	signature, err := sign(conf.Group, signer, tag.SigmaServer, keys.serverTranscript)
+	if err != nil {
+		return nil, nil, err
+	}
 
-// ExpectedMAC returns the expected client MAC if a previous call to Response() was successful.
-func (s *Server) ExpectedMAC() []byte {
-	return s.clientMac
+	ke2.Signature = signature
+	state := NewSignedServerState(
+		keys.clientMac,
+		keys.sessionSecret,
+		keys.clientTranscript,
+		encoding.SerializePoint(clientPublicKey, conf.Group),
+	)
+
+	return ke2, state, nil
 }
 
-// SerializeState will return a []byte containing internal state of the Server.
-func (s *Server) SerializeState() []byte {
-	state := make([]byte, len(s.clientMac)+len(s.sessionSecret))
+// Finalize verifies the authentication tag, and the signature if any, contained in ke3 against the session state. On
+// success, the state is marked as finished.
+func (s *Server) Finalize(conf *internal.Configuration, state *ServerState, ke3 *message.KE3) bool {
+	if !s.authenticate(conf, state, ke3) {
+		return false
+	}
 
-	i := copy(state, s.clientMac)
-	copy(state[i:], s.sessionSecret)
+	state.finished = true
 
-	return state
+	return true
 }
 
-// SetState will set the given clientMac and sessionSecret in the server's internal state.
-func (s *Server) SetState(clientMac, sessionSecret []byte) error {
-	if len(s.clientMac) != 0 || len(s.sessionSecret) != 0 {
-		return errStateNotEmpty
+func (s *Server) authenticate(conf *internal.Configuration, state *ServerState, ke3 *message.KE3) bool {
+	if !conf.MAC.Equal(state.clientMac, ke3.Mac) {
+		return false
+	}
+
+	if !s.signatures {
+		return len(ke3.Signature) == 0
+	}
+
+	if state.clientPublicKey == nil {
+		return false
 	}
 
-	s.clientMac = clientMac
-	s.sessionSecret = sessionSecret
+	clientPublicKey, err := conf.Group.NewElement().Decode(state.clientPublicKey)
+	if err != nil {
+		return false
+	}
 
-	return nil
+	return verify(conf.Group, clientPublicKey, tag.SigmaClient, state.clientTranscript, ke3.Signature)
 }
@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package ake
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+
+	"github.com/bytemare/crypto/group"
+
+	"github.com/bytemare/opaque/internal/encoding"
+)
+
+var errSignatureEncoding = errors.New("invalid signature encoding")
+
+// sigmaI implements a SIGMA-I style AKE, in which the parties authenticate with signatures over the transcript instead
+// of using their long-term keys in the key exchange. The input keying material is thus the ephemeral Diffie-Hellman
+// secret only, and the MACs prove knowledge of the keys derived from it. The long-term key pairs are ECDSA key pairs,
+// so that the server's key can live in a device that only signs.
+type sigmaI struct{}
+
+func (sigmaI) clientIKM(
+	g group.Group,
+	esk, _ *group.Scalar,
+	serverEpk, _ *group.Point,
+	_, _ []byte,
+) []byte {
+	return encoding.SerializePoint(serverEpk.Mult(esk), g)
+}
+
+func (sigmaI) serverIKM(
+	g group.Group,
+	esk, _ *group.Scalar,
+	clientEpk, _ *group.Point,
+	_, _ []byte,
+) []byte {
+	return encoding.SerializePoint(clientEpk.Mult(esk), g)
+}
+
+// ecdsaParameters returns the curve and hash function of ECDSA in the group, and false if the group has no ECDSA.
+func ecdsaParameters(g group.Group) (elliptic.Curve, crypto.Hash, bool) {
+	switch g {
+	case group.P256Sha256:
+		return elliptic.P256(), crypto.SHA256, true
+	case group.P384Sha384:
+		return elliptic.P384(), crypto.SHA384, true
+	case group.P521Sha512:
+		return elliptic.P521(), crypto.SHA512, true
+	default:
+		return nil, 0, false
+	}
+}
+
+// SignatureLength returns the byte length of a signature in the group, or 0 if the group has no signature scheme.
+// Signatures are encoded as the fixed-length concatenation of r and s.
+func SignatureLength(g group.Group) int {
+	curve, _, ok := ecdsaParameters(g)
+	if !ok {
+		return 0
+	}
+
+	return 2 * scalarLength(curve)
+}
+
+func scalarLength(curve elliptic.Curve) int {
+	return (curve.Params().N.BitLen() + 7) / 8
+}
+
+// SigningKey returns the ECDSA private key with the secret key of the group, or nil if the group has no ECDSA.
+func SigningKey(g group.Group, secretKey *group.Scalar) crypto.Signer {
+	curve, _, ok := ecdsaParameters(g)
+	if !ok {
+		return nil
+	}
+
+	d := new(big.Int).SetBytes(encoding.SerializeScalar(secretKey, g))
+	x, y := curve.ScalarBaseMult(d.Bytes())
+
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y},
+		D:         d,
+	}
+}
+
+// EncodeSigningPublicKey returns the encoding of the signer's public key as an element of the group, and false if it
+// is not an ECDSA key on the group's curve.
+func EncodeSigningPublicKey(g group.Group, signer crypto.Signer) ([]byte, bool) {
+	curve, _, ok := ecdsaParameters(g)
+	if !ok {
+		return nil, false
+	}
+
+	pk, ok := signer.Public().(*ecdsa.PublicKey)
+	if !ok || pk.Curve != curve {
+		return nil, false
+	}
+
+	return elliptic.MarshalCompressed(curve, pk.X, pk.Y), true
+}
+
+func signatureDigest(h crypto.Hash, label string, transcript []byte) []byte {
+	d := h.New()
+	_, _ = d.Write([]byte(label))
+	_, _ = d.Write(transcript)
+
+	return d.Sum(nil)
+}
+
+// sign returns the fixed-length signature of the labelled transcript hash.
+func sign(g group.Group, signer crypto.Signer, label string, transcript []byte) ([]byte, error) {
+	curve, h, _ := ecdsaParameters(g)
+
+	der, err := signer.Sign(cryptorand.Reader, signatureDigest(h, label, transcript), h)
+	if err != nil {
+		return nil, err
+	}
+
+	var sig struct {
+		R, S *big.Int
+	}
+
+	if rest, err := asn1.Unmarshal(der, &sig); err != nil || len(rest) != 0 {
+		return nil, errSignatureEncoding
+	}
+
+	length := scalarLength(curve)
+	if sig.R.Sign() <= 0 || sig.S.Sign() <= 0 || sig.R.BitLen() > 8*length || sig.S.BitLen() > 8*length {
+		return nil, errSignatureEncoding
+	}
+
+	out := make([]byte, 2*length)
+	sig.R.FillBytes(out[:length])
+	sig.S.FillBytes(out[length:])
+
+	return out, nil
+}
+
+// verify returns whether the signature of the labelled transcript hash is valid for the public key.
+func verify(g group.Group, publicKey *group.Point, label string, transcript, signature []byte) bool {
+	curve, h, ok := ecdsaParameters(g)
+	if !ok || len(signature) != 2*scalarLength(curve) {
+		return false
+	}
+
+	x, y := elliptic.UnmarshalCompressed(curve, encoding.SerializePoint(publicKey, g))
+	if x == nil {
+		return false
+	}
+
+	length := scalarLength(curve)
+	r := new(big.Int).SetBytes(signature[:length])
+	s := new(big.Int).SetBytes(signature[length:])
+
+	return ecdsa.Verify(&ecdsa.PublicKey{Curve: curve, X: x, Y: y}, signatureDigest(h, label, transcript), r, s)
+}
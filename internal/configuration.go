@@ -40,9 +40,11 @@ type Configuration struct {
 	EnvelopeSize    int
 	OPRFPointLength int
 	AkePointLength  int
+	SignatureLength int
 	Group           group.Group
 	OPRF            oprf.Ciphersuite
 	Context         []byte
+	KSFSalt         []byte
 }
 
 // RandomBytes returns random bytes of length len (wrapper for crypto/rand).
@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package encoding
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	errJSONObject       = errors.New("expected a JSON object")
+	errJSONValue        = errors.New("expected a string value")
+	errJSONUnknownField = errors.New("unknown field")
+	errJSONDuplicate    = errors.New("duplicate field")
+	errJSONTrailingData = errors.New("trailing data after the JSON object")
+)
+
+// JSONField is a named value of a JSON object, in which it's base64url encoded.
+type JSONField struct {
+	Name  string
+	Value []byte
+
+	// Optional fields are omitted when empty.
+	Optional bool
+}
+
+// MarshalJSON returns a JSON object holding the base64url encoded values of the fields, in order.
+func MarshalJSON(fields ...JSONField) ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+
+	for _, f := range fields {
+		if f.Optional && len(f.Value) == 0 {
+			continue
+		}
+
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+
+		name, err := json.Marshal(f.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(name)
+		buf.WriteString(`:"`)
+		buf.WriteString(base64.RawURLEncoding.EncodeToString(f.Value))
+		buf.WriteByte('"')
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON returns the base64url decoded values of the named fields of the JSON object, in the order of the names.
+// Absent fields have empty values, and unknown or duplicate fields are rejected.
+func UnmarshalJSON(encoded []byte, names ...string) ([][]byte, error) {
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		index[name] = i
+	}
+
+	values := make([][]byte, len(names))
+	seen := make([]bool, len(names))
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+
+	if t, err := decoder.Token(); err != nil || t != json.Delim('{') {
+		return nil, errJSONObject
+	}
+
+	for decoder.More() {
+		t, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		name, _ := t.(string)
+
+		i, ok := index[name]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", errJSONUnknownField, name)
+		}
+
+		if seen[i] {
+			return nil, fmt.Errorf("%w %q", errJSONDuplicate, name)
+		}
+
+		seen[i] = true
+
+		if t, err = decoder.Token(); err != nil {
+			return nil, err
+		}
+
+		value, ok := t.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w for %q", errJSONValue, name)
+		}
+
+		if values[i], err = base64.RawURLEncoding.DecodeString(value); err != nil {
+			return nil, fmt.Errorf("decoding %q: %w", name, err)
+		}
+	}
+
+	// The closing delimiter.
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, errJSONTrailingData
+	}
+
+	return values, nil
+}
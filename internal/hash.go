@@ -81,6 +81,11 @@ func (h *Hash) Size() int {
 	return h.h.OutputSize()
 }
 
+// New returns a new Hash of the same function, with its own fresh running state.
+func (h *Hash) New() *Hash {
+	return &Hash{h: h.h.Get()}
+}
+
 // Sum returns the current hash of the running state.
 func (h *Hash) Sum() []byte {
 	return h.h.Sum(nil)
@@ -91,21 +96,32 @@ func (h *Hash) Write(p []byte) {
 	_, _ = h.h.Write(p)
 }
 
-// NewKSF returns a newly instantiated KSF.
-func NewKSF(id ksf.Identifier) *KSF {
+// NewKSF returns a newly instantiated KSF, with the given parameters or the KSF's defaults if there are none.
+func NewKSF(id ksf.Identifier, parameters ...int) *KSF {
 	if id == 0 {
 		return &KSF{&IdentityKSF{}}
 	}
 
-	return &KSF{id.Get()}
+	k := id.Get()
+	if len(parameters) != 0 {
+		k.Parameterize(parameters...)
+	}
+
+	return &KSF{k}
+}
+
+// NewCustomKSF returns a KSF wrapping the given key stretching function.
+func NewCustomKSF(k KeyStretcher) *KSF {
+	return &KSF{k}
 }
 
 // KSF wraps a key stretching function and exposes its functions.
 type KSF struct {
-	ksfInterface
+	KeyStretcher
 }
 
-type ksfInterface interface {
+// KeyStretcher is the interface of key stretching functions.
+type KeyStretcher interface {
 	// Harden uses default parameters for the key derivation function over the input password and salt.
 	Harden(password, salt []byte, length int) []byte
 }
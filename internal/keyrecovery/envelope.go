@@ -94,7 +94,8 @@ func Store(
 	return env, pku, export
 }
 
-// Recover returns the client's private and public key, as well as the secret export key.
+// Recover returns the client's private and public key, as well as the secret export key. In the SIGMA-I mode, the key
+// pair is the client's signing key pair.
 func Recover(
 	conf *internal.Configuration,
 	randomizedPwd, serverPublicKey, clientIdentity, serverIdentity []byte,
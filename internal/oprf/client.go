@@ -31,6 +31,16 @@ func (c *Client) SetBlind(blind *group.Scalar) {
 	c.blind = blind
 }
 
+// SetInput allows to set the input when restoring a previously blinded state.
+func (c *Client) SetInput(input []byte) {
+	c.input = input
+}
+
+// State returns the input and blinding scalar of the client, to allow exporting its state.
+func (c *Client) State() (input []byte, blind *group.Scalar) {
+	return c.input, c.blind
+}
+
 // Blind masks the input.
 func (c *Client) Blind(input []byte) *group.Point {
 	if c.blind == nil {
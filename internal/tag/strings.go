@@ -62,11 +62,47 @@ const (
 	// MacClient is 3DH server's MAC key KDF dst.
 	MacClient = "ClientMAC"
 
+	// HMQVClient is the HMQV client ephemeral key's hash-to-scalar dst.
+	HMQVClient = "OPAQUE-HMQV-Client"
+
+	// HMQVServer is the HMQV server ephemeral key's hash-to-scalar dst.
+	HMQVServer = "OPAQUE-HMQV-Server"
+
+	// SigmaServer is the SIGMA-I server signature context.
+	SigmaServer = "OPAQUE-SIGMA-Server"
+
+	// SigmaClient is the SIGMA-I client signature context.
+	SigmaClient = "OPAQUE-SIGMA-Client"
+
+	// ExporterSecret is the session exporter secret dst.
+	ExporterSecret = "ExporterSecret"
+
+	// ClientTraffic is the client-to-server traffic secret dst.
+	ClientTraffic = "ClientTraffic"
+
+	// ServerTraffic is the server-to-client traffic secret dst.
+	ServerTraffic = "ServerTraffic"
+
 	// Client tags.
 
 	// CredentialResponsePad is the masking keys KDF dst to expand to the input.
 	CredentialResponsePad = "CredentialResponsePad"
 
+	// ClientState is the client state authentication key's KDF dst.
+	ClientState = "OPAQUE-ClientState"
+
+	// PasswordChange is the password change record authentication key's KDF dst.
+	PasswordChange = "OPAQUE-PasswordChange"
+
+	// PasswordChangeResponse is the password change response authentication key's KDF dst.
+	PasswordChangeResponse = "OPAQUE-PasswordChangeResponse"
+
+	// ExportKeyPurpose is the prefix of the export key's purpose-labelled subkeys KDF dst.
+	ExportKeyPurpose = "OPAQUE-ExportKey-"
+
+	// ExportKeyBlob is the prefix of the export key's blob sealing keys KDF dst.
+	ExportKeyBlob = "OPAQUE-ExportKeyBlob-"
+
 	// Server tags.
 
 	// ExpandOPRF is the server's OPRF key seed KDF dst.
@@ -74,4 +110,13 @@ const (
 
 	// DeriveKeyPair is the server's OPRF hash-to-scalar dst.
 	DeriveKeyPair = "OPAQUE-DeriveKeyPair"
+
+	// FakePrivateKey is the fake record's private key seed KDF dst.
+	FakePrivateKey = "FakePrivateKey"
+
+	// FakeMaskingKey is the fake record's masking key KDF dst.
+	FakeMaskingKey = "FakeMaskingKey"
+
+	// SealedState is the server's login state sealing key KDF dst.
+	SealedState = "OPAQUE-SealedState"
 )
@@ -0,0 +1,228 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/bytemare/opaque/internal/encoding"
+)
+
+// serverKeyringVersion is the version of the server keyring encoding.
+const serverKeyringVersion byte = 1
+
+var (
+	// ErrUnknownKeyVersion indicates that the keyring holds no key material for the requested version, e.g. because a
+	// record was registered under a version that has since been removed. Such clients must register again.
+	ErrUnknownKeyVersion = errors.New("no server key material for this key version")
+
+	// ErrKeyVersionExists indicates that the keyring already holds key material for the version.
+	ErrKeyVersionExists = errors.New("server key material already exists for this key version")
+
+	// ErrRemoveCurrentKeyVersion indicates an attempt to remove the current key version from the keyring.
+	ErrRemoveCurrentKeyVersion = errors.New("can't remove the current key version")
+
+	errServerKeyringEncoding = errors.New("invalid server keyring encoding")
+	errServerKeyringEmpty    = errors.New("server keyring is empty")
+)
+
+// ServerKeyring holds versioned server key material, enabling the rotation of the server's AKE key pair and OPRF seed
+// without forcing all clients to register again at once. The key material with the highest version is the current
+// one: new registrations use it, and records registered under an older version can be moved to it with a password
+// change, possibly to the same password, in their next login session. It is safe for concurrent use.
+type ServerKeyring struct {
+	keys    map[uint32]*ServerKeyMaterial
+	current uint32
+	mutex   sync.RWMutex
+}
+
+// NewServerKeyring returns a new, empty, server keyring.
+func NewServerKeyring() *ServerKeyring {
+	return &ServerKeyring{keys: make(map[uint32]*ServerKeyMaterial)}
+}
+
+// Add registers the key material under the version. If the version is higher than all others, the key material
+// becomes the current one. All key material in a keyring must have been created under the same configuration.
+func (k *ServerKeyring) Add(version uint32, keys *ServerKeyMaterial) error {
+	if !keys.hasSecret() {
+		return ErrNoServerKeyMaterial
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if _, ok := k.keys[version]; ok {
+		return ErrKeyVersionExists
+	}
+
+	if len(k.keys) != 0 {
+		c := k.keys[k.current]
+		if c.group != keys.group || len(c.oprfSeed) != len(keys.oprfSeed) {
+			return ErrServerKeyMaterialConfiguration
+		}
+	}
+
+	if len(k.keys) == 0 || version > k.current {
+		k.current = version
+	}
+
+	k.keys[version] = keys
+
+	return nil
+}
+
+// Remove deletes the key material of the version, e.g. once no more records use it. The current version can't be
+// removed. Removing an absent version is not an error.
+func (k *ServerKeyring) Remove(version uint32) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if _, ok := k.keys[version]; ok && version == k.current {
+		return ErrRemoveCurrentKeyVersion
+	}
+
+	delete(k.keys, version)
+
+	return nil
+}
+
+// Get returns the key material registered under the version, or ErrUnknownKeyVersion if there is none.
+func (k *ServerKeyring) Get(version uint32) (*ServerKeyMaterial, error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	keys, ok := k.keys[version]
+	if !ok {
+		return nil, ErrUnknownKeyVersion
+	}
+
+	return keys, nil
+}
+
+// Current returns the current key version and its key material. The key material is nil if the keyring is empty.
+func (k *ServerKeyring) Current() (uint32, *ServerKeyMaterial) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	return k.current, k.keys[k.current]
+}
+
+// Versions returns the key versions held by the keyring, in ascending order.
+func (k *ServerKeyring) Versions() []uint32 {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	return k.sortedVersions()
+}
+
+func (k *ServerKeyring) sortedVersions() []uint32 {
+	versions := make([]uint32, 0, len(k.keys))
+	for v := range k.keys {
+		versions = append(versions, v)
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	return versions
+}
+
+// ForRecord returns the key material the record was registered under. Fake records, as returned by GetFakeRecord,
+// GetDeterministicFakeRecord, or Server.GetRecord, are always answered with the current key material, as a freshly
+// registered client would be.
+func (k *ServerKeyring) ForRecord(record *ClientRecord) (*ServerKeyMaterial, error) {
+	if err := verifyRecord(record); err != nil {
+		return nil, err
+	}
+
+	if record.fake {
+		_, keys := k.Current()
+		if keys == nil {
+			return nil, errServerKeyringEmpty
+		}
+
+		return keys, nil
+	}
+
+	return k.Get(record.KeyVersion)
+}
+
+// NeedsReRegistration returns whether the record was registered under an older key version than the current one. If
+// so, the client should register again in its login session, by changing its password, possibly to the same one, with
+// Server.PasswordChangeResponseWithKeyring, so that the old key version can eventually be removed. As with any
+// registration, the client's export key changes.
+func (k *ServerKeyring) NeedsReRegistration(record *ClientRecord) bool {
+	if record == nil || record.fake {
+		return false
+	}
+
+	current, _ := k.Current()
+
+	return record.KeyVersion != current
+}
+
+// Serialize returns the versioned byte encoding of all the key material in the keyring. It contains secret values, and
+// must be stored accordingly.
+func (k *ServerKeyring) Serialize() []byte {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	out := []byte{serverKeyringVersion}
+
+	for _, v := range k.sortedVersions() {
+		version := make([]byte, 4)
+		binary.BigEndian.PutUint32(version, v)
+		out = encoding.Concat3(out, version, encoding.EncodeVector(k.keys[v].Serialize()))
+	}
+
+	return out
+}
+
+// DeserializeServerKeyring decodes and validates a keyring encoded with ServerKeyring.Serialize.
+func (c *Configuration) DeserializeServerKeyring(encoded []byte) (*ServerKeyring, error) {
+	if len(encoded) == 0 {
+		return nil, errServerKeyringEncoding
+	}
+
+	if encoded[0] != serverKeyringVersion {
+		return nil, ErrServerKeyMaterialVersion
+	}
+
+	keyring := NewServerKeyring()
+	in := encoded[1:]
+
+	for len(in) != 0 {
+		if len(in) < 4 {
+			return nil, errServerKeyringEncoding
+		}
+
+		version := binary.BigEndian.Uint32(in)
+
+		v, offset, err := encoding.DecodeVector(in[4:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errServerKeyringEncoding, err)
+		}
+
+		keys, err := c.DeserializeServerKeyMaterial(v)
+		if err != nil {
+			return nil, fmt.Errorf("key version %d: %w", version, err)
+		}
+
+		if err := keyring.Add(version, keys); err != nil {
+			return nil, fmt.Errorf("key version %d: %w", version, err)
+		}
+
+		in = in[4+offset:]
+	}
+
+	return keyring, nil
+}
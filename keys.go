@@ -0,0 +1,256 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+
+	"github.com/bytemare/crypto/group"
+
+	"github.com/bytemare/opaque/internal"
+	"github.com/bytemare/opaque/internal/ake"
+	"github.com/bytemare/opaque/internal/encoding"
+)
+
+// serverKeyMaterialVersion is the version of the server key material encoding.
+const serverKeyMaterialVersion byte = 1
+
+var (
+	// ErrServerKeyMaterialVersion indicates that the encoded server key material has an unsupported version.
+	ErrServerKeyMaterialVersion = errors.New("unsupported server key material version")
+
+	// ErrServerKeyMaterialConfiguration indicates that the server key material was created under another
+	// configuration.
+	ErrServerKeyMaterialConfiguration = errors.New("server key material was created under a different configuration")
+
+	// ErrNoServerKeyMaterial indicates that no server key material was given.
+	ErrNoServerKeyMaterial = errors.New("missing server key material")
+
+	// ErrServerKeyMismatch indicates that the server's public key does not correspond to its secret key. Clients would
+	// then fail every login with an invalid MAC error.
+	ErrServerKeyMismatch = errors.New("server public key does not match the secret key")
+
+	// ErrServerSigningKey indicates that the signer's public key is not an ECDSA key on the curve of the AKE group.
+	ErrServerSigningKey = errors.New("server signing key is not valid in the AKE group")
+
+	errServerKeyMaterialEncoding = errors.New("invalid server key material encoding")
+)
+
+// ServerKeyMaterial holds the server's long-term AKE key pair and OPRF seed. It is created once, with
+// Configuration.GenerateServerKeyMaterial, Configuration.NewServerKeyMaterial, or
+// Configuration.DeserializeServerKeyMaterial, which validate it up front, and can then be used across all
+// registrations and logins. In the SigmaI mode, it can instead hold a signer, with
+// Configuration.NewServerSigningKeyMaterial.
+type ServerKeyMaterial struct {
+	secretKey        *group.Scalar
+	signer           crypto.Signer
+	publicKey        *group.Point
+	encodedPublicKey []byte
+	oprfSeed         []byte
+	group            group.Group
+}
+
+// GenerateServerKeyMaterial returns a new server key pair and OPRF seed.
+func (c *Configuration) GenerateServerKeyMaterial() (*ServerKeyMaterial, error) {
+	if err := c.verify(); err != nil {
+		return nil, err
+	}
+
+	sk, pk := c.KeyGen()
+
+	return c.NewServerKeyMaterial(sk, pk, c.GenerateOPRFSeed())
+}
+
+// NewServerKeyMaterial returns the server key material built from the encoded secret key, public key, and OPRF seed,
+// after verifying that they're valid in the configuration, and that the public key matches the secret key. It returns
+// ErrServerKeyMismatch if they don't.
+func (c *Configuration) NewServerKeyMaterial(secretKey, publicKey, oprfSeed []byte) (*ServerKeyMaterial, error) {
+	conf, err := c.toInternal()
+	if err != nil {
+		return nil, err
+	}
+
+	sks, err := conf.Group.NewScalar().Decode(secretKey)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", ErrInvalidServerSecretKey, err)
+	}
+
+	if sks.IsZero() {
+		return nil, ErrZeroSKS
+	}
+
+	if len(publicKey) != conf.AkePointLength {
+		return nil, ErrInvalidPksLength
+	}
+
+	pks, err := conf.Group.NewElement().Decode(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server public key: %w", err)
+	}
+
+	if len(oprfSeed) != conf.Hash.Size() {
+		return nil, ErrInvalidOPRFSeedLength
+	}
+
+	keys := &ServerKeyMaterial{
+		secretKey:        sks,
+		signer:           ake.SigningKey(conf.Group, sks),
+		publicKey:        pks,
+		encodedPublicKey: append([]byte(nil), publicKey...),
+		oprfSeed:         append([]byte(nil), oprfSeed...),
+		group:            conf.Group,
+	}
+
+	if err := keys.Verify(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// NewServerSigningKeyMaterial returns server key material for the SigmaI mode, in which the server's secret key is
+// only used to sign, and can thus stay within the signer, e.g. a hardware security module. The signer's public key
+// must be an ECDSA key on the curve of the AKE group, and is the server's public key. As it holds no secret key, such
+// key material can't be used in other modes, and its serialization can't be deserialized.
+func (c *Configuration) NewServerSigningKeyMaterial(signer crypto.Signer, oprfSeed []byte) (*ServerKeyMaterial, error) {
+	conf, err := c.toInternal()
+	if err != nil {
+		return nil, err
+	}
+
+	if signer == nil {
+		return nil, ErrNoServerKeyMaterial
+	}
+
+	publicKey, ok := ake.EncodeSigningPublicKey(conf.Group, signer)
+	if !ok {
+		return nil, ErrServerSigningKey
+	}
+
+	pks, err := conf.Group.NewElement().Decode(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrServerSigningKey, err)
+	}
+
+	if len(oprfSeed) != conf.Hash.Size() {
+		return nil, ErrInvalidOPRFSeedLength
+	}
+
+	return &ServerKeyMaterial{
+		signer:           signer,
+		publicKey:        pks,
+		encodedPublicKey: publicKey,
+		oprfSeed:         append([]byte(nil), oprfSeed...),
+		group:            conf.Group,
+	}, nil
+}
+
+// DeserializeServerKeyMaterial decodes and validates server key material encoded with ServerKeyMaterial.Serialize.
+func (c *Configuration) DeserializeServerKeyMaterial(encoded []byte) (*ServerKeyMaterial, error) {
+	if len(encoded) < 2 {
+		return nil, errServerKeyMaterialEncoding
+	}
+
+	if encoded[0] != serverKeyMaterialVersion {
+		return nil, ErrServerKeyMaterialVersion
+	}
+
+	if encoded[1] != byte(c.AKE) {
+		return nil, ErrServerKeyMaterialConfiguration
+	}
+
+	in := encoded[2:]
+	values := make([][]byte, 3)
+
+	for i := range values {
+		v, offset, err := encoding.DecodeVector(in)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errServerKeyMaterialEncoding, err)
+		}
+
+		values[i] = v
+		in = in[offset:]
+	}
+
+	if len(in) != 0 {
+		return nil, errServerKeyMaterialEncoding
+	}
+
+	return c.NewServerKeyMaterial(values[0], values[1], values[2])
+}
+
+// Serialize returns the versioned byte encoding of the server key material. It contains secret values, and must be
+// stored accordingly. The secret key is empty for key material created with NewServerSigningKeyMaterial.
+func (k *ServerKeyMaterial) Serialize() []byte {
+	var secretKey []byte
+	if k.secretKey != nil {
+		secretKey = encoding.SerializeScalar(k.secretKey, k.group)
+	}
+
+	return encoding.Concatenate(
+		[]byte{serverKeyMaterialVersion, byte(k.group)},
+		encoding.EncodeVector(secretKey),
+		encoding.EncodeVector(k.encodedPublicKey),
+		encoding.EncodeVector(k.oprfSeed),
+	)
+}
+
+// Verify returns ErrServerKeyMismatch if the public key is not the one derived from the secret key. It is always
+// called when creating or loading key material, and can be called again at any time, e.g. as a health check.
+func (k *ServerKeyMaterial) Verify() error {
+	if !k.hasSecret() {
+		return ErrNoServerKeyMaterial
+	}
+
+	if k.secretKey == nil {
+		publicKey, ok := ake.EncodeSigningPublicKey(k.group, k.signer)
+		if !ok || !bytes.Equal(publicKey, k.encodedPublicKey) {
+			return ErrServerKeyMismatch
+		}
+
+		return nil
+	}
+
+	if !bytes.Equal(ake.DerivePublicKey(k.group, k.secretKey), k.encodedPublicKey) {
+		return ErrServerKeyMismatch
+	}
+
+	return nil
+}
+
+// hasSecret returns whether the key material holds a secret key or a signer.
+func (k *ServerKeyMaterial) hasSecret() bool {
+	return k != nil && (k.secretKey != nil || k.signer != nil)
+}
+
+// PublicKey returns the encoding of the server's public key, to be distributed to clients.
+func (k *ServerKeyMaterial) PublicKey() []byte {
+	return k.encodedPublicKey
+}
+
+// verify returns an error if the key material was not created in the given configuration.
+func (k *ServerKeyMaterial) verify(conf *internal.Configuration) error {
+	if !k.hasSecret() {
+		return ErrNoServerKeyMaterial
+	}
+
+	if k.group != conf.Group || len(k.oprfSeed) != conf.Hash.Size() {
+		return ErrServerKeyMaterialConfiguration
+	}
+
+	// Key material with a signer only can't be used in the Diffie-Hellman based modes.
+	if k.secretKey == nil && conf.SignatureLength == 0 {
+		return ErrServerKeyMaterialConfiguration
+	}
+
+	return nil
+}
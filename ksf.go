@@ -0,0 +1,268 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/bytemare/crypto/ksf"
+
+	"github.com/bytemare/opaque/internal"
+	"github.com/bytemare/opaque/internal/encoding"
+)
+
+const (
+	ksfParameterLength = 4
+
+	// customKSF replaces the KSF identifier in the encoding of configurations using a KeyStretcher.
+	customKSF byte = 0xff
+
+	// These bound the cost of the KSF parameters, which clients may get from the server's configuration: at most
+	// 1 GiB of memory, and a number of passes or lanes over it, or of iterations, that stays within seconds.
+	maxKSFMemory     = 1 << 30
+	maxScryptP       = 16
+	maxArgon2idTime  = 16
+	maxPBKDF2Rounds  = 1 << 24
+	argon2idBlockKiB = 1 << 10
+)
+
+var (
+	// ErrMissingKeyStretcher indicates that a configuration marked with CustomKSF, e.g. a decoded one, is used without
+	// its KeyStretcher.
+	ErrMissingKeyStretcher = errors.New("the configuration uses a custom KSF, but no KeyStretcher is set")
+
+	errInvalidKSFParameters = errors.New("invalid KSF parameters")
+	errKeyStretcherKSF      = errors.New("a KeyStretcher can't be used with a KSF identifier")
+)
+
+// KeyStretcher is a key stretching function the client hardens the OPRF output with, e.g. a hardware-backed slow
+// hash, or bcrypt. It must be deterministic, as registration and login must derive the same randomized password.
+type KeyStretcher interface {
+	// Harden returns length bytes stretched from the password, with the salt set in the configuration.
+	Harden(password, salt []byte, length int) []byte
+}
+
+// ScryptParameters holds the cost parameters of the Scrypt KSF.
+type ScryptParameters struct {
+	// N is the CPU/memory cost, a power of 2 greater than 1. Scrypt uses 128·N·R bytes of memory, at most 1 GiB.
+	N uint32 `json:"n"`
+
+	// R is the block size.
+	R uint32 `json:"r"`
+
+	// P is the parallelization, at most 16.
+	P uint32 `json:"p"`
+}
+
+func (s *ScryptParameters) valid() bool {
+	n, r, p := uint64(s.N), uint64(s.R), uint64(s.P)
+
+	// These are the bounds enforced by golang.org/x/crypto/scrypt, and the memory and parallelization limits.
+	return n > 1 && n&(n-1) == 0 && r > 0 && p > 0 && r*p < 1<<30 &&
+		r <= math.MaxInt/128/p && n <= math.MaxInt/128/r &&
+		128*n*r <= maxKSFMemory && p <= maxScryptP
+}
+
+// Argon2idParameters holds the cost parameters of the Argon2id KSF.
+type Argon2idParameters struct {
+	// Time is the number of passes over the memory, at most 16.
+	Time uint32 `json:"time"`
+
+	// Memory is the memory size in KiB, at least 8 times the number of threads, and at most 1 GiB.
+	Memory uint32 `json:"memory"`
+
+	// Threads is the degree of parallelism, between 1 and 255.
+	Threads uint32 `json:"threads"`
+}
+
+func (a *Argon2idParameters) valid() bool {
+	return a.Time > 0 && a.Time <= maxArgon2idTime && a.Threads > 0 && a.Threads <= math.MaxUint8 &&
+		uint64(a.Memory) >= 8*uint64(a.Threads) && uint64(a.Memory)*argon2idBlockKiB <= maxKSFMemory
+}
+
+// PBKDF2Parameters holds the cost parameters of the PBKDF2 KSF.
+type PBKDF2Parameters struct {
+	// Iterations is the number of iterations, at most 2^24.
+	Iterations uint32 `json:"iterations"`
+}
+
+func (p *PBKDF2Parameters) valid() bool {
+	return p.Iterations > 0 && p.Iterations <= maxPBKDF2Rounds
+}
+
+// ksfParameters returns the parameters of the KSF, or nil if it uses its defaults. It returns an error if the
+// parameters are invalid, set for another KSF, or set for several KSFs.
+func (c *Configuration) ksfParameters() ([]uint32, error) {
+	var (
+		id     ksf.Identifier
+		params []uint32
+		valid  bool
+		set    int
+	)
+
+	if c.Scrypt != nil {
+		id, params, valid = ksf.Scrypt, []uint32{c.Scrypt.N, c.Scrypt.R, c.Scrypt.P}, c.Scrypt.valid()
+		set++
+	}
+
+	if c.Argon2id != nil {
+		id, valid = ksf.Argon2id, c.Argon2id.valid()
+		params = []uint32{c.Argon2id.Time, c.Argon2id.Memory, c.Argon2id.Threads}
+		set++
+	}
+
+	if c.PBKDF2 != nil {
+		id, params, valid = ksf.PBKDF2Sha512, []uint32{c.PBKDF2.Iterations}, c.PBKDF2.valid()
+		set++
+	}
+
+	if set == 0 {
+		return nil, nil
+	}
+
+	if set != 1 || id != c.KSF || !valid {
+		return nil, errInvalidKSFParameters
+	}
+
+	return params, nil
+}
+
+// usesKeyStretcher returns whether the configuration uses a custom key stretching function.
+func (c *Configuration) usesKeyStretcher() bool {
+	return c.KeyStretcher != nil || c.CustomKSF
+}
+
+// encodeKSFIdentifier returns the KSF identifier in the configuration encoding, which marks custom ones.
+func (c *Configuration) encodeKSFIdentifier() byte {
+	if c.usesKeyStretcher() {
+		return customKSF
+	}
+
+	return byte(c.KSF)
+}
+
+// keyStretcher returns the key stretching function of the configuration.
+func (c *Configuration) keyStretcher() *internal.KSF {
+	if c.KeyStretcher != nil {
+		return internal.NewCustomKSF(c.KeyStretcher)
+	}
+
+	params, _ := c.ksfParameters()
+	ksfParams := make([]int, len(params))
+
+	for i, p := range params {
+		ksfParams[i] = int(p)
+	}
+
+	return internal.NewKSF(c.KSF, ksfParams...)
+}
+
+// encodeKSF returns the encoding of the parameters set for the KSF followed by its salt, or nil if there are none.
+// Parameters are encoded, even if empty, when there's a salt.
+func (c *Configuration) encodeKSF() []byte {
+	params := c.encodeKSFParameters()
+	if len(c.KSFSalt) == 0 {
+		if params == nil {
+			return nil
+		}
+
+		return encoding.EncodeVector(params)
+	}
+
+	return encoding.Concat(encoding.EncodeVector(params), encoding.EncodeVector(c.KSFSalt))
+}
+
+// decodeKSF sets the parameters of the KSF and its salt from their encoding.
+func (c *Configuration) decodeKSF(encoded []byte) error {
+	params, offset, err := encoding.DecodeVector(encoded)
+	if err != nil {
+		return fmt.Errorf("decoding the KSF parameters: %w", err)
+	}
+
+	if err := c.decodeKSFParameters(params); err != nil {
+		return err
+	}
+
+	if offset == len(encoded) {
+		// Empty parameters are only encoded before a salt.
+		if len(params) == 0 {
+			return internal.ErrConfigurationInvalidLength
+		}
+
+		return nil
+	}
+
+	salt, n, err := encoding.DecodeVector(encoded[offset:])
+	if err != nil {
+		return fmt.Errorf("decoding the KSF salt: %w", err)
+	}
+
+	if offset+n != len(encoded) || len(salt) == 0 {
+		return internal.ErrConfigurationInvalidLength
+	}
+
+	c.KSFSalt = salt
+
+	return nil
+}
+
+// encodeKSFParameters returns the encoding of the parameters set for the KSF, or nil if there are none.
+func (c *Configuration) encodeKSFParameters() []byte {
+	var params []uint32
+
+	switch {
+	case c.KSF == ksf.Scrypt && c.Scrypt != nil:
+		params = []uint32{c.Scrypt.N, c.Scrypt.R, c.Scrypt.P}
+	case c.KSF == ksf.Argon2id && c.Argon2id != nil:
+		params = []uint32{c.Argon2id.Time, c.Argon2id.Memory, c.Argon2id.Threads}
+	case c.KSF == ksf.PBKDF2Sha512 && c.PBKDF2 != nil:
+		params = []uint32{c.PBKDF2.Iterations}
+	default:
+		return nil
+	}
+
+	out := make([]byte, ksfParameterLength*len(params))
+	for i, p := range params {
+		binary.BigEndian.PutUint32(out[i*ksfParameterLength:], p)
+	}
+
+	return out
+}
+
+// decodeKSFParameters sets the parameters of the KSF from their encoding. Empty parameters select the defaults.
+func (c *Configuration) decodeKSFParameters(encoded []byte) error {
+	if len(encoded) == 0 {
+		return nil
+	}
+
+	if len(encoded)%ksfParameterLength != 0 {
+		return errInvalidKSFParameters
+	}
+
+	params := make([]uint32, len(encoded)/ksfParameterLength)
+	for i := range params {
+		params[i] = binary.BigEndian.Uint32(encoded[i*ksfParameterLength:])
+	}
+
+	switch {
+	case c.KSF == ksf.Scrypt && len(params) == 3:
+		c.Scrypt = &ScryptParameters{N: params[0], R: params[1], P: params[2]}
+	case c.KSF == ksf.Argon2id && len(params) == 3:
+		c.Argon2id = &Argon2idParameters{Time: params[0], Memory: params[1], Threads: params[2]}
+	case c.KSF == ksf.PBKDF2Sha512 && len(params) == 1:
+		c.PBKDF2 = &PBKDF2Parameters{Iterations: params[0]}
+	default:
+		return errInvalidKSFParameters
+	}
+
+	return nil
+}
@@ -17,8 +17,8 @@ import (
 
 // CredentialRequest represents credential request message.
 type CredentialRequest struct {
-	C              oprf.Ciphersuite
-	BlindedMessage *group.Point `json:"blinded_message"`
+	C              oprf.Ciphersuite `json:"-"`
+	BlindedMessage *group.Point     `json:"blinded_message"`
 }
 
 // Serialize returns the byte encoding of CredentialRequest.
@@ -26,15 +26,37 @@ func (c *CredentialRequest) Serialize() []byte {
 	return c.C.SerializePoint(c.BlindedMessage)
 }
 
+func (c *CredentialRequest) jsonFields() []encoding.JSONField {
+	return []encoding.JSONField{{Name: "blinded_message", Value: c.Serialize()}}
+}
+
+// MarshalJSON returns the JSON encoding of CredentialRequest, with base64url encoded fields.
+func (c *CredentialRequest) MarshalJSON() ([]byte, error) {
+	return encoding.MarshalJSON(c.jsonFields()...)
+}
+
 // CredentialResponse represents credential response message.
 type CredentialResponse struct {
-	C                oprf.Ciphersuite
-	EvaluatedMessage *group.Point `json:"evaluated_message"`
-	MaskingNonce     []byte       `json:"masking_nonce"`
-	MaskedResponse   []byte       `json:"masked_response"`
+	C                oprf.Ciphersuite `json:"-"`
+	EvaluatedMessage *group.Point     `json:"evaluated_message"`
+	MaskingNonce     []byte           `json:"masking_nonce"`
+	MaskedResponse   []byte           `json:"masked_response"`
 }
 
 // Serialize returns the byte encoding of CredentialResponse.
 func (c *CredentialResponse) Serialize() []byte {
 	return encoding.Concat3(c.C.SerializePoint(c.EvaluatedMessage), c.MaskingNonce, c.MaskedResponse)
 }
+
+func (c *CredentialResponse) jsonFields() []encoding.JSONField {
+	return []encoding.JSONField{
+		{Name: "evaluated_message", Value: c.C.SerializePoint(c.EvaluatedMessage)},
+		{Name: "masking_nonce", Value: c.MaskingNonce},
+		{Name: "masked_response", Value: c.MaskedResponse},
+	}
+}
+
+// MarshalJSON returns the JSON encoding of CredentialResponse, with base64url encoded fields.
+func (c *CredentialResponse) MarshalJSON() ([]byte, error) {
+	return encoding.MarshalJSON(c.jsonFields()...)
+}
@@ -17,9 +17,9 @@ import (
 
 // KE1 is the first message of the login flow, created by the client and sent to the server.
 type KE1 struct {
-	G group.Group
+	G group.Group `json:"-"`
 	*CredentialRequest
-	NonceU []byte       `json:"client_none"`
+	NonceU []byte       `json:"client_nonce"`
 	EpkU   *group.Point `json:"client_ephemeral_pk"`
 }
 
@@ -28,29 +28,68 @@ func (m *KE1) Serialize() []byte {
 	return encoding.Concat3(m.CredentialRequest.Serialize(), m.NonceU, encoding.SerializePoint(m.EpkU, m.G))
 }
 
+// MarshalJSON returns the JSON encoding of KE1, with base64url encoded fields. It can be decoded with
+// opaque.Deserializer.KE1JSON.
+func (m *KE1) MarshalJSON() ([]byte, error) {
+	return encoding.MarshalJSON(append(
+		m.CredentialRequest.jsonFields(),
+		encoding.JSONField{Name: "client_nonce", Value: m.NonceU},
+		encoding.JSONField{Name: "client_ephemeral_pk", Value: encoding.SerializePoint(m.EpkU, m.G)},
+	)...)
+}
+
 // KE2 is the second message of the login flow, created by the server and sent to the client.
 type KE2 struct {
-	G group.Group
+	G group.Group `json:"-"`
 	*CredentialResponse
 	NonceS []byte       `json:"server_nonce"`
 	EpkS   *group.Point `json:"server_ephemeral_pk"`
-	Mac    []byte       `json:"server_mac"`
+
+	// Signature is the server's signature, only set in the SIGMA-I mode.
+	Signature []byte `json:"server_signature,omitempty"`
+	Mac       []byte `json:"server_mac"`
 }
 
 // Serialize returns the byte encoding of KE2.
 func (m *KE2) Serialize() []byte {
-	return encoding.Concat(
+	return encoding.Concatenate(
 		m.CredentialResponse.Serialize(),
-		encoding.Concat3(m.NonceS, encoding.SerializePoint(m.EpkS, m.G), m.Mac),
+		m.NonceS,
+		encoding.SerializePoint(m.EpkS, m.G),
+		m.Signature,
+		m.Mac,
 	)
 }
 
+// MarshalJSON returns the JSON encoding of KE2, with base64url encoded fields. It can be decoded with
+// opaque.Deserializer.KE2JSON.
+func (m *KE2) MarshalJSON() ([]byte, error) {
+	return encoding.MarshalJSON(append(
+		m.CredentialResponse.jsonFields(),
+		encoding.JSONField{Name: "server_nonce", Value: m.NonceS},
+		encoding.JSONField{Name: "server_ephemeral_pk", Value: encoding.SerializePoint(m.EpkS, m.G)},
+		encoding.JSONField{Name: "server_signature", Value: m.Signature, Optional: true},
+		encoding.JSONField{Name: "server_mac", Value: m.Mac},
+	)...)
+}
+
 // KE3 is the third and last message of the login flow, created by the client and sent to the server.
 type KE3 struct {
-	Mac []byte `json:"client_mac"`
+	// Signature is the client's signature, only set in the SIGMA-I mode.
+	Signature []byte `json:"client_signature,omitempty"`
+	Mac       []byte `json:"client_mac"`
 }
 
 // Serialize returns the byte encoding of KE3.
 func (k KE3) Serialize() []byte {
-	return k.Mac
+	return encoding.Concat(k.Signature, k.Mac)
+}
+
+// MarshalJSON returns the JSON encoding of KE3, with base64url encoded fields. It can be decoded with
+// opaque.Deserializer.KE3JSON.
+func (k KE3) MarshalJSON() ([]byte, error) {
+	return encoding.MarshalJSON(
+		encoding.JSONField{Name: "client_signature", Value: k.Signature, Optional: true},
+		encoding.JSONField{Name: "client_mac", Value: k.Mac},
+	)
 }
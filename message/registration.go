@@ -17,8 +17,8 @@ import (
 
 // RegistrationRequest is the first message of the registration flow, created by the client and sent to the server.
 type RegistrationRequest struct {
-	C              oprf.Ciphersuite
-	BlindedMessage *group.Point `json:"blinded_message"`
+	C              oprf.Ciphersuite `json:"-"`
+	BlindedMessage *group.Point     `json:"blinded_message"`
 }
 
 // Serialize returns the byte encoding of RegistrationRequest.
@@ -26,12 +26,18 @@ func (r *RegistrationRequest) Serialize() []byte {
 	return r.C.SerializePoint(r.BlindedMessage)
 }
 
+// MarshalJSON returns the JSON encoding of RegistrationRequest, with base64url encoded fields. It can be decoded with
+// opaque.Deserializer.RegistrationRequestJSON.
+func (r *RegistrationRequest) MarshalJSON() ([]byte, error) {
+	return encoding.MarshalJSON(encoding.JSONField{Name: "blinded_message", Value: r.Serialize()})
+}
+
 // RegistrationResponse is the second message of the registration flow, created by the server and sent to the client.
 type RegistrationResponse struct {
-	C                oprf.Ciphersuite
-	G                group.Group
-	EvaluatedMessage *group.Point `json:"evaluated_message"`
-	Pks              *group.Point `json:"server_public_key"`
+	C                oprf.Ciphersuite `json:"-"`
+	G                group.Group      `json:"-"`
+	EvaluatedMessage *group.Point     `json:"evaluated_message"`
+	Pks              *group.Point     `json:"server_public_key"`
 }
 
 // Serialize returns the byte encoding of RegistrationResponse.
@@ -39,11 +45,20 @@ func (r *RegistrationResponse) Serialize() []byte {
 	return encoding.Concat(r.C.SerializePoint(r.EvaluatedMessage), encoding.SerializePoint(r.Pks, r.G))
 }
 
+// MarshalJSON returns the JSON encoding of RegistrationResponse, with base64url encoded fields. It can be decoded
+// with opaque.Deserializer.RegistrationResponseJSON.
+func (r *RegistrationResponse) MarshalJSON() ([]byte, error) {
+	return encoding.MarshalJSON(
+		encoding.JSONField{Name: "evaluated_message", Value: r.C.SerializePoint(r.EvaluatedMessage)},
+		encoding.JSONField{Name: "server_public_key", Value: encoding.SerializePoint(r.Pks, r.G)},
+	)
+}
+
 // RegistrationRecord represents the client record sent as the last registration message by the client to the server.
 type RegistrationRecord struct {
-	G          group.Group
+	G          group.Group  `json:"-"`
 	PublicKey  *group.Point `json:"client_public_key"`
-	MaskingKey []byte       `json:"making_key"`
+	MaskingKey []byte       `json:"masking_key"`
 	Envelope   []byte       `json:"envelope"`
 }
 
@@ -51,3 +66,61 @@ type RegistrationRecord struct {
 func (r *RegistrationRecord) Serialize() []byte {
 	return encoding.Concat3(encoding.SerializePoint(r.PublicKey, r.G), r.MaskingKey, r.Envelope)
 }
+
+func (r *RegistrationRecord) jsonFields() []encoding.JSONField {
+	return []encoding.JSONField{
+		{Name: "client_public_key", Value: encoding.SerializePoint(r.PublicKey, r.G)},
+		{Name: "masking_key", Value: r.MaskingKey},
+		{Name: "envelope", Value: r.Envelope},
+	}
+}
+
+// MarshalJSON returns the JSON encoding of RegistrationRecord, with base64url encoded fields. It can be decoded with
+// opaque.Deserializer.RegistrationRecordJSON.
+func (r *RegistrationRecord) MarshalJSON() ([]byte, error) {
+	return encoding.MarshalJSON(r.jsonFields()...)
+}
+
+// PasswordChangeResponse is the server's response to a password change request, holding the RegistrationResponse
+// authenticated with the key of the login session the password change happens in, so that the client can trust the
+// server public key in it even if it's not the one of the login, e.g. after a rotation of the server's keys.
+type PasswordChangeResponse struct {
+	*RegistrationResponse
+	Mac []byte `json:"mac"`
+}
+
+// Serialize returns the byte encoding of PasswordChangeResponse.
+func (r *PasswordChangeResponse) Serialize() []byte {
+	return encoding.Concat(r.RegistrationResponse.Serialize(), r.Mac)
+}
+
+// MarshalJSON returns the JSON encoding of PasswordChangeResponse, with base64url encoded fields. It can be decoded
+// with opaque.Deserializer.PasswordChangeResponseJSON.
+func (r *PasswordChangeResponse) MarshalJSON() ([]byte, error) {
+	return encoding.MarshalJSON(
+		encoding.JSONField{Name: "evaluated_message", Value: r.C.SerializePoint(r.EvaluatedMessage)},
+		encoding.JSONField{Name: "server_public_key", Value: encoding.SerializePoint(r.Pks, r.G)},
+		encoding.JSONField{Name: "mac", Value: r.Mac},
+	)
+}
+
+// PasswordChangeRecord is the last message of a password change, holding the client's new record authenticated with
+// the key of the login session the password change happens in.
+type PasswordChangeRecord struct {
+	*RegistrationRecord
+	Mac []byte `json:"mac"`
+}
+
+// Serialize returns the byte encoding of PasswordChangeRecord.
+func (r *PasswordChangeRecord) Serialize() []byte {
+	return encoding.Concat(r.RegistrationRecord.Serialize(), r.Mac)
+}
+
+// MarshalJSON returns the JSON encoding of PasswordChangeRecord, with base64url encoded fields. It can be decoded
+// with opaque.Deserializer.PasswordChangeRecordJSON.
+func (r *PasswordChangeRecord) MarshalJSON() ([]byte, error) {
+	return encoding.MarshalJSON(append(
+		r.RegistrationRecord.jsonFields(),
+		encoding.JSONField{Name: "mac", Value: r.Mac},
+	)...)
+}
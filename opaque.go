@@ -13,6 +13,7 @@
 package opaque
 
 import (
+	"bytes"
 	"crypto"
 	"errors"
 	"fmt"
@@ -25,6 +26,7 @@ import (
 	"github.com/bytemare/opaque/internal/ake"
 	"github.com/bytemare/opaque/internal/encoding"
 	"github.com/bytemare/opaque/internal/oprf"
+	"github.com/bytemare/opaque/internal/tag"
 	"github.com/bytemare/opaque/message"
 )
 
@@ -47,23 +49,52 @@ const (
 	// P521Sha512 identifies the NIST P-512 group and SHA-512.
 	P521Sha512 = Group(oprf.P521Sha512)
 
-	// Curve25519Sha512 identifies a group over Curve25519 with SHA2-512 hash-to-group hashing.
-	// Curve25519Sha512 = Group(group.Curve25519Sha512).
+	// Curve25519Sha512 identifies a group over Curve25519 with SHA2-512 hash-to-group hashing. It is only available
+	// for the AKE in the TripleDH mode, with clamped secret keys as in X25519, and must be used with another OPRF
+	// group, e.g. RistrettoSha512.
+	Curve25519Sha512 = Group(group.Curve25519Sha512)
 
 	confLength = 6
+
+	// confExtensionVersion is the version of the configuration extension, which follows the context in the encoding.
+	confExtensionVersion byte = 1
+)
+
+// AKEMode identifies the authenticated key exchange protocol. All modes use the same key schedule, and the same
+// messages, to which SigmaI adds signatures.
+type AKEMode byte
+
+const (
+	// TripleDH identifies the 3DH AKE of the OPAQUE specification. It's the default, also used for a zero AKEMode.
+	TripleDH = AKEMode(ake.TripleDH)
+
+	// HMQV identifies the HMQV AKE, which needs fewer scalar multiplications than 3DH. It is not part of the OPAQUE
+	// specification, and is therefore not interoperable with other implementations.
+	HMQV = AKEMode(ake.HMQV)
+
+	// SigmaI identifies a SIGMA-I style AKE, in which both parties sign the transcript with ECDSA and their AKE key
+	// pairs, in addition to the MACs, so that the server's key can be held by a device that only signs. It is only
+	// available with the NIST AKE groups, and is not part of the OPAQUE specification. Ed25519 is not supported, as its
+	// keys are not elements of the Ristretto255 group records hold.
+	SigmaI = AKEMode(ake.SigmaI)
 )
 
 var (
+	// ErrModeGroup indicates that the AKE mode can't be used in the AKE group, e.g. HMQV or SIGMA-I in Curve25519.
+	ErrModeGroup = errors.New("AKE mode is not available in the AKE group")
+
 	errInvalidOPRFid = errors.New("invalid OPRF group id")
 	errInvalidKDFid  = errors.New("invalid KDF id")
 	errInvalidMACid  = errors.New("invalid MAC id")
 	errInvalidHASHid = errors.New("invalid Hash id")
 	errInvalidKSFid  = errors.New("invalid KSF id")
 	errInvalidAKEid  = errors.New("invalid AKE group id")
+	errInvalidMode   = errors.New("invalid AKE mode")
+	errConfExtension = errors.New("invalid configuration extension")
 )
 
-// Configuration represents an OPAQUE configuration. Note that OprfGroup and AKEGroup are recommended to be the same,
-// as well as KDF, MAC, Hash should be the same.
+// Configuration represents an OPAQUE configuration. The OPRF and AKE groups may differ, though KDF, MAC, and Hash are
+// recommended to be the same.
 type Configuration struct {
 	// OPRF identifies the ciphersuite to use for the OPRF.
 	OPRF Group `json:"oprf"`
@@ -81,9 +112,35 @@ type Configuration struct {
 	// defined in github.com/bytemare/crypto/ksf.
 	KSF ksf.Identifier `json:"ksf"`
 
+	// Scrypt optionally sets the parameters of the Scrypt KSF, which otherwise uses the defaults of the ksf package.
+	// Parameters must only be set for the KSF in use, and are part of the encoded configuration.
+	Scrypt *ScryptParameters `json:"scrypt,omitempty"`
+
+	// Argon2id optionally sets the parameters of the Argon2id KSF.
+	Argon2id *Argon2idParameters `json:"argon2id,omitempty"`
+
+	// PBKDF2 optionally sets the parameters of the PBKDF2 KSF.
+	PBKDF2 *PBKDF2Parameters `json:"pbkdf2,omitempty"`
+
+	// KeyStretcher optionally replaces the KSF with a custom key stretching function, in which case KSF must be 0.
+	// The encoded configuration only records that a custom function is used, so it must be set again on decoded
+	// configurations, which otherwise fail with ErrMissingKeyStretcher.
+	KeyStretcher KeyStretcher `json:"-"`
+
+	// CustomKSF marks configurations using a KeyStretcher, and is implied when it is set. It's set on decoded
+	// configurations encoded with one, so that they can't be used without it.
+	CustomKSF bool `json:"customKSF,omitempty"`
+
+	// KSFSalt is an optional per-deployment salt given to the KSF, and is part of the encoded configuration. Changing
+	// it, like changing the KSF, invalidates the existing registrations.
+	KSFSalt []byte `json:"ksfSalt,omitempty"`
+
 	// AKE identifies the group to use for the AKE.
 	AKE Group `json:"group"`
 
+	// Mode identifies the AKE protocol. The zero value selects TripleDH.
+	Mode AKEMode `json:"mode"`
+
 	// Context is optional shared information to include in the AKE transcript.
 	Context []byte
 }
@@ -97,6 +154,7 @@ func DefaultConfiguration() *Configuration {
 		Hash:    crypto.SHA512,
 		KSF:     ksf.Scrypt,
 		AKE:     RistrettoSha512,
+		Mode:    TripleDH,
 		Context: nil,
 	}
 }
@@ -116,6 +174,11 @@ func (c *Configuration) GenerateOPRFSeed() []byte {
 	return RandomBytes(c.Hash.Size())
 }
 
+// GenerateFakeRecordSeed returns a fake record seed valid in the given configuration.
+func (c *Configuration) GenerateFakeRecordSeed() []byte {
+	return RandomBytes(c.Hash.Size())
+}
+
 // KeyGen returns a key pair in the AKE group.
 func (c *Configuration) KeyGen() (secretKey, publicKey []byte) {
 	return ake.KeyGen(group.Group(c.AKE))
@@ -143,19 +206,49 @@ func (c *Configuration) verify() error {
 		return errInvalidKSFid
 	}
 
-	if !group.Group(c.AKE).Available() {
+	if _, err := c.ksfParameters(); err != nil {
+		return err
+	}
+
+	if c.usesKeyStretcher() && c.KSF != 0 {
+		return errKeyStretcherKSF
+	}
+
+	if _, ok := encoding.PointLength[group.Group(c.AKE)]; !ok || !group.Group(c.AKE).Available() {
 		return errInvalidAKEid
 	}
 
+	if !c.akeMode().Available() {
+		return errInvalidMode
+	}
+
+	if !c.akeMode().Supports(group.Group(c.AKE)) {
+		return ErrModeGroup
+	}
+
 	return nil
 }
 
+// akeMode returns the AKE identifier of the mode, defaulting to 3DH.
+func (c *Configuration) akeMode() ake.Identifier {
+	if c.Mode == 0 {
+		return ake.TripleDH
+	}
+
+	return ake.Identifier(c.Mode)
+}
+
 // toInternal builds the internal representation of the configuration parameters.
 func (c *Configuration) toInternal() (*internal.Configuration, error) {
 	if err := c.verify(); err != nil {
 		return nil, err
 	}
 
+	// Decoded configurations are valid without their KeyStretcher, but can't be used until it's set.
+	if c.CustomKSF && c.KeyStretcher == nil {
+		return nil, ErrMissingKeyStretcher
+	}
+
 	g := group.Group(c.AKE)
 	ip := &internal.Configuration{
 		OPRF:            oprf.Ciphersuite(c.OPRF),
@@ -163,14 +256,19 @@ func (c *Configuration) toInternal() (*internal.Configuration, error) {
 		KDF:             internal.NewKDF(c.KDF),
 		MAC:             internal.NewMac(c.MAC),
 		Hash:            internal.NewHash(c.Hash),
-		KSF:             internal.NewKSF(c.KSF),
+		KSF:             c.keyStretcher(),
 		NonceLen:        internal.NonceLength,
 		Group:           g,
 		AkePointLength:  encoding.PointLength[g],
 		Context:         c.Context,
+		KSFSalt:         c.KSFSalt,
 	}
 	ip.EnvelopeSize = ip.NonceLen + ip.MAC.Size()
 
+	if c.akeMode() == ake.SigmaI {
+		ip.SignatureLength = ake.SignatureLength(g)
+	}
+
 	return ip, nil
 }
 
@@ -182,21 +280,59 @@ func (c *Configuration) Deserializer() (*Deserializer, error) {
 		return nil, err
 	}
 
-	return &Deserializer{conf: conf}, nil
+	return &Deserializer{conf: conf, encodedConf: c.Serialize()}, nil
 }
 
-// Serialize returns the byte encoding of the Configuration structure.
+// Serialize returns the byte encoding of the Configuration structure. Configurations in the 3DH mode using the KSF's
+// defaults keep the original encoding of the identifiers and the context, so that their records and identifiers don't
+// change. Others append an extension after the context, holding its version, the AKE mode, and the parameters and
+// salt of the KSF. A KeyStretcher is marked by a reserved KSF identifier, but isn't itself encoded.
 func (c *Configuration) Serialize() []byte {
 	b := []byte{
 		byte(c.OPRF),
 		byte(c.KDF),
 		byte(c.MAC),
 		byte(c.Hash),
-		byte(c.KSF),
+		c.encodeKSFIdentifier(),
 		byte(c.AKE),
 	}
 
-	return encoding.Concat(b, encoding.EncodeVector(c.Context))
+	out := encoding.Concat(b, encoding.EncodeVector(c.Context))
+
+	return encoding.Concat(out, c.encodeExtension())
+}
+
+// encodeExtension returns the encoding of what the original configuration encoding can't express, or nil if there's
+// nothing to add.
+func (c *Configuration) encodeExtension() []byte {
+	ksfEncoding := c.encodeKSF()
+	if c.akeMode() == ake.TripleDH && ksfEncoding == nil {
+		return nil
+	}
+
+	return encoding.Concat([]byte{confExtensionVersion, byte(c.akeMode())}, ksfEncoding)
+}
+
+// decodeExtension sets the AKE mode, and the parameters and salt of the KSF, from the configuration extension.
+func (c *Configuration) decodeExtension(encoded []byte) error {
+	if len(encoded) < 2 || encoded[0] != confExtensionVersion {
+		return errConfExtension
+	}
+
+	c.Mode = AKEMode(encoded[1])
+
+	if len(encoded) > 2 {
+		if err := c.decodeKSF(encoded[2:]); err != nil {
+			return err
+		}
+	}
+
+	// A configuration has a single encoding, so that its identifier and the records bound to it are stable.
+	if !bytes.Equal(c.encodeExtension(), encoded) {
+		return errConfExtension
+	}
+
+	return nil
 }
 
 // GetFakeRecord creates a fake Client record to be used when no existing client record exists,
@@ -207,6 +343,57 @@ func (c *Configuration) GetFakeRecord(credentialIdentifier []byte) (*ClientRecor
 		return nil, err
 	}
 
+	return fakeRecord(i, credentialIdentifier), nil
+}
+
+// GetDeterministicFakeRecord creates a fake Client record to be used when no existing client record exists, deriving
+// its public key and masking key from the server's secret fake record seed and the credential identifier. Contrary to
+// GetFakeRecord, repeated logins for the same unknown credential identifier are thus answered with the same values,
+// as they would be for an existing client. The seed must be of hash output length, and must be kept as secret and
+// stable as the OPRF seed, from which it should be different.
+func (c *Configuration) GetDeterministicFakeRecord(
+	fakeRecordSeed, credentialIdentifier []byte,
+) (*ClientRecord, error) {
+	i, err := c.toInternal()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fakeRecordSeed) != i.Hash.Size() {
+		return nil, ErrInvalidFakeRecordSeedLength
+	}
+
+	return deterministicFakeRecord(i, fakeRecordSeed, credentialIdentifier), nil
+}
+
+func deterministicFakeRecord(i *internal.Configuration, fakeRecordSeed, credentialIdentifier []byte) *ClientRecord {
+	seed := i.KDF.Expand(
+		fakeRecordSeed,
+		encoding.SuffixString(credentialIdentifier, tag.FakePrivateKey),
+		internal.SeedLength,
+	)
+	sk := ake.DeriveKey(i.Group, seed, []byte(tag.DerivePrivateKey))
+	maskingKey := i.KDF.Expand(
+		fakeRecordSeed,
+		encoding.SuffixString(credentialIdentifier, tag.FakeMaskingKey),
+		i.KDF.Size(),
+	)
+
+	return &ClientRecord{
+		CredentialIdentifier: credentialIdentifier,
+		ClientIdentity:       nil,
+		RegistrationRecord: &message.RegistrationRecord{
+			G:          i.Group,
+			PublicKey:  i.Group.Base().Mult(sk),
+			MaskingKey: maskingKey,
+			Envelope:   make([]byte, internal.NonceLength+i.MAC.Size()),
+		},
+		TestMaskNonce: nil,
+		fake:          true,
+	}
+}
+
+func fakeRecord(i *internal.Configuration, credentialIdentifier []byte) *ClientRecord {
 	scalar := i.Group.NewScalar().Random()
 	publicKey := i.Group.Base().Mult(scalar)
 
@@ -222,7 +409,8 @@ func (c *Configuration) GetFakeRecord(credentialIdentifier []byte) (*ClientRecor
 		ClientIdentity:       nil,
 		RegistrationRecord:   regRecord,
 		TestMaskNonce:        nil,
-	}, nil
+		fake:                 true,
+	}
 }
 
 // DeserializeConfiguration decodes the input and returns a Parameter structure.
@@ -231,7 +419,7 @@ func DeserializeConfiguration(encoded []byte) (*Configuration, error) {
 		return nil, internal.ErrConfigurationInvalidLength
 	}
 
-	ctx, _, err := encoding.DecodeVector(encoded[confLength:])
+	ctx, offset, err := encoding.DecodeVector(encoded[confLength:])
 	if err != nil {
 		return nil, fmt.Errorf("decoding the configuration context: %w", err)
 	}
@@ -243,9 +431,20 @@ func DeserializeConfiguration(encoded []byte) (*Configuration, error) {
 		Hash:    crypto.Hash(encoded[3]),
 		KSF:     ksf.Identifier(encoded[4]),
 		AKE:     Group(encoded[5]),
+		Mode:    TripleDH,
 		Context: ctx,
 	}
 
+	if encoded[4] == customKSF {
+		c.KSF, c.CustomKSF = 0, true
+	}
+
+	if rest := encoded[confLength+offset:]; len(rest) != 0 {
+		if err := c.decodeExtension(rest); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := c.verify(); err != nil {
 		return nil, err
 	}
@@ -259,8 +458,14 @@ type ClientRecord struct {
 	ClientIdentity       []byte
 	*message.RegistrationRecord
 
+	// KeyVersion is the version of the server key material the record was registered under, in a ServerKeyring.
+	KeyVersion uint32
+
 	// testing
 	TestMaskNonce []byte
+
+	// fake is set on records created to defend against client enumeration.
+	fake bool
 }
 
 // RandomBytes returns random bytes of length len (wrapper for crypto/rand).
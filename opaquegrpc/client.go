@@ -0,0 +1,290 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaquegrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/bytemare/opaque"
+)
+
+var errClientConfig = errors.New("client configuration must have a connection and an OPAQUE client")
+
+// ClientConfig holds the parameters of a Client.
+type ClientConfig struct {
+	// Conn is the connection to the server, and must be set.
+	Conn grpc.ClientConnInterface
+
+	// Client runs the protocol, and must be set.
+	Client *opaque.Client
+
+	// ServerIdentity is the optional server identity, which must be the one the Server uses.
+	ServerIdentity []byte
+}
+
+// Client runs registrations, logins, and password changes against a Server. It is safe for concurrent use.
+type Client struct {
+	config  ClientConfig
+	service OpaqueClient
+}
+
+// Session holds the result of a successful login.
+type Session struct {
+	// SessionKey is the key shared with the server.
+	SessionKey []byte
+
+	// ExportKey is the client's export key, as in opaque.Client.LoginFinish.
+	ExportKey []byte
+
+	// State is the finished login state, e.g. for opaque.Client.Exporter.
+	State *opaque.ClientLoginState
+
+	// Data is the application data returned by the server's OnLogin, if any.
+	Data []byte
+
+	// ReRegister is whether the server asks the client to register again, because its record was registered under a
+	// key version that is being retired. The client does so with ChangePassword, possibly to the same password.
+	ReRegister bool
+}
+
+// NewClient returns a Client for the configuration.
+func NewClient(config *ClientConfig) (*Client, error) {
+	if config == nil || config.Conn == nil || config.Client == nil {
+		return nil, errClientConfig
+	}
+
+	return &Client{config: *config, service: NewOpaqueClient(config.Conn)}, nil
+}
+
+// callError maps the statuses matching ErrRecordExists, ErrRecordChanged, and ErrAuthentication to these errors, with
+// the server's message, and returns other errors as is.
+func callError(err error) error {
+	switch status.Code(err) {
+	case codes.AlreadyExists:
+		return fmt.Errorf("%w: %s", ErrRecordExists, status.Convert(err).Message())
+	case codes.Aborted:
+		return fmt.Errorf("%w: %s", ErrRecordChanged, status.Convert(err).Message())
+	case codes.Unauthenticated:
+		return fmt.Errorf("%w: %s", ErrAuthentication, status.Convert(err).Message())
+	default:
+		return err
+	}
+}
+
+// Configuration returns the server's configuration, e.g. to set up the opaque.Client.
+func (c *Client) Configuration(ctx context.Context) (*opaque.Configuration, error) {
+	response, err := c.service.GetConfiguration(ctx, &GetConfigurationRequest{})
+	if err != nil {
+		return nil, callError(err)
+	}
+
+	return opaque.DeserializeConfiguration(response.GetEncoded())
+}
+
+// Register registers the password for the credential identifier, and returns the export key. The client identity is
+// optional, and must be given again on login.
+func (c *Client) Register(ctx context.Context, credentialIdentifier, clientIdentity, password []byte) ([]byte, error) {
+	request, state := c.config.Client.RegistrationInit(password)
+
+	response, err := c.service.RegistrationStart(ctx, &RegistrationStartRequest{
+		CredentialIdentifier: credentialIdentifier,
+		Request:              newRegistrationRequest(request),
+	})
+	if err != nil {
+		return nil, callError(err)
+	}
+
+	decoded, err := decodeRegistrationResponse(c.config.Client.Deserialize, response)
+	if err != nil {
+		return nil, err
+	}
+
+	record, exportKey, err := c.config.Client.RegistrationFinalize(
+		decoded,
+		clientIdentity,
+		c.config.ServerIdentity,
+		state,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := c.service.RegistrationFinish(ctx, &RegistrationFinishRequest{
+		CredentialIdentifier: credentialIdentifier,
+		ClientIdentity:       clientIdentity,
+		Record:               newRegistrationRecord(record),
+	}); err != nil {
+		return nil, callError(err)
+	}
+
+	return exportKey, nil
+}
+
+// Login logs in with the password for the credential identifier. It fails with ErrAuthentication if the password is
+// wrong, the credential identifier unknown, or the server could not be authenticated.
+func (c *Client) Login(ctx context.Context, credentialIdentifier, clientIdentity, password []byte) (*Session, error) {
+	// Cancelling the context aborts the stream if the login fails before it ends.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, session, err := c.login(ctx, credentialIdentifier, clientIdentity, password)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = stream.CloseSend()
+
+	return session, nil
+}
+
+// ChangePassword logs in with the old password for the credential identifier, and changes it to newPassword in the
+// same login session. It returns the login's Session, and the new export key. It fails like Login, and with
+// ErrRecordChanged if the password has been changed in another session during the login. A client whose Session asks
+// to ReRegister does so by changing its password, possibly to the same one.
+func (c *Client) ChangePassword(
+	ctx context.Context,
+	credentialIdentifier, clientIdentity, oldPassword, newPassword []byte,
+) (*Session, []byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, session, err := c.login(ctx, credentialIdentifier, clientIdentity, oldPassword)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	request, state, err := c.config.Client.PasswordChangeInit(newPassword, session.State)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := stream.Send(&LoginRequest{Step: &LoginRequest_PasswordChange{
+		PasswordChange: newRegistrationRequest(request),
+	}}); err != nil {
+		return nil, nil, sendError(stream, err)
+	}
+
+	response, err := stream.Recv()
+	if err != nil {
+		return nil, nil, callError(err)
+	}
+
+	if response.GetPasswordChangeResponse() == nil {
+		return nil, nil, errLoginStep
+	}
+
+	decoded, err := decodePasswordChangeResponse(c.config.Client.Deserialize, response.GetPasswordChangeResponse())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	upload, exportKey, err := c.config.Client.PasswordChangeFinalize(
+		decoded,
+		clientIdentity,
+		c.config.ServerIdentity,
+		state,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := stream.Send(&LoginRequest{Step: &LoginRequest_PasswordChangeRecord{
+		PasswordChangeRecord: newPasswordChangeRecord(upload),
+	}}); err != nil {
+		return nil, nil, sendError(stream, err)
+	}
+
+	if response, err = stream.Recv(); err != nil {
+		return nil, nil, callError(err)
+	}
+
+	if response.GetPasswordChangeResult() == nil {
+		return nil, nil, errLoginStep
+	}
+
+	_ = stream.CloseSend()
+
+	return session, exportKey, nil
+}
+
+// login runs a login on a new stream, and returns the stream, for a password change, and the Session.
+func (c *Client) login(
+	ctx context.Context,
+	credentialIdentifier, clientIdentity, password []byte,
+) (Opaque_LoginClient, *Session, error) {
+	stream, err := c.service.Login(ctx)
+	if err != nil {
+		return nil, nil, callError(err)
+	}
+
+	ke1, state := c.config.Client.LoginInit(password)
+
+	if err := stream.Send(&LoginRequest{Step: &LoginRequest_Start{Start: &LoginStart{
+		CredentialIdentifier: credentialIdentifier,
+		Ke1:                  newKE1(ke1),
+	}}}); err != nil {
+		return nil, nil, sendError(stream, err)
+	}
+
+	response, err := stream.Recv()
+	if err != nil {
+		return nil, nil, callError(err)
+	}
+
+	if response.GetKe2() == nil {
+		return nil, nil, errLoginStep
+	}
+
+	ke2, err := decodeKE2(c.config.Client.Deserialize, response.GetKe2())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ke3, exportKey, err := c.config.Client.LoginFinish(clientIdentity, c.config.ServerIdentity, ke2, state)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrAuthentication, err)
+	}
+
+	if err := stream.Send(&LoginRequest{Step: &LoginRequest_Ke3{Ke3: newKE3(ke3)}}); err != nil {
+		return nil, nil, sendError(stream, err)
+	}
+
+	if response, err = stream.Recv(); err != nil {
+		return nil, nil, callError(err)
+	}
+
+	if response.GetResult() == nil {
+		return nil, nil, errLoginStep
+	}
+
+	return stream, &Session{
+		SessionKey: state.SessionKey(),
+		ExportKey:  exportKey,
+		State:      state,
+		Data:       response.GetResult().GetData(),
+		ReRegister: response.GetResult().GetReRegister(),
+	}, nil
+}
+
+// sendError returns the error of a failed send, which is io.EOF if the stream ended, in which case its status is
+// given by Recv.
+func sendError(stream Opaque_LoginClient, err error) error {
+	if errors.Is(err, io.EOF) {
+		_, err = stream.Recv()
+	}
+
+	return callError(err)
+}
@@ -0,0 +1,203 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaquegrpc
+
+import (
+	"bytes"
+	"errors"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/bytemare/opaque"
+	"github.com/bytemare/opaque/message"
+)
+
+// errMessageFields indicates that the fields of a message have the right total length, but not individually.
+var errMessageFields = errors.New("invalid message field length")
+
+// The protobuf messages are decoded by concatenating their fields into the binary encoding, which the Deserializer
+// parses and validates. The decoded message is converted back and must match, so that bytes can't be moved across
+// fields.
+
+func sameFields(in, decoded proto.Message) error {
+	if !proto.Equal(in, decoded) {
+		return errMessageFields
+	}
+
+	return nil
+}
+
+func concat(fields ...[]byte) []byte {
+	return bytes.Join(fields, nil)
+}
+
+// The public keys of the messages are taken from their binary encoding, between the fields around them, so that they
+// are encoded as by the opaque package.
+
+func newRegistrationRequest(m *message.RegistrationRequest) *RegistrationRequest {
+	return &RegistrationRequest{BlindedMessage: m.Serialize()}
+}
+
+func decodeRegistrationRequest(d *opaque.Deserializer, m *RegistrationRequest) (*message.RegistrationRequest, error) {
+	decoded, err := d.RegistrationRequest(m.GetBlindedMessage())
+	if err != nil {
+		return nil, err
+	}
+
+	return decoded, sameFields(m, newRegistrationRequest(decoded))
+}
+
+func newRegistrationResponse(m *message.RegistrationResponse) *RegistrationResponse {
+	evaluated := m.C.SerializePoint(m.EvaluatedMessage)
+
+	return &RegistrationResponse{
+		EvaluatedMessage: evaluated,
+		ServerPublicKey:  m.Serialize()[len(evaluated):],
+	}
+}
+
+func decodeRegistrationResponse(
+	d *opaque.Deserializer,
+	m *RegistrationResponse,
+) (*message.RegistrationResponse, error) {
+	decoded, err := d.RegistrationResponse(concat(m.GetEvaluatedMessage(), m.GetServerPublicKey()))
+	if err != nil {
+		return nil, err
+	}
+
+	return decoded, sameFields(m, newRegistrationResponse(decoded))
+}
+
+func newRegistrationRecord(m *message.RegistrationRecord) *RegistrationRecord {
+	encoded := m.Serialize()
+
+	return &RegistrationRecord{
+		ClientPublicKey: encoded[:len(encoded)-len(m.MaskingKey)-len(m.Envelope)],
+		MaskingKey:      m.MaskingKey,
+		Envelope:        m.Envelope,
+	}
+}
+
+func decodeRegistrationRecord(d *opaque.Deserializer, m *RegistrationRecord) (*message.RegistrationRecord, error) {
+	decoded, err := d.RegistrationRecord(concat(m.GetClientPublicKey(), m.GetMaskingKey(), m.GetEnvelope()))
+	if err != nil {
+		return nil, err
+	}
+
+	return decoded, sameFields(m, newRegistrationRecord(decoded))
+}
+
+func newPasswordChangeResponse(m *message.PasswordChangeResponse) *PasswordChangeResponse {
+	return &PasswordChangeResponse{Response: newRegistrationResponse(m.RegistrationResponse), Mac: m.Mac}
+}
+
+func decodePasswordChangeResponse(
+	d *opaque.Deserializer,
+	m *PasswordChangeResponse,
+) (*message.PasswordChangeResponse, error) {
+	response := m.GetResponse()
+
+	decoded, err := d.PasswordChangeResponse(concat(
+		response.GetEvaluatedMessage(),
+		response.GetServerPublicKey(),
+		m.GetMac(),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	return decoded, sameFields(m, newPasswordChangeResponse(decoded))
+}
+
+func newPasswordChangeRecord(m *message.PasswordChangeRecord) *PasswordChangeRecord {
+	return &PasswordChangeRecord{Record: newRegistrationRecord(m.RegistrationRecord), Mac: m.Mac}
+}
+
+func decodePasswordChangeRecord(
+	d *opaque.Deserializer,
+	m *PasswordChangeRecord,
+) (*message.PasswordChangeRecord, error) {
+	record := m.GetRecord()
+
+	decoded, err := d.PasswordChangeRecord(concat(
+		record.GetClientPublicKey(),
+		record.GetMaskingKey(),
+		record.GetEnvelope(),
+		m.GetMac(),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	return decoded, sameFields(m, newPasswordChangeRecord(decoded))
+}
+
+func newKE1(m *message.KE1) *KE1 {
+	blinded := m.CredentialRequest.Serialize()
+
+	return &KE1{
+		BlindedMessage: blinded,
+		ClientNonce:    m.NonceU,
+		ClientKeyShare: m.Serialize()[len(blinded)+len(m.NonceU):],
+	}
+}
+
+func decodeKE1(d *opaque.Deserializer, m *KE1) (*message.KE1, error) {
+	decoded, err := d.KE1(concat(m.GetBlindedMessage(), m.GetClientNonce(), m.GetClientKeyShare()))
+	if err != nil {
+		return nil, err
+	}
+
+	return decoded, sameFields(m, newKE1(decoded))
+}
+
+func newKE2(m *message.KE2) *KE2 {
+	encoded := m.Serialize()
+	keyShare := len(m.CredentialResponse.Serialize()) + len(m.NonceS)
+
+	return &KE2{
+		EvaluatedMessage: m.C.SerializePoint(m.EvaluatedMessage),
+		MaskingNonce:     m.MaskingNonce,
+		MaskedResponse:   m.MaskedResponse,
+		ServerNonce:      m.NonceS,
+		ServerKeyShare:   encoded[keyShare : len(encoded)-len(m.Signature)-len(m.Mac)],
+		ServerSignature:  m.Signature,
+		ServerMac:        m.Mac,
+	}
+}
+
+func decodeKE2(d *opaque.Deserializer, m *KE2) (*message.KE2, error) {
+	decoded, err := d.KE2(concat(
+		m.GetEvaluatedMessage(),
+		m.GetMaskingNonce(),
+		m.GetMaskedResponse(),
+		m.GetServerNonce(),
+		m.GetServerKeyShare(),
+		m.GetServerSignature(),
+		m.GetServerMac(),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	return decoded, sameFields(m, newKE2(decoded))
+}
+
+func newKE3(m *message.KE3) *KE3 {
+	return &KE3{ClientSignature: m.Signature, ClientMac: m.Mac}
+}
+
+func decodeKE3(d *opaque.Deserializer, m *KE3) (*message.KE3, error) {
+	decoded, err := d.KE3(concat(m.GetClientSignature(), m.GetClientMac()))
+	if err != nil {
+		return nil, err
+	}
+
+	return decoded, sameFields(m, newKE3(decoded))
+}
@@ -0,0 +1,24 @@
+module github.com/bytemare/opaque/opaquegrpc
+
+go 1.18
+
+require (
+	github.com/bytemare/opaque v0.0.0-00010101000000-000000000000
+	google.golang.org/grpc v1.64.0
+	google.golang.org/protobuf v1.33.0
+)
+
+require (
+	filippo.io/edwards25519 v1.0.0-rc.1 // indirect
+	github.com/armfazh/h2c-go-ref v0.0.0-20220222212046-ff45165972af // indirect
+	github.com/armfazh/tozan-ecc v0.1.4 // indirect
+	github.com/bytemare/crypto v0.2.7 // indirect
+	github.com/gtank/ristretto255 v0.1.2 // indirect
+	golang.org/x/crypto v0.21.0 // indirect
+	golang.org/x/net v0.22.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+)
+
+replace github.com/bytemare/opaque => ../
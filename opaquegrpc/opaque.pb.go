@@ -0,0 +1,1618 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.33.0
+// 	protoc        (unknown)
+// source: opaque.proto
+
+package opaquegrpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Configuration holds an encoded OPAQUE configuration, as returned by Configuration.Serialize.
+type Configuration struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Encoded []byte `protobuf:"bytes,1,opt,name=encoded,proto3" json:"encoded,omitempty"`
+}
+
+func (x *Configuration) Reset() {
+	*x = Configuration{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_opaque_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Configuration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Configuration) ProtoMessage() {}
+
+func (x *Configuration) ProtoReflect() protoreflect.Message {
+	mi := &file_opaque_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Configuration.ProtoReflect.Descriptor instead.
+func (*Configuration) Descriptor() ([]byte, []int) {
+	return file_opaque_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Configuration) GetEncoded() []byte {
+	if x != nil {
+		return x.Encoded
+	}
+	return nil
+}
+
+type GetConfigurationRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *GetConfigurationRequest) Reset() {
+	*x = GetConfigurationRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_opaque_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetConfigurationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetConfigurationRequest) ProtoMessage() {}
+
+func (x *GetConfigurationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_opaque_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetConfigurationRequest.ProtoReflect.Descriptor instead.
+func (*GetConfigurationRequest) Descriptor() ([]byte, []int) {
+	return file_opaque_proto_rawDescGZIP(), []int{1}
+}
+
+type RegistrationRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	BlindedMessage []byte `protobuf:"bytes,1,opt,name=blinded_message,json=blindedMessage,proto3" json:"blinded_message,omitempty"`
+}
+
+func (x *RegistrationRequest) Reset() {
+	*x = RegistrationRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_opaque_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RegistrationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegistrationRequest) ProtoMessage() {}
+
+func (x *RegistrationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_opaque_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegistrationRequest.ProtoReflect.Descriptor instead.
+func (*RegistrationRequest) Descriptor() ([]byte, []int) {
+	return file_opaque_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *RegistrationRequest) GetBlindedMessage() []byte {
+	if x != nil {
+		return x.BlindedMessage
+	}
+	return nil
+}
+
+type RegistrationResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	EvaluatedMessage []byte `protobuf:"bytes,1,opt,name=evaluated_message,json=evaluatedMessage,proto3" json:"evaluated_message,omitempty"`
+	ServerPublicKey  []byte `protobuf:"bytes,2,opt,name=server_public_key,json=serverPublicKey,proto3" json:"server_public_key,omitempty"`
+}
+
+func (x *RegistrationResponse) Reset() {
+	*x = RegistrationResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_opaque_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RegistrationResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegistrationResponse) ProtoMessage() {}
+
+func (x *RegistrationResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_opaque_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegistrationResponse.ProtoReflect.Descriptor instead.
+func (*RegistrationResponse) Descriptor() ([]byte, []int) {
+	return file_opaque_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *RegistrationResponse) GetEvaluatedMessage() []byte {
+	if x != nil {
+		return x.EvaluatedMessage
+	}
+	return nil
+}
+
+func (x *RegistrationResponse) GetServerPublicKey() []byte {
+	if x != nil {
+		return x.ServerPublicKey
+	}
+	return nil
+}
+
+type RegistrationRecord struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ClientPublicKey []byte `protobuf:"bytes,1,opt,name=client_public_key,json=clientPublicKey,proto3" json:"client_public_key,omitempty"`
+	MaskingKey      []byte `protobuf:"bytes,2,opt,name=masking_key,json=maskingKey,proto3" json:"masking_key,omitempty"`
+	Envelope        []byte `protobuf:"bytes,3,opt,name=envelope,proto3" json:"envelope,omitempty"`
+}
+
+func (x *RegistrationRecord) Reset() {
+	*x = RegistrationRecord{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_opaque_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RegistrationRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegistrationRecord) ProtoMessage() {}
+
+func (x *RegistrationRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_opaque_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegistrationRecord.ProtoReflect.Descriptor instead.
+func (*RegistrationRecord) Descriptor() ([]byte, []int) {
+	return file_opaque_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *RegistrationRecord) GetClientPublicKey() []byte {
+	if x != nil {
+		return x.ClientPublicKey
+	}
+	return nil
+}
+
+func (x *RegistrationRecord) GetMaskingKey() []byte {
+	if x != nil {
+		return x.MaskingKey
+	}
+	return nil
+}
+
+func (x *RegistrationRecord) GetEnvelope() []byte {
+	if x != nil {
+		return x.Envelope
+	}
+	return nil
+}
+
+type KE1 struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	BlindedMessage []byte `protobuf:"bytes,1,opt,name=blinded_message,json=blindedMessage,proto3" json:"blinded_message,omitempty"`
+	ClientNonce    []byte `protobuf:"bytes,2,opt,name=client_nonce,json=clientNonce,proto3" json:"client_nonce,omitempty"`
+	ClientKeyShare []byte `protobuf:"bytes,3,opt,name=client_key_share,json=clientKeyShare,proto3" json:"client_key_share,omitempty"`
+}
+
+func (x *KE1) Reset() {
+	*x = KE1{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_opaque_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *KE1) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KE1) ProtoMessage() {}
+
+func (x *KE1) ProtoReflect() protoreflect.Message {
+	mi := &file_opaque_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KE1.ProtoReflect.Descriptor instead.
+func (*KE1) Descriptor() ([]byte, []int) {
+	return file_opaque_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *KE1) GetBlindedMessage() []byte {
+	if x != nil {
+		return x.BlindedMessage
+	}
+	return nil
+}
+
+func (x *KE1) GetClientNonce() []byte {
+	if x != nil {
+		return x.ClientNonce
+	}
+	return nil
+}
+
+func (x *KE1) GetClientKeyShare() []byte {
+	if x != nil {
+		return x.ClientKeyShare
+	}
+	return nil
+}
+
+type KE2 struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	EvaluatedMessage []byte `protobuf:"bytes,1,opt,name=evaluated_message,json=evaluatedMessage,proto3" json:"evaluated_message,omitempty"`
+	MaskingNonce     []byte `protobuf:"bytes,2,opt,name=masking_nonce,json=maskingNonce,proto3" json:"masking_nonce,omitempty"`
+	MaskedResponse   []byte `protobuf:"bytes,3,opt,name=masked_response,json=maskedResponse,proto3" json:"masked_response,omitempty"`
+	ServerNonce      []byte `protobuf:"bytes,4,opt,name=server_nonce,json=serverNonce,proto3" json:"server_nonce,omitempty"`
+	ServerKeyShare   []byte `protobuf:"bytes,5,opt,name=server_key_share,json=serverKeyShare,proto3" json:"server_key_share,omitempty"`
+	// server_signature is only set in the SIGMA-I mode.
+	ServerSignature []byte `protobuf:"bytes,6,opt,name=server_signature,json=serverSignature,proto3" json:"server_signature,omitempty"`
+	ServerMac       []byte `protobuf:"bytes,7,opt,name=server_mac,json=serverMac,proto3" json:"server_mac,omitempty"`
+}
+
+func (x *KE2) Reset() {
+	*x = KE2{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_opaque_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *KE2) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KE2) ProtoMessage() {}
+
+func (x *KE2) ProtoReflect() protoreflect.Message {
+	mi := &file_opaque_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KE2.ProtoReflect.Descriptor instead.
+func (*KE2) Descriptor() ([]byte, []int) {
+	return file_opaque_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *KE2) GetEvaluatedMessage() []byte {
+	if x != nil {
+		return x.EvaluatedMessage
+	}
+	return nil
+}
+
+func (x *KE2) GetMaskingNonce() []byte {
+	if x != nil {
+		return x.MaskingNonce
+	}
+	return nil
+}
+
+func (x *KE2) GetMaskedResponse() []byte {
+	if x != nil {
+		return x.MaskedResponse
+	}
+	return nil
+}
+
+func (x *KE2) GetServerNonce() []byte {
+	if x != nil {
+		return x.ServerNonce
+	}
+	return nil
+}
+
+func (x *KE2) GetServerKeyShare() []byte {
+	if x != nil {
+		return x.ServerKeyShare
+	}
+	return nil
+}
+
+func (x *KE2) GetServerSignature() []byte {
+	if x != nil {
+		return x.ServerSignature
+	}
+	return nil
+}
+
+func (x *KE2) GetServerMac() []byte {
+	if x != nil {
+		return x.ServerMac
+	}
+	return nil
+}
+
+type KE3 struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// client_signature is only set in the SIGMA-I mode.
+	ClientSignature []byte `protobuf:"bytes,1,opt,name=client_signature,json=clientSignature,proto3" json:"client_signature,omitempty"`
+	ClientMac       []byte `protobuf:"bytes,2,opt,name=client_mac,json=clientMac,proto3" json:"client_mac,omitempty"`
+}
+
+func (x *KE3) Reset() {
+	*x = KE3{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_opaque_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *KE3) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KE3) ProtoMessage() {}
+
+func (x *KE3) ProtoReflect() protoreflect.Message {
+	mi := &file_opaque_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KE3.ProtoReflect.Descriptor instead.
+func (*KE3) Descriptor() ([]byte, []int) {
+	return file_opaque_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *KE3) GetClientSignature() []byte {
+	if x != nil {
+		return x.ClientSignature
+	}
+	return nil
+}
+
+func (x *KE3) GetClientMac() []byte {
+	if x != nil {
+		return x.ClientMac
+	}
+	return nil
+}
+
+type RegistrationStartRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	CredentialIdentifier []byte               `protobuf:"bytes,1,opt,name=credential_identifier,json=credentialIdentifier,proto3" json:"credential_identifier,omitempty"`
+	Request              *RegistrationRequest `protobuf:"bytes,2,opt,name=request,proto3" json:"request,omitempty"`
+}
+
+func (x *RegistrationStartRequest) Reset() {
+	*x = RegistrationStartRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_opaque_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RegistrationStartRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegistrationStartRequest) ProtoMessage() {}
+
+func (x *RegistrationStartRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_opaque_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegistrationStartRequest.ProtoReflect.Descriptor instead.
+func (*RegistrationStartRequest) Descriptor() ([]byte, []int) {
+	return file_opaque_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *RegistrationStartRequest) GetCredentialIdentifier() []byte {
+	if x != nil {
+		return x.CredentialIdentifier
+	}
+	return nil
+}
+
+func (x *RegistrationStartRequest) GetRequest() *RegistrationRequest {
+	if x != nil {
+		return x.Request
+	}
+	return nil
+}
+
+type RegistrationFinishRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	CredentialIdentifier []byte `protobuf:"bytes,1,opt,name=credential_identifier,json=credentialIdentifier,proto3" json:"credential_identifier,omitempty"`
+	// client_identity is optional, and must be given again on login.
+	ClientIdentity []byte              `protobuf:"bytes,2,opt,name=client_identity,json=clientIdentity,proto3" json:"client_identity,omitempty"`
+	Record         *RegistrationRecord `protobuf:"bytes,3,opt,name=record,proto3" json:"record,omitempty"`
+}
+
+func (x *RegistrationFinishRequest) Reset() {
+	*x = RegistrationFinishRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_opaque_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RegistrationFinishRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegistrationFinishRequest) ProtoMessage() {}
+
+func (x *RegistrationFinishRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_opaque_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegistrationFinishRequest.ProtoReflect.Descriptor instead.
+func (*RegistrationFinishRequest) Descriptor() ([]byte, []int) {
+	return file_opaque_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *RegistrationFinishRequest) GetCredentialIdentifier() []byte {
+	if x != nil {
+		return x.CredentialIdentifier
+	}
+	return nil
+}
+
+func (x *RegistrationFinishRequest) GetClientIdentity() []byte {
+	if x != nil {
+		return x.ClientIdentity
+	}
+	return nil
+}
+
+func (x *RegistrationFinishRequest) GetRecord() *RegistrationRecord {
+	if x != nil {
+		return x.Record
+	}
+	return nil
+}
+
+type RegistrationFinishResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *RegistrationFinishResponse) Reset() {
+	*x = RegistrationFinishResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_opaque_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RegistrationFinishResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegistrationFinishResponse) ProtoMessage() {}
+
+func (x *RegistrationFinishResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_opaque_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegistrationFinishResponse.ProtoReflect.Descriptor instead.
+func (*RegistrationFinishResponse) Descriptor() ([]byte, []int) {
+	return file_opaque_proto_rawDescGZIP(), []int{10}
+}
+
+type LoginStart struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	CredentialIdentifier []byte `protobuf:"bytes,1,opt,name=credential_identifier,json=credentialIdentifier,proto3" json:"credential_identifier,omitempty"`
+	Ke1                  *KE1   `protobuf:"bytes,2,opt,name=ke1,proto3" json:"ke1,omitempty"`
+}
+
+func (x *LoginStart) Reset() {
+	*x = LoginStart{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_opaque_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *LoginStart) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LoginStart) ProtoMessage() {}
+
+func (x *LoginStart) ProtoReflect() protoreflect.Message {
+	mi := &file_opaque_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LoginStart.ProtoReflect.Descriptor instead.
+func (*LoginStart) Descriptor() ([]byte, []int) {
+	return file_opaque_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *LoginStart) GetCredentialIdentifier() []byte {
+	if x != nil {
+		return x.CredentialIdentifier
+	}
+	return nil
+}
+
+func (x *LoginStart) GetKe1() *KE1 {
+	if x != nil {
+		return x.Ke1
+	}
+	return nil
+}
+
+// LoginResult ends a successful login.
+type LoginResult struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// data is optional application data, e.g. a token, set by the server's login hook.
+	Data []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	// re_register is set if the client's record was registered under a server key version that is being retired. The
+	// client registers again by changing its password, possibly to the same one.
+	ReRegister bool `protobuf:"varint,2,opt,name=re_register,json=reRegister,proto3" json:"re_register,omitempty"`
+}
+
+func (x *LoginResult) Reset() {
+	*x = LoginResult{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_opaque_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *LoginResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LoginResult) ProtoMessage() {}
+
+func (x *LoginResult) ProtoReflect() protoreflect.Message {
+	mi := &file_opaque_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LoginResult.ProtoReflect.Descriptor instead.
+func (*LoginResult) Descriptor() ([]byte, []int) {
+	return file_opaque_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *LoginResult) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *LoginResult) GetReRegister() bool {
+	if x != nil {
+		return x.ReRegister
+	}
+	return false
+}
+
+// PasswordChangeResponse is a RegistrationResponse authenticated with the login session's key.
+type PasswordChangeResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Response *RegistrationResponse `protobuf:"bytes,1,opt,name=response,proto3" json:"response,omitempty"`
+	Mac      []byte                `protobuf:"bytes,2,opt,name=mac,proto3" json:"mac,omitempty"`
+}
+
+func (x *PasswordChangeResponse) Reset() {
+	*x = PasswordChangeResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_opaque_proto_msgTypes[13]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PasswordChangeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PasswordChangeResponse) ProtoMessage() {}
+
+func (x *PasswordChangeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_opaque_proto_msgTypes[13]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PasswordChangeResponse.ProtoReflect.Descriptor instead.
+func (*PasswordChangeResponse) Descriptor() ([]byte, []int) {
+	return file_opaque_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *PasswordChangeResponse) GetResponse() *RegistrationResponse {
+	if x != nil {
+		return x.Response
+	}
+	return nil
+}
+
+func (x *PasswordChangeResponse) GetMac() []byte {
+	if x != nil {
+		return x.Mac
+	}
+	return nil
+}
+
+// PasswordChangeRecord is a RegistrationRecord authenticated with the login session's key.
+type PasswordChangeRecord struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Record *RegistrationRecord `protobuf:"bytes,1,opt,name=record,proto3" json:"record,omitempty"`
+	Mac    []byte              `protobuf:"bytes,2,opt,name=mac,proto3" json:"mac,omitempty"`
+}
+
+func (x *PasswordChangeRecord) Reset() {
+	*x = PasswordChangeRecord{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_opaque_proto_msgTypes[14]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PasswordChangeRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PasswordChangeRecord) ProtoMessage() {}
+
+func (x *PasswordChangeRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_opaque_proto_msgTypes[14]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PasswordChangeRecord.ProtoReflect.Descriptor instead.
+func (*PasswordChangeRecord) Descriptor() ([]byte, []int) {
+	return file_opaque_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *PasswordChangeRecord) GetRecord() *RegistrationRecord {
+	if x != nil {
+		return x.Record
+	}
+	return nil
+}
+
+func (x *PasswordChangeRecord) GetMac() []byte {
+	if x != nil {
+		return x.Mac
+	}
+	return nil
+}
+
+// PasswordChangeResult ends a successful password change.
+type PasswordChangeResult struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *PasswordChangeResult) Reset() {
+	*x = PasswordChangeResult{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_opaque_proto_msgTypes[15]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PasswordChangeResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PasswordChangeResult) ProtoMessage() {}
+
+func (x *PasswordChangeResult) ProtoReflect() protoreflect.Message {
+	mi := &file_opaque_proto_msgTypes[15]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PasswordChangeResult.ProtoReflect.Descriptor instead.
+func (*PasswordChangeResult) Descriptor() ([]byte, []int) {
+	return file_opaque_proto_rawDescGZIP(), []int{15}
+}
+
+type LoginRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Step:
+	//	*LoginRequest_Start
+	//	*LoginRequest_Ke3
+	//	*LoginRequest_PasswordChange
+	//	*LoginRequest_PasswordChangeRecord
+	Step isLoginRequest_Step `protobuf_oneof:"step"`
+}
+
+func (x *LoginRequest) Reset() {
+	*x = LoginRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_opaque_proto_msgTypes[16]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *LoginRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LoginRequest) ProtoMessage() {}
+
+func (x *LoginRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_opaque_proto_msgTypes[16]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LoginRequest.ProtoReflect.Descriptor instead.
+func (*LoginRequest) Descriptor() ([]byte, []int) {
+	return file_opaque_proto_rawDescGZIP(), []int{16}
+}
+
+func (m *LoginRequest) GetStep() isLoginRequest_Step {
+	if m != nil {
+		return m.Step
+	}
+	return nil
+}
+
+func (x *LoginRequest) GetStart() *LoginStart {
+	if x, ok := x.GetStep().(*LoginRequest_Start); ok {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *LoginRequest) GetKe3() *KE3 {
+	if x, ok := x.GetStep().(*LoginRequest_Ke3); ok {
+		return x.Ke3
+	}
+	return nil
+}
+
+func (x *LoginRequest) GetPasswordChange() *RegistrationRequest {
+	if x, ok := x.GetStep().(*LoginRequest_PasswordChange); ok {
+		return x.PasswordChange
+	}
+	return nil
+}
+
+func (x *LoginRequest) GetPasswordChangeRecord() *PasswordChangeRecord {
+	if x, ok := x.GetStep().(*LoginRequest_PasswordChangeRecord); ok {
+		return x.PasswordChangeRecord
+	}
+	return nil
+}
+
+type isLoginRequest_Step interface {
+	isLoginRequest_Step()
+}
+
+type LoginRequest_Start struct {
+	Start *LoginStart `protobuf:"bytes,1,opt,name=start,proto3,oneof"`
+}
+
+type LoginRequest_Ke3 struct {
+	Ke3 *KE3 `protobuf:"bytes,2,opt,name=ke3,proto3,oneof"`
+}
+
+type LoginRequest_PasswordChange struct {
+	PasswordChange *RegistrationRequest `protobuf:"bytes,3,opt,name=password_change,json=passwordChange,proto3,oneof"`
+}
+
+type LoginRequest_PasswordChangeRecord struct {
+	PasswordChangeRecord *PasswordChangeRecord `protobuf:"bytes,4,opt,name=password_change_record,json=passwordChangeRecord,proto3,oneof"`
+}
+
+func (*LoginRequest_Start) isLoginRequest_Step() {}
+
+func (*LoginRequest_Ke3) isLoginRequest_Step() {}
+
+func (*LoginRequest_PasswordChange) isLoginRequest_Step() {}
+
+func (*LoginRequest_PasswordChangeRecord) isLoginRequest_Step() {}
+
+type LoginResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Step:
+	//	*LoginResponse_Ke2
+	//	*LoginResponse_Result
+	//	*LoginResponse_PasswordChangeResponse
+	//	*LoginResponse_PasswordChangeResult
+	Step isLoginResponse_Step `protobuf_oneof:"step"`
+}
+
+func (x *LoginResponse) Reset() {
+	*x = LoginResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_opaque_proto_msgTypes[17]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *LoginResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LoginResponse) ProtoMessage() {}
+
+func (x *LoginResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_opaque_proto_msgTypes[17]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LoginResponse.ProtoReflect.Descriptor instead.
+func (*LoginResponse) Descriptor() ([]byte, []int) {
+	return file_opaque_proto_rawDescGZIP(), []int{17}
+}
+
+func (m *LoginResponse) GetStep() isLoginResponse_Step {
+	if m != nil {
+		return m.Step
+	}
+	return nil
+}
+
+func (x *LoginResponse) GetKe2() *KE2 {
+	if x, ok := x.GetStep().(*LoginResponse_Ke2); ok {
+		return x.Ke2
+	}
+	return nil
+}
+
+func (x *LoginResponse) GetResult() *LoginResult {
+	if x, ok := x.GetStep().(*LoginResponse_Result); ok {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *LoginResponse) GetPasswordChangeResponse() *PasswordChangeResponse {
+	if x, ok := x.GetStep().(*LoginResponse_PasswordChangeResponse); ok {
+		return x.PasswordChangeResponse
+	}
+	return nil
+}
+
+func (x *LoginResponse) GetPasswordChangeResult() *PasswordChangeResult {
+	if x, ok := x.GetStep().(*LoginResponse_PasswordChangeResult); ok {
+		return x.PasswordChangeResult
+	}
+	return nil
+}
+
+type isLoginResponse_Step interface {
+	isLoginResponse_Step()
+}
+
+type LoginResponse_Ke2 struct {
+	Ke2 *KE2 `protobuf:"bytes,1,opt,name=ke2,proto3,oneof"`
+}
+
+type LoginResponse_Result struct {
+	Result *LoginResult `protobuf:"bytes,2,opt,name=result,proto3,oneof"`
+}
+
+type LoginResponse_PasswordChangeResponse struct {
+	PasswordChangeResponse *PasswordChangeResponse `protobuf:"bytes,3,opt,name=password_change_response,json=passwordChangeResponse,proto3,oneof"`
+}
+
+type LoginResponse_PasswordChangeResult struct {
+	PasswordChangeResult *PasswordChangeResult `protobuf:"bytes,4,opt,name=password_change_result,json=passwordChangeResult,proto3,oneof"`
+}
+
+func (*LoginResponse_Ke2) isLoginResponse_Step() {}
+
+func (*LoginResponse_Result) isLoginResponse_Step() {}
+
+func (*LoginResponse_PasswordChangeResponse) isLoginResponse_Step() {}
+
+func (*LoginResponse_PasswordChangeResult) isLoginResponse_Step() {}
+
+var File_opaque_proto protoreflect.FileDescriptor
+
+var file_opaque_proto_rawDesc = []byte{
+	0x0a, 0x0c, 0x6f, 0x70, 0x61, 0x71, 0x75, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x09,
+	0x6f, 0x70, 0x61, 0x71, 0x75, 0x65, 0x2e, 0x76, 0x31, 0x22, 0x29, 0x0a, 0x0d, 0x43, 0x6f, 0x6e,
+	0x66, 0x69, 0x67, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x18, 0x0a, 0x07, 0x65, 0x6e,
+	0x63, 0x6f, 0x64, 0x65, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x65, 0x6e, 0x63,
+	0x6f, 0x64, 0x65, 0x64, 0x22, 0x19, 0x0a, 0x17, 0x47, 0x65, 0x74, 0x43, 0x6f, 0x6e, 0x66, 0x69,
+	0x67, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22,
+	0x3e, 0x0a, 0x13, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x27, 0x0a, 0x0f, 0x62, 0x6c, 0x69, 0x6e, 0x64, 0x65,
+	0x64, 0x5f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52,
+	0x0e, 0x62, 0x6c, 0x69, 0x6e, 0x64, 0x65, 0x64, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x22,
+	0x6f, 0x0a, 0x14, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x2b, 0x0a, 0x11, 0x65, 0x76, 0x61, 0x6c, 0x75,
+	0x61, 0x74, 0x65, 0x64, 0x5f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0c, 0x52, 0x10, 0x65, 0x76, 0x61, 0x6c, 0x75, 0x61, 0x74, 0x65, 0x64, 0x4d, 0x65, 0x73,
+	0x73, 0x61, 0x67, 0x65, 0x12, 0x2a, 0x0a, 0x11, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x5f, 0x70,
+	0x75, 0x62, 0x6c, 0x69, 0x63, 0x5f, 0x6b, 0x65, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52,
+	0x0f, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x50, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x4b, 0x65, 0x79,
+	0x22, 0x7d, 0x0a, 0x12, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x12, 0x2a, 0x0a, 0x11, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74,
+	0x5f, 0x70, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x5f, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x0f, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x50, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x4b,
+	0x65, 0x79, 0x12, 0x1f, 0x0a, 0x0b, 0x6d, 0x61, 0x73, 0x6b, 0x69, 0x6e, 0x67, 0x5f, 0x6b, 0x65,
+	0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0a, 0x6d, 0x61, 0x73, 0x6b, 0x69, 0x6e, 0x67,
+	0x4b, 0x65, 0x79, 0x12, 0x1a, 0x0a, 0x08, 0x65, 0x6e, 0x76, 0x65, 0x6c, 0x6f, 0x70, 0x65, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x65, 0x6e, 0x76, 0x65, 0x6c, 0x6f, 0x70, 0x65, 0x22,
+	0x7b, 0x0a, 0x03, 0x4b, 0x45, 0x31, 0x12, 0x27, 0x0a, 0x0f, 0x62, 0x6c, 0x69, 0x6e, 0x64, 0x65,
+	0x64, 0x5f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52,
+	0x0e, 0x62, 0x6c, 0x69, 0x6e, 0x64, 0x65, 0x64, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12,
+	0x21, 0x0a, 0x0c, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x5f, 0x6e, 0x6f, 0x6e, 0x63, 0x65, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0b, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x4e, 0x6f, 0x6e,
+	0x63, 0x65, 0x12, 0x28, 0x0a, 0x10, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x5f, 0x6b, 0x65, 0x79,
+	0x5f, 0x73, 0x68, 0x61, 0x72, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0e, 0x63, 0x6c,
+	0x69, 0x65, 0x6e, 0x74, 0x4b, 0x65, 0x79, 0x53, 0x68, 0x61, 0x72, 0x65, 0x22, 0x97, 0x02, 0x0a,
+	0x03, 0x4b, 0x45, 0x32, 0x12, 0x2b, 0x0a, 0x11, 0x65, 0x76, 0x61, 0x6c, 0x75, 0x61, 0x74, 0x65,
+	0x64, 0x5f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52,
+	0x10, 0x65, 0x76, 0x61, 0x6c, 0x75, 0x61, 0x74, 0x65, 0x64, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x12, 0x23, 0x0a, 0x0d, 0x6d, 0x61, 0x73, 0x6b, 0x69, 0x6e, 0x67, 0x5f, 0x6e, 0x6f, 0x6e,
+	0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0c, 0x6d, 0x61, 0x73, 0x6b, 0x69, 0x6e,
+	0x67, 0x4e, 0x6f, 0x6e, 0x63, 0x65, 0x12, 0x27, 0x0a, 0x0f, 0x6d, 0x61, 0x73, 0x6b, 0x65, 0x64,
+	0x5f, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52,
+	0x0e, 0x6d, 0x61, 0x73, 0x6b, 0x65, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12,
+	0x21, 0x0a, 0x0c, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x5f, 0x6e, 0x6f, 0x6e, 0x63, 0x65, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0b, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x4e, 0x6f, 0x6e,
+	0x63, 0x65, 0x12, 0x28, 0x0a, 0x10, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x5f, 0x6b, 0x65, 0x79,
+	0x5f, 0x73, 0x68, 0x61, 0x72, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0e, 0x73, 0x65,
+	0x72, 0x76, 0x65, 0x72, 0x4b, 0x65, 0x79, 0x53, 0x68, 0x61, 0x72, 0x65, 0x12, 0x29, 0x0a, 0x10,
+	0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x5f, 0x73, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65,
+	0x18, 0x06, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0f, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x53, 0x69,
+	0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x73, 0x65, 0x72, 0x76, 0x65,
+	0x72, 0x5f, 0x6d, 0x61, 0x63, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x09, 0x73, 0x65, 0x72,
+	0x76, 0x65, 0x72, 0x4d, 0x61, 0x63, 0x22, 0x4f, 0x0a, 0x03, 0x4b, 0x45, 0x33, 0x12, 0x29, 0x0a,
+	0x10, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x5f, 0x73, 0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0f, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x53,
+	0x69, 0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x63, 0x6c, 0x69, 0x65,
+	0x6e, 0x74, 0x5f, 0x6d, 0x61, 0x63, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x09, 0x63, 0x6c,
+	0x69, 0x65, 0x6e, 0x74, 0x4d, 0x61, 0x63, 0x22, 0x89, 0x01, 0x0a, 0x18, 0x52, 0x65, 0x67, 0x69,
+	0x73, 0x74, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x53, 0x74, 0x61, 0x72, 0x74, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x33, 0x0a, 0x15, 0x63, 0x72, 0x65, 0x64, 0x65, 0x6e, 0x74, 0x69,
+	0x61, 0x6c, 0x5f, 0x69, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x66, 0x69, 0x65, 0x72, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0c, 0x52, 0x14, 0x63, 0x72, 0x65, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x61, 0x6c, 0x49,
+	0x64, 0x65, 0x6e, 0x74, 0x69, 0x66, 0x69, 0x65, 0x72, 0x12, 0x38, 0x0a, 0x07, 0x72, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1e, 0x2e, 0x6f, 0x70, 0x61,
+	0x71, 0x75, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x52, 0x07, 0x72, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x22, 0xb0, 0x01, 0x0a, 0x19, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x46, 0x69, 0x6e, 0x69, 0x73, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x12, 0x33, 0x0a, 0x15, 0x63, 0x72, 0x65, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x61, 0x6c, 0x5f,
+	0x69, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x66, 0x69, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c,
+	0x52, 0x14, 0x63, 0x72, 0x65, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x61, 0x6c, 0x49, 0x64, 0x65, 0x6e,
+	0x74, 0x69, 0x66, 0x69, 0x65, 0x72, 0x12, 0x27, 0x0a, 0x0f, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74,
+	0x5f, 0x69, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52,
+	0x0e, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x49, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x12,
+	0x35, 0x0a, 0x06, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x1d, 0x2e, 0x6f, 0x70, 0x61, 0x71, 0x75, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x67, 0x69,
+	0x73, 0x74, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x52, 0x06,
+	0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x22, 0x1c, 0x0a, 0x1a, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74,
+	0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x46, 0x69, 0x6e, 0x69, 0x73, 0x68, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x22, 0x63, 0x0a, 0x0a, 0x4c, 0x6f, 0x67, 0x69, 0x6e, 0x53, 0x74, 0x61,
+	0x72, 0x74, 0x12, 0x33, 0x0a, 0x15, 0x63, 0x72, 0x65, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x61, 0x6c,
+	0x5f, 0x69, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x66, 0x69, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x14, 0x63, 0x72, 0x65, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x61, 0x6c, 0x49, 0x64, 0x65,
+	0x6e, 0x74, 0x69, 0x66, 0x69, 0x65, 0x72, 0x12, 0x20, 0x0a, 0x03, 0x6b, 0x65, 0x31, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x6f, 0x70, 0x61, 0x71, 0x75, 0x65, 0x2e, 0x76, 0x31,
+	0x2e, 0x4b, 0x45, 0x31, 0x52, 0x03, 0x6b, 0x65, 0x31, 0x22, 0x42, 0x0a, 0x0b, 0x4c, 0x6f, 0x67,
+	0x69, 0x6e, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x12, 0x1f, 0x0a, 0x0b,
+	0x72, 0x65, 0x5f, 0x72, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x08, 0x52, 0x0a, 0x72, 0x65, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x22, 0x67, 0x0a,
+	0x16, 0x50, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x3b, 0x0a, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1f, 0x2e, 0x6f, 0x70, 0x61, 0x71,
+	0x75, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x08, 0x72, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x6d, 0x61, 0x63, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x03, 0x6d, 0x61, 0x63, 0x22, 0x5f, 0x0a, 0x14, 0x50, 0x61, 0x73, 0x73, 0x77, 0x6f,
+	0x72, 0x64, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x12, 0x35,
+	0x0a, 0x06, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1d,
+	0x2e, 0x6f, 0x70, 0x61, 0x71, 0x75, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x67, 0x69, 0x73,
+	0x74, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x52, 0x06, 0x72,
+	0x65, 0x63, 0x6f, 0x72, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x6d, 0x61, 0x63, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x0c, 0x52, 0x03, 0x6d, 0x61, 0x63, 0x22, 0x16, 0x0a, 0x14, 0x50, 0x61, 0x73, 0x73, 0x77,
+	0x6f, 0x72, 0x64, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22,
+	0x8d, 0x02, 0x0a, 0x0c, 0x4c, 0x6f, 0x67, 0x69, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x12, 0x2d, 0x0a, 0x05, 0x73, 0x74, 0x61, 0x72, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x15, 0x2e, 0x6f, 0x70, 0x61, 0x71, 0x75, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x4c, 0x6f, 0x67, 0x69,
+	0x6e, 0x53, 0x74, 0x61, 0x72, 0x74, 0x48, 0x00, 0x52, 0x05, 0x73, 0x74, 0x61, 0x72, 0x74, 0x12,
+	0x22, 0x0a, 0x03, 0x6b, 0x65, 0x33, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x6f,
+	0x70, 0x61, 0x71, 0x75, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x4b, 0x45, 0x33, 0x48, 0x00, 0x52, 0x03,
+	0x6b, 0x65, 0x33, 0x12, 0x49, 0x0a, 0x0f, 0x70, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x5f,
+	0x63, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1e, 0x2e, 0x6f,
+	0x70, 0x61, 0x71, 0x75, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x48, 0x00, 0x52, 0x0e,
+	0x70, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x12, 0x57,
+	0x0a, 0x16, 0x70, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x5f, 0x63, 0x68, 0x61, 0x6e, 0x67,
+	0x65, 0x5f, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1f,
+	0x2e, 0x6f, 0x70, 0x61, 0x71, 0x75, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x73, 0x73, 0x77,
+	0x6f, 0x72, 0x64, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x48,
+	0x00, 0x52, 0x14, 0x70, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x43, 0x68, 0x61, 0x6e, 0x67,
+	0x65, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x42, 0x06, 0x0a, 0x04, 0x73, 0x74, 0x65, 0x70, 0x22,
+	0xa5, 0x02, 0x0a, 0x0d, 0x4c, 0x6f, 0x67, 0x69, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x12, 0x22, 0x0a, 0x03, 0x6b, 0x65, 0x32, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0e,
+	0x2e, 0x6f, 0x70, 0x61, 0x71, 0x75, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x4b, 0x45, 0x32, 0x48, 0x00,
+	0x52, 0x03, 0x6b, 0x65, 0x32, 0x12, 0x30, 0x0a, 0x06, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x6f, 0x70, 0x61, 0x71, 0x75, 0x65, 0x2e, 0x76,
+	0x31, 0x2e, 0x4c, 0x6f, 0x67, 0x69, 0x6e, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x48, 0x00, 0x52,
+	0x06, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x5d, 0x0a, 0x18, 0x70, 0x61, 0x73, 0x73, 0x77,
+	0x6f, 0x72, 0x64, 0x5f, 0x63, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x5f, 0x72, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x21, 0x2e, 0x6f, 0x70, 0x61, 0x71,
+	0x75, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x43, 0x68,
+	0x61, 0x6e, 0x67, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00, 0x52, 0x16,
+	0x70, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x57, 0x0a, 0x16, 0x70, 0x61, 0x73, 0x73, 0x77, 0x6f,
+	0x72, 0x64, 0x5f, 0x63, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x5f, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1f, 0x2e, 0x6f, 0x70, 0x61, 0x71, 0x75, 0x65, 0x2e,
+	0x76, 0x31, 0x2e, 0x50, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x43, 0x68, 0x61, 0x6e, 0x67,
+	0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x48, 0x00, 0x52, 0x14, 0x70, 0x61, 0x73, 0x73, 0x77,
+	0x6f, 0x72, 0x64, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x42,
+	0x06, 0x0a, 0x04, 0x73, 0x74, 0x65, 0x70, 0x32, 0xd8, 0x02, 0x0a, 0x06, 0x4f, 0x70, 0x61, 0x71,
+	0x75, 0x65, 0x12, 0x50, 0x0a, 0x10, 0x47, 0x65, 0x74, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75,
+	0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x22, 0x2e, 0x6f, 0x70, 0x61, 0x71, 0x75, 0x65, 0x2e,
+	0x76, 0x31, 0x2e, 0x47, 0x65, 0x74, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75, 0x72, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x18, 0x2e, 0x6f, 0x70, 0x61,
+	0x71, 0x75, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75, 0x72, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x12, 0x59, 0x0a, 0x11, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x53, 0x74, 0x61, 0x72, 0x74, 0x12, 0x23, 0x2e, 0x6f, 0x70, 0x61, 0x71,
+	0x75, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x53, 0x74, 0x61, 0x72, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1f,
+	0x2e, 0x6f, 0x70, 0x61, 0x71, 0x75, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x67, 0x69, 0x73,
+	0x74, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12,
+	0x61, 0x0a, 0x12, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x46,
+	0x69, 0x6e, 0x69, 0x73, 0x68, 0x12, 0x24, 0x2e, 0x6f, 0x70, 0x61, 0x71, 0x75, 0x65, 0x2e, 0x76,
+	0x31, 0x2e, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x46, 0x69,
+	0x6e, 0x69, 0x73, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x25, 0x2e, 0x6f, 0x70,
+	0x61, 0x71, 0x75, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x46, 0x69, 0x6e, 0x69, 0x73, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x12, 0x3e, 0x0a, 0x05, 0x4c, 0x6f, 0x67, 0x69, 0x6e, 0x12, 0x17, 0x2e, 0x6f, 0x70,
+	0x61, 0x71, 0x75, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x4c, 0x6f, 0x67, 0x69, 0x6e, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x18, 0x2e, 0x6f, 0x70, 0x61, 0x71, 0x75, 0x65, 0x2e, 0x76, 0x31,
+	0x2e, 0x4c, 0x6f, 0x67, 0x69, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x28, 0x01,
+	0x30, 0x01, 0x42, 0x27, 0x5a, 0x25, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d,
+	0x2f, 0x62, 0x79, 0x74, 0x65, 0x6d, 0x61, 0x72, 0x65, 0x2f, 0x6f, 0x70, 0x61, 0x71, 0x75, 0x65,
+	0x2f, 0x6f, 0x70, 0x61, 0x71, 0x75, 0x65, 0x67, 0x72, 0x70, 0x63, 0x62, 0x06, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x33,
+}
+
+var (
+	file_opaque_proto_rawDescOnce sync.Once
+	file_opaque_proto_rawDescData = file_opaque_proto_rawDesc
+)
+
+func file_opaque_proto_rawDescGZIP() []byte {
+	file_opaque_proto_rawDescOnce.Do(func() {
+		file_opaque_proto_rawDescData = protoimpl.X.CompressGZIP(file_opaque_proto_rawDescData)
+	})
+	return file_opaque_proto_rawDescData
+}
+
+var file_opaque_proto_msgTypes = make([]protoimpl.MessageInfo, 18)
+var file_opaque_proto_goTypes = []interface{}{
+	(*Configuration)(nil),              // 0: opaque.v1.Configuration
+	(*GetConfigurationRequest)(nil),    // 1: opaque.v1.GetConfigurationRequest
+	(*RegistrationRequest)(nil),        // 2: opaque.v1.RegistrationRequest
+	(*RegistrationResponse)(nil),       // 3: opaque.v1.RegistrationResponse
+	(*RegistrationRecord)(nil),         // 4: opaque.v1.RegistrationRecord
+	(*KE1)(nil),                        // 5: opaque.v1.KE1
+	(*KE2)(nil),                        // 6: opaque.v1.KE2
+	(*KE3)(nil),                        // 7: opaque.v1.KE3
+	(*RegistrationStartRequest)(nil),   // 8: opaque.v1.RegistrationStartRequest
+	(*RegistrationFinishRequest)(nil),  // 9: opaque.v1.RegistrationFinishRequest
+	(*RegistrationFinishResponse)(nil), // 10: opaque.v1.RegistrationFinishResponse
+	(*LoginStart)(nil),                 // 11: opaque.v1.LoginStart
+	(*LoginResult)(nil),                // 12: opaque.v1.LoginResult
+	(*PasswordChangeResponse)(nil),     // 13: opaque.v1.PasswordChangeResponse
+	(*PasswordChangeRecord)(nil),       // 14: opaque.v1.PasswordChangeRecord
+	(*PasswordChangeResult)(nil),       // 15: opaque.v1.PasswordChangeResult
+	(*LoginRequest)(nil),               // 16: opaque.v1.LoginRequest
+	(*LoginResponse)(nil),              // 17: opaque.v1.LoginResponse
+}
+var file_opaque_proto_depIdxs = []int32{
+	2,  // 0: opaque.v1.RegistrationStartRequest.request:type_name -> opaque.v1.RegistrationRequest
+	4,  // 1: opaque.v1.RegistrationFinishRequest.record:type_name -> opaque.v1.RegistrationRecord
+	5,  // 2: opaque.v1.LoginStart.ke1:type_name -> opaque.v1.KE1
+	3,  // 3: opaque.v1.PasswordChangeResponse.response:type_name -> opaque.v1.RegistrationResponse
+	4,  // 4: opaque.v1.PasswordChangeRecord.record:type_name -> opaque.v1.RegistrationRecord
+	11, // 5: opaque.v1.LoginRequest.start:type_name -> opaque.v1.LoginStart
+	7,  // 6: opaque.v1.LoginRequest.ke3:type_name -> opaque.v1.KE3
+	2,  // 7: opaque.v1.LoginRequest.password_change:type_name -> opaque.v1.RegistrationRequest
+	14, // 8: opaque.v1.LoginRequest.password_change_record:type_name -> opaque.v1.PasswordChangeRecord
+	6,  // 9: opaque.v1.LoginResponse.ke2:type_name -> opaque.v1.KE2
+	12, // 10: opaque.v1.LoginResponse.result:type_name -> opaque.v1.LoginResult
+	13, // 11: opaque.v1.LoginResponse.password_change_response:type_name -> opaque.v1.PasswordChangeResponse
+	15, // 12: opaque.v1.LoginResponse.password_change_result:type_name -> opaque.v1.PasswordChangeResult
+	1,  // 13: opaque.v1.Opaque.GetConfiguration:input_type -> opaque.v1.GetConfigurationRequest
+	8,  // 14: opaque.v1.Opaque.RegistrationStart:input_type -> opaque.v1.RegistrationStartRequest
+	9,  // 15: opaque.v1.Opaque.RegistrationFinish:input_type -> opaque.v1.RegistrationFinishRequest
+	16, // 16: opaque.v1.Opaque.Login:input_type -> opaque.v1.LoginRequest
+	0,  // 17: opaque.v1.Opaque.GetConfiguration:output_type -> opaque.v1.Configuration
+	3,  // 18: opaque.v1.Opaque.RegistrationStart:output_type -> opaque.v1.RegistrationResponse
+	10, // 19: opaque.v1.Opaque.RegistrationFinish:output_type -> opaque.v1.RegistrationFinishResponse
+	17, // 20: opaque.v1.Opaque.Login:output_type -> opaque.v1.LoginResponse
+	17, // [17:21] is the sub-list for method output_type
+	13, // [13:17] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
+}
+
+func init() { file_opaque_proto_init() }
+func file_opaque_proto_init() {
+	if File_opaque_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_opaque_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Configuration); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_opaque_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetConfigurationRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_opaque_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RegistrationRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_opaque_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RegistrationResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_opaque_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RegistrationRecord); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_opaque_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*KE1); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_opaque_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*KE2); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_opaque_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*KE3); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_opaque_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RegistrationStartRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_opaque_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RegistrationFinishRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_opaque_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RegistrationFinishResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_opaque_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*LoginStart); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_opaque_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*LoginResult); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_opaque_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PasswordChangeResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_opaque_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PasswordChangeRecord); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_opaque_proto_msgTypes[15].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PasswordChangeResult); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_opaque_proto_msgTypes[16].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*LoginRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_opaque_proto_msgTypes[17].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*LoginResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_opaque_proto_msgTypes[16].OneofWrappers = []interface{}{
+		(*LoginRequest_Start)(nil),
+		(*LoginRequest_Ke3)(nil),
+		(*LoginRequest_PasswordChange)(nil),
+		(*LoginRequest_PasswordChangeRecord)(nil),
+	}
+	file_opaque_proto_msgTypes[17].OneofWrappers = []interface{}{
+		(*LoginResponse_Ke2)(nil),
+		(*LoginResponse_Result)(nil),
+		(*LoginResponse_PasswordChangeResponse)(nil),
+		(*LoginResponse_PasswordChangeResult)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_opaque_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   18,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_opaque_proto_goTypes,
+		DependencyIndexes: file_opaque_proto_depIdxs,
+		MessageInfos:      file_opaque_proto_msgTypes,
+	}.Build()
+	File_opaque_proto = out.File
+	file_opaque_proto_rawDesc = nil
+	file_opaque_proto_goTypes = nil
+	file_opaque_proto_depIdxs = nil
+}
@@ -0,0 +1,523 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaquegrpc_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/bytemare/opaque"
+	"github.com/bytemare/opaque/opaquegrpc"
+)
+
+type grpcTest struct {
+	conf     *opaque.Configuration
+	conn     *grpc.ClientConn
+	sessions chan []byte
+	errors   chan error
+}
+
+// newGRPCTest serves a Server for the configuration over an in-memory connection. Unless set, the OnLogin hook sends
+// the session key on sessions and returns "token", and OnError sends the error on errors.
+func newGRPCTest(t *testing.T, config *opaquegrpc.Config) *grpcTest {
+	h := &grpcTest{conf: opaque.DefaultConfiguration(), sessions: make(chan []byte, 1), errors: make(chan error, 1)}
+
+	if config.Configuration == nil {
+		config.Configuration = h.conf
+	}
+
+	if config.Keys == nil && config.Keyring == nil {
+		keys, err := config.Configuration.GenerateServerKeyMaterial()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		config.Keys = keys
+	}
+
+	if config.Records == nil {
+		config.Records = opaque.NewMemoryRecordStore()
+	}
+
+	if config.OnLogin == nil {
+		config.OnLogin = func(_ context.Context, _ []byte, state *opaque.ServerLoginState) ([]byte, error) {
+			h.sessions <- state.SessionKey()
+			return []byte("token"), nil
+		}
+	}
+
+	if config.OnError == nil {
+		config.OnError = func(_ context.Context, err error) {
+			h.errors <- err
+		}
+	}
+
+	h.conf = config.Configuration
+
+	service, err := opaquegrpc.NewServer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener := bufconn.Listen(1 << 16)
+	server := grpc.NewServer()
+	opaquegrpc.RegisterOpaqueServer(server, service)
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	t.Cleanup(server.Stop)
+
+	h.conn, err = grpc.NewClient(
+		"passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = h.conn.Close()
+	})
+
+	return h
+}
+
+func (h *grpcTest) client(t *testing.T, serverIdentity []byte) *opaquegrpc.Client {
+	client, err := h.conf.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := opaquegrpc.NewClient(&opaquegrpc.ClientConfig{
+		Conn:           h.conn,
+		Client:         client,
+		ServerIdentity: serverIdentity,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func expectCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+
+	if status.Code(err) != code {
+		t.Fatalf("expected status %s, got %v", code, err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	serverID := []byte("server")
+
+	for _, mode := range []opaque.AKEMode{opaque.TripleDH, opaque.HMQV} {
+		conf := opaque.DefaultConfiguration()
+		conf.Mode = mode
+		h := newGRPCTest(t, &opaquegrpc.Config{Configuration: conf, ServerIdentity: serverID})
+		c := h.client(t, serverID)
+		credID := []byte("client")
+		clientID := []byte("client@example.com")
+		password := []byte("password")
+
+		exportKey, err := c.Register(ctx, credID, clientID, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		session, err := c.Login(ctx, credID, clientID, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(session.SessionKey, <-h.sessions) {
+			t.Fatal("session keys differ")
+		}
+
+		if !bytes.Equal(exportKey, session.ExportKey) || string(session.Data) != "token" {
+			t.Fatal("unexpected export key or login data")
+		}
+
+		for name, login := range map[string][][]byte{
+			"wrong password":  {credID, clientID, []byte("wrong")},
+			"unknown client":  {[]byte("unknown"), clientID, password},
+			"wrong client ID": {credID, []byte("other"), password},
+		} {
+			if _, err := c.Login(ctx, login[0], login[1], login[2]); !errors.Is(err, opaquegrpc.ErrAuthentication) {
+				t.Fatalf("%s: expected error %q, got %v", name, opaquegrpc.ErrAuthentication, err)
+			}
+		}
+
+		if _, err := h.client(t, nil).Login(ctx, credID, clientID, password); !errors.Is(
+			err,
+			opaquegrpc.ErrAuthentication,
+		) {
+			t.Fatalf("wrong server ID: expected error %q, got %v", opaquegrpc.ErrAuthentication, err)
+		}
+
+		if _, err := c.Register(ctx, credID, nil, password); !errors.Is(err, opaquegrpc.ErrRecordExists) {
+			t.Fatalf("expected error %q, got %v", opaquegrpc.ErrRecordExists, err)
+		}
+	}
+}
+
+func TestClient_ChangePassword(t *testing.T) {
+	ctx := context.Background()
+	h := newGRPCTest(t, &opaquegrpc.Config{})
+	c := h.client(t, nil)
+	credID := []byte("client")
+	clientID := []byte("client@example.com")
+	oldPassword, newPassword := []byte("old"), []byte("new")
+
+	if _, err := c.Register(ctx, credID, clientID, oldPassword); err != nil {
+		t.Fatal(err)
+	}
+
+	session, exportKey, err := c.ChangePassword(ctx, credID, clientID, oldPassword, newPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(session.SessionKey, <-h.sessions) || string(session.Data) != "token" {
+		t.Fatal("unexpected login session")
+	}
+
+	if _, _, err := c.ChangePassword(ctx, credID, clientID, oldPassword, newPassword); !errors.Is(
+		err,
+		opaquegrpc.ErrAuthentication,
+	) {
+		t.Fatalf("expected error %q, got %v", opaquegrpc.ErrAuthentication, err)
+	}
+
+	session, err = c.Login(ctx, credID, clientID, newPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-h.sessions
+
+	if !bytes.Equal(session.ExportKey, exportKey) {
+		t.Fatal("login export key differs from the password change's one")
+	}
+}
+
+func TestClient_ChangePassword_RecordChanged(t *testing.T) {
+	ctx := context.Background()
+	records := opaque.NewMemoryRecordStore()
+	credID := []byte("client")
+	password := []byte("password")
+
+	// The record is replaced, e.g. by a concurrent password change, while the client logs in.
+	h := newGRPCTest(t, &opaquegrpc.Config{
+		Records: records,
+		OnLogin: func(context.Context, []byte, *opaque.ServerLoginState) ([]byte, error) {
+			record, err := records.Get(credID)
+			if err != nil {
+				return nil, err
+			}
+
+			replaced := *record
+			replaced.KeyVersion++
+
+			return nil, records.Replace(record, &replaced)
+		},
+	})
+	c := h.client(t, nil)
+
+	if _, err := c.Register(ctx, credID, nil, password); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := c.ChangePassword(ctx, credID, nil, password, []byte("new")); !errors.Is(
+		err,
+		opaquegrpc.ErrRecordChanged,
+	) {
+		t.Fatalf("expected error %q, got %v", opaquegrpc.ErrRecordChanged, err)
+	}
+}
+
+func TestClient_ReRegistration(t *testing.T) {
+	ctx := context.Background()
+	conf := opaque.DefaultConfiguration()
+	keyring := opaque.NewServerKeyring()
+	addKeys := func(version uint32) {
+		keys, err := conf.GenerateServerKeyMaterial()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := keyring.Add(version, keys); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	addKeys(1)
+
+	h := newGRPCTest(t, &opaquegrpc.Config{Configuration: conf, Keyring: keyring})
+	c := h.client(t, nil)
+	credID := []byte("client")
+	password := []byte("password")
+
+	if _, err := c.Register(ctx, credID, nil, password); err != nil {
+		t.Fatal(err)
+	}
+
+	addKeys(2)
+
+	// The record of version 1 still logs in, and is asked to register again.
+	session, err := c.Login(ctx, credID, nil, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-h.sessions
+
+	if !session.ReRegister {
+		t.Fatal("expected the client to be asked to register again")
+	}
+
+	session, exportKey, err := c.ChangePassword(ctx, credID, nil, password, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-h.sessions
+
+	if !session.ReRegister {
+		t.Fatal("expected the client to be asked to register again in the re-registration's login")
+	}
+
+	// Once moved to version 2, version 1 can be removed.
+	if err := keyring.Remove(1); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err = c.Login(ctx, credID, nil, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-h.sessions
+
+	if session.ReRegister || !bytes.Equal(session.ExportKey, exportKey) {
+		t.Fatal("expected the client to be registered under the current version")
+	}
+}
+
+func TestClient_Configuration(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	conf.Context = []byte("context")
+	h := newGRPCTest(t, &opaquegrpc.Config{Configuration: conf})
+
+	decoded, err := h.client(t, nil).Configuration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decoded.Serialize(), conf.Serialize()) {
+		t.Fatal("configurations differ")
+	}
+}
+
+func TestServer_Registration(t *testing.T) {
+	ctx := context.Background()
+	h := newGRPCTest(t, &opaquegrpc.Config{})
+	service := opaquegrpc.NewOpaqueClient(h.conn)
+	client, _ := h.conf.Client()
+	request, _ := client.RegistrationInit([]byte("password"))
+
+	_, err := service.RegistrationStart(ctx, &opaquegrpc.RegistrationStartRequest{
+		Request: &opaquegrpc.RegistrationRequest{BlindedMessage: request.Serialize()},
+	})
+	expectCode(t, err, codes.InvalidArgument)
+
+	_, err = service.RegistrationStart(ctx, &opaquegrpc.RegistrationStartRequest{
+		CredentialIdentifier: []byte("client"),
+		Request:              &opaquegrpc.RegistrationRequest{BlindedMessage: request.Serialize()[1:]},
+	})
+	expectCode(t, err, codes.InvalidArgument)
+
+	_, err = service.RegistrationFinish(ctx, &opaquegrpc.RegistrationFinishRequest{
+		CredentialIdentifier: []byte("client"),
+	})
+	expectCode(t, err, codes.InvalidArgument)
+}
+
+func TestServer_LoginSteps(t *testing.T) {
+	h := newGRPCTest(t, &opaquegrpc.Config{})
+	service := opaquegrpc.NewOpaqueClient(h.conn)
+	client, _ := h.conf.Client()
+	ke1, _ := client.LoginInit([]byte("password"))
+	encoded := ke1.Serialize()
+	blinded := ke1.CredentialRequest.Serialize()
+	nonceEnd := len(blinded) + len(ke1.NonceU)
+
+	valid := &opaquegrpc.KE1{
+		BlindedMessage: blinded,
+		ClientNonce:    ke1.NonceU,
+		ClientKeyShare: encoded[nonceEnd:],
+	}
+
+	// The encoding of the fields has the right length, but a byte of the nonce is moved to the key share.
+	shifted := &opaquegrpc.KE1{
+		BlindedMessage: blinded,
+		ClientNonce:    ke1.NonceU[:len(ke1.NonceU)-1],
+		ClientKeyShare: encoded[nonceEnd-1:],
+	}
+
+	start := func(ke1 *opaquegrpc.KE1) *opaquegrpc.LoginRequest {
+		return &opaquegrpc.LoginRequest{Step: &opaquegrpc.LoginRequest_Start{Start: &opaquegrpc.LoginStart{
+			CredentialIdentifier: []byte("client"),
+			Ke1:                  ke1,
+		}}}
+	}
+
+	ke3 := &opaquegrpc.LoginRequest{Step: &opaquegrpc.LoginRequest_Ke3{Ke3: &opaquegrpc.KE3{}}}
+
+	for name, requests := range map[string][]*opaquegrpc.LoginRequest{
+		"KE3 first":     {ke3},
+		"start twice":   {start(valid), start(valid)},
+		"shifted field": {start(shifted)},
+		"invalid KE3":   {start(valid), ke3},
+		"missing step":  {{}},
+	} {
+		stream, err := service.Login(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, request := range requests {
+			if err = stream.Send(request); err != nil {
+				break
+			}
+
+			if _, err = stream.Recv(); err != nil {
+				break
+			}
+		}
+
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("%s: expected status %s, got %v", name, codes.InvalidArgument, err)
+		}
+	}
+}
+
+func TestServer_LoginTimeout(t *testing.T) {
+	ctx := context.Background()
+	h := newGRPCTest(t, &opaquegrpc.Config{LoginTimeout: 50 * time.Millisecond})
+
+	if _, err := h.client(t, nil).Register(ctx, []byte("client"), nil, []byte("password")); err != nil {
+		t.Fatal(err)
+	}
+
+	client, _ := h.conf.Client()
+	ke1, _ := client.LoginInit([]byte("password"))
+	encoded := ke1.Serialize()
+	blinded := ke1.CredentialRequest.Serialize()
+
+	stream, err := opaquegrpc.NewOpaqueClient(h.conn).Login(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = stream.Send(&opaquegrpc.LoginRequest{Step: &opaquegrpc.LoginRequest_Start{Start: &opaquegrpc.LoginStart{
+		CredentialIdentifier: []byte("client"),
+		Ke1: &opaquegrpc.KE1{
+			BlindedMessage: blinded,
+			ClientNonce:    ke1.NonceU,
+			ClientKeyShare: encoded[len(blinded)+len(ke1.NonceU):],
+		},
+	}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The client never sends KE3.
+	_, err = stream.Recv()
+	expectCode(t, err, codes.DeadlineExceeded)
+}
+
+func TestServer_OnLogin(t *testing.T) {
+	ctx := context.Background()
+	denied := status.Error(codes.PermissionDenied, "denied")
+	internal := errors.New("session storage failure")
+
+	for _, onLoginErr := range []error{denied, internal} {
+		onLoginErr := onLoginErr
+		h := newGRPCTest(t, &opaquegrpc.Config{
+			OnLogin: func(context.Context, []byte, *opaque.ServerLoginState) ([]byte, error) {
+				return nil, onLoginErr
+			},
+		})
+		c := h.client(t, nil)
+
+		if _, err := c.Register(ctx, []byte("client"), nil, []byte("password")); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := c.Login(ctx, []byte("client"), nil, []byte("password"))
+
+		if onLoginErr == denied {
+			expectCode(t, err, codes.PermissionDenied)
+			continue
+		}
+
+		expectCode(t, err, codes.Internal)
+
+		if reported := <-h.errors; !errors.Is(reported, internal) {
+			t.Fatalf("expected reported error %q, got %v", internal, reported)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	keys, _ := conf.GenerateServerKeyMaterial()
+	records := opaque.NewMemoryRecordStore()
+
+	for _, config := range []*opaquegrpc.Config{
+		nil,
+		{Keys: keys, Records: records},
+		{Configuration: conf, Records: records},
+		{Configuration: conf, Keys: keys},
+		{Configuration: conf, Keys: keys, Keyring: opaque.NewServerKeyring(), Records: records},
+		{Configuration: &opaque.Configuration{}, Keys: keys, Records: records},
+	} {
+		if _, err := opaquegrpc.NewServer(config); err == nil {
+			t.Fatal("expected error on invalid server configuration")
+		}
+	}
+
+	client, _ := conf.Client()
+
+	for _, config := range []*opaquegrpc.ClientConfig{nil, {Client: client}, {Conn: &grpc.ClientConn{}}} {
+		if _, err := opaquegrpc.NewClient(config); err == nil {
+			t.Fatal("expected error on invalid client configuration")
+		}
+	}
+}
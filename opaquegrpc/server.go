@@ -0,0 +1,409 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+// Package opaquegrpc exposes OPAQUE registration, login, and password change as a gRPC service, defined in
+// opaque.proto. Registration is two unary calls, and a login is a single bidirectional stream, which can go on with a
+// password change, so that the server's login state stays in memory for the duration of the stream and never needs
+// to be serialized. Server implements the service over an opaque.Server, and Client runs the matching client side.
+package opaquegrpc
+
+//go:generate protoc --go_out=paths=source_relative:. --go-grpc_out=paths=source_relative:. opaque.proto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/bytemare/opaque"
+)
+
+// defaultLoginTimeout is the time a Server waits for each client step when Config.LoginTimeout is not set.
+const defaultLoginTimeout = time.Minute
+
+var (
+	// ErrRecordExists indicates that a registration was attempted for a credential identifier that already has a
+	// record. It's the error returned by RecordStore.Create, and is sent as an AlreadyExists status.
+	ErrRecordExists = opaque.ErrRecordExists
+
+	// ErrRecordChanged indicates that a password change was attempted in a login session whose record has since been
+	// replaced, e.g. by another password change. It is sent as an Aborted status.
+	ErrRecordChanged = opaque.ErrRecordChanged
+
+	// ErrAuthentication indicates that a login or a password change failed, because the client or the server could
+	// not be authenticated. It is sent as an Unauthenticated status.
+	ErrAuthentication = errors.New("authentication failed")
+
+	errMissingCredentialIdentifier = errors.New("missing credential identifier")
+	errLoginStep                   = errors.New("unexpected login step")
+	errInternal                    = errors.New("internal server error")
+	errServerConfig                = errors.New(
+		"server configuration must have a configuration, either keys or a keyring, and records")
+)
+
+// Config holds the parameters of a Server.
+type Config struct {
+	// Configuration is the OPAQUE configuration, and must be set. It's given to clients by GetConfiguration.
+	Configuration *opaque.Configuration
+
+	// Keys is the server's key material. Either Keys or Keyring must be set.
+	Keys *opaque.ServerKeyMaterial
+
+	// KeyVersion is the version of Keys, stored in the records registered and changed through the server, as with an
+	// opaque.ServerKeyring.
+	KeyVersion uint32
+
+	// Keyring holds the server's versioned key material, instead of Keys. Logins use the key material of the client's
+	// record, and registrations and password changes the current one. Clients whose record NeedsReRegistration are
+	// told so in the login result, and register again by changing their password, possibly to the same one, in that
+	// login's stream. Registrations are stored under the version that's current at RegistrationFinish, so key versions
+	// should not be added while registrations are in flight.
+	Keyring *opaque.ServerKeyring
+
+	// Records stores the client records, and must be set.
+	Records opaque.RecordStore
+
+	// ServerIdentity is the optional server identity used in logins.
+	ServerIdentity []byte
+
+	// FakeRecordSeed optionally makes responses to unknown credential identifiers stable, as in Server.GetRecord.
+	FakeRecordSeed []byte
+
+	// LoginTimeout bounds the wait for each of the client's steps, e.g. for KE3 once KE2 is sent, after which the
+	// login fails with a DeadlineExceeded status. It defaults to one minute, and the stream's own deadline, if earlier,
+	// still applies.
+	LoginTimeout time.Duration
+
+	// OnLogin, if set, is called on successful logins, with the credential identifier and the finished login state,
+	// e.g. to derive the session's keys with Server.Exporter and to open an application session. The returned data,
+	// e.g. a token, is sent to the client with the login result. A returned gRPC status error is sent to the client,
+	// and other errors result in an Internal status.
+	OnLogin func(ctx context.Context, credentialIdentifier []byte, state *opaque.ServerLoginState) ([]byte, error)
+
+	// OnError, if set, is called with the errors that result in an Internal status, whose details are not sent to the
+	// client.
+	OnError func(ctx context.Context, err error)
+}
+
+// Server implements OpaqueServer. Registration calls accept any client, and should be guarded by the application's
+// authorization interceptor, e.g. to only allow enrollment of invited users.
+type Server struct {
+	UnimplementedOpaqueServer
+	config        Config
+	server        *opaque.Server
+	configuration []byte
+}
+
+// NewServer returns a Server for the configuration, to be registered with RegisterOpaqueServer.
+func NewServer(config *Config) (*Server, error) {
+	if config == nil || config.Configuration == nil || config.Records == nil ||
+		(config.Keys == nil) == (config.Keyring == nil) {
+		return nil, errServerConfig
+	}
+
+	server, err := config.Configuration.Server()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		config:        *config,
+		server:        server,
+		configuration: config.Configuration.Serialize(),
+	}
+
+	if s.config.LoginTimeout <= 0 {
+		s.config.LoginTimeout = defaultLoginTimeout
+	}
+
+	return s, nil
+}
+
+func invalidArgument(err error) error {
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+func unauthenticated(err error) error {
+	return status.Error(codes.Unauthenticated, fmt.Sprintf("%v: %v", ErrAuthentication, err))
+}
+
+// fail returns the status of an unexpected error, which is only given to OnError, unless it's already a status.
+func (s *Server) fail(ctx context.Context, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	if s.config.OnError != nil {
+		s.config.OnError(ctx, err)
+	}
+
+	return status.Error(codes.Internal, errInternal.Error())
+}
+
+// currentKeys returns the key material of registrations and password changes, and its version.
+func (s *Server) currentKeys() (uint32, *opaque.ServerKeyMaterial) {
+	if s.config.Keyring != nil {
+		return s.config.Keyring.Current()
+	}
+
+	return s.config.KeyVersion, s.config.Keys
+}
+
+// recordKeys returns the key material to log in with the record.
+func (s *Server) recordKeys(record *opaque.ClientRecord) (*opaque.ServerKeyMaterial, error) {
+	if s.config.Keyring != nil {
+		return s.config.Keyring.ForRecord(record)
+	}
+
+	return s.config.Keys, nil
+}
+
+// GetConfiguration returns the encoded configuration of the server.
+func (s *Server) GetConfiguration(context.Context, *GetConfigurationRequest) (*Configuration, error) {
+	return &Configuration{Encoded: s.configuration}, nil
+}
+
+// RegistrationStart evaluates the registration request for the credential identifier.
+func (s *Server) RegistrationStart(
+	ctx context.Context,
+	request *RegistrationStartRequest,
+) (*RegistrationResponse, error) {
+	if len(request.GetCredentialIdentifier()) == 0 {
+		return nil, invalidArgument(errMissingCredentialIdentifier)
+	}
+
+	registrationRequest, err := decodeRegistrationRequest(s.server.Deserialize, request.GetRequest())
+	if err != nil {
+		return nil, invalidArgument(err)
+	}
+
+	_, keys := s.currentKeys()
+
+	response, err := s.server.RegistrationResponse(registrationRequest, keys, request.GetCredentialIdentifier())
+	if err != nil {
+		return nil, s.fail(ctx, err)
+	}
+
+	return newRegistrationResponse(response), nil
+}
+
+// RegistrationFinish stores the client record for the credential identifier. It fails with an AlreadyExists status
+// if a record already exists for the credential identifier.
+func (s *Server) RegistrationFinish(
+	ctx context.Context,
+	request *RegistrationFinishRequest,
+) (*RegistrationFinishResponse, error) {
+	if len(request.GetCredentialIdentifier()) == 0 {
+		return nil, invalidArgument(errMissingCredentialIdentifier)
+	}
+
+	record, err := decodeRegistrationRecord(s.server.Deserialize, request.GetRecord())
+	if err != nil {
+		return nil, invalidArgument(err)
+	}
+
+	version, _ := s.currentKeys()
+
+	err = s.config.Records.Create(&opaque.ClientRecord{
+		CredentialIdentifier: request.GetCredentialIdentifier(),
+		ClientIdentity:       request.GetClientIdentity(),
+		RegistrationRecord:   record,
+		KeyVersion:           version,
+	})
+
+	switch {
+	case errors.Is(err, ErrRecordExists):
+		return nil, status.Error(codes.AlreadyExists, ErrRecordExists.Error())
+	case err != nil:
+		return nil, s.fail(ctx, err)
+	}
+
+	return &RegistrationFinishResponse{}, nil
+}
+
+// receive returns the next request on the stream, or a DeadlineExceeded status if it doesn't arrive within the
+// timeout. The pending Recv returns once the stream is closed, as Login returns.
+func receive(ctx context.Context, stream Opaque_LoginServer, timeout time.Duration) (*LoginRequest, error) {
+	type received struct {
+		request *LoginRequest
+		err     error
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result := make(chan received, 1)
+
+	go func() {
+		request, err := stream.Recv()
+		result <- received{request, err}
+	}()
+
+	select {
+	case r := <-result:
+		return r.request, r.err
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// Login runs a login on the stream, and then the client's password change, if any. Unknown credential identifiers get
+// a KE2 from a fake record, and fail with an Unauthenticated status on KE3, as wrong passwords do. A login fails with
+// a DeadlineExceeded status if a step of the client doesn't arrive within the LoginTimeout, so the client must close
+// the stream after the login result if it doesn't change its password.
+func (s *Server) Login(stream Opaque_LoginServer) error {
+	ctx := stream.Context()
+
+	request, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	start := request.GetStart()
+	if start == nil {
+		return invalidArgument(errLoginStep)
+	}
+
+	if len(start.GetCredentialIdentifier()) == 0 {
+		return invalidArgument(errMissingCredentialIdentifier)
+	}
+
+	ke1, err := decodeKE1(s.server.Deserialize, start.GetKe1())
+	if err != nil {
+		return invalidArgument(err)
+	}
+
+	record, err := s.server.GetRecord(s.config.Records, start.GetCredentialIdentifier(), s.config.FakeRecordSeed)
+	if err != nil {
+		return s.fail(ctx, err)
+	}
+
+	keys, err := s.recordKeys(record)
+	if err != nil {
+		return s.fail(ctx, err)
+	}
+
+	ke2, state, err := s.server.LoginInit(ke1, s.config.ServerIdentity, keys, record)
+	if err != nil {
+		return s.fail(ctx, err)
+	}
+
+	if err := stream.Send(&LoginResponse{Step: &LoginResponse_Ke2{Ke2: newKE2(ke2)}}); err != nil {
+		return err
+	}
+
+	if request, err = receive(ctx, stream, s.config.LoginTimeout); err != nil {
+		return err
+	}
+
+	if request.GetKe3() == nil {
+		return invalidArgument(errLoginStep)
+	}
+
+	ke3, err := decodeKE3(s.server.Deserialize, request.GetKe3())
+	if err != nil {
+		return invalidArgument(err)
+	}
+
+	if err := s.server.LoginFinish(ke3, state); err != nil {
+		return unauthenticated(err)
+	}
+
+	var data []byte
+
+	if s.config.OnLogin != nil {
+		if data, err = s.config.OnLogin(ctx, start.GetCredentialIdentifier(), state); err != nil {
+			return s.fail(ctx, err)
+		}
+	}
+
+	result := &LoginResult{
+		Data:       data,
+		ReRegister: s.config.Keyring != nil && s.config.Keyring.NeedsReRegistration(record),
+	}
+
+	if err := stream.Send(&LoginResponse{Step: &LoginResponse_Result{Result: result}}); err != nil {
+		return err
+	}
+
+	return s.passwordChange(stream, record, state)
+}
+
+// passwordChange runs the client's password change in the finished login session on the stream, if the client
+// doesn't close it. A password change fails with an Unauthenticated status if the record is not authenticated with
+// the login session's key, and with an Aborted status if the client's record has changed since the login.
+func (s *Server) passwordChange(
+	stream Opaque_LoginServer,
+	record *opaque.ClientRecord,
+	state *opaque.ServerLoginState,
+) error {
+	ctx := stream.Context()
+
+	request, err := receive(ctx, stream, s.config.LoginTimeout)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if request.GetPasswordChange() == nil {
+		return invalidArgument(errLoginStep)
+	}
+
+	registrationRequest, err := decodeRegistrationRequest(s.server.Deserialize, request.GetPasswordChange())
+	if err != nil {
+		return invalidArgument(err)
+	}
+
+	version, keys := s.currentKeys()
+
+	response, err := s.server.PasswordChangeResponse(registrationRequest, state, keys, record)
+	if err != nil {
+		return s.fail(ctx, err)
+	}
+
+	if err := stream.Send(&LoginResponse{Step: &LoginResponse_PasswordChangeResponse{
+		PasswordChangeResponse: newPasswordChangeResponse(response),
+	}}); err != nil {
+		return err
+	}
+
+	if request, err = receive(ctx, stream, s.config.LoginTimeout); err != nil {
+		return err
+	}
+
+	if request.GetPasswordChangeRecord() == nil {
+		return invalidArgument(errLoginStep)
+	}
+
+	upload, err := decodePasswordChangeRecord(s.server.Deserialize, request.GetPasswordChangeRecord())
+	if err != nil {
+		return invalidArgument(err)
+	}
+
+	_, err = s.server.PasswordChangeFinish(upload, state, record, version, s.config.Records)
+
+	switch {
+	case errors.Is(err, opaque.ErrPasswordChangeAuthentication):
+		return unauthenticated(err)
+	case errors.Is(err, ErrRecordChanged):
+		return status.Error(codes.Aborted, ErrRecordChanged.Error())
+	case err != nil:
+		return s.fail(ctx, err)
+	}
+
+	return stream.Send(&LoginResponse{Step: &LoginResponse_PasswordChangeResult{
+		PasswordChangeResult: &PasswordChangeResult{},
+	}})
+}
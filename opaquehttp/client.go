@@ -0,0 +1,393 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaquehttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytemare/opaque"
+)
+
+const (
+	defaultRetries    = 2
+	defaultRetryDelay = 100 * time.Millisecond
+)
+
+var (
+	// ErrUnexpectedStatus indicates that the server responded with a status that has no matching error.
+	ErrUnexpectedStatus = errors.New("unexpected response status")
+
+	errClientConfig = errors.New("client configuration must have a URL and an OPAQUE client")
+	errContentType  = errors.New("content type must be raw or JSON")
+)
+
+// ClientConfig holds the parameters of a Client.
+type ClientConfig struct {
+	// URL is where the server's Handler is mounted, and must be set.
+	URL string
+
+	// Client runs the protocol, and must be set.
+	Client *opaque.Client
+
+	// HTTPClient sends the requests. It defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	// ContentType is the preferred format of the exchanges, ContentTypeRaw or ContentTypeJSON. It defaults to raw. If
+	// the server doesn't support it, the client switches to the other format for this and the next exchanges.
+	ContentType string
+
+	// ServerIdentity is the optional server identity, which must be the one the server's Handler uses.
+	ServerIdentity []byte
+
+	// Retries is the number of times a start request is resent after a transport error, defaulting to 2. Negative
+	// values disable retries. Finish requests are never resent, as they're not idempotent: one that did reach the
+	// server would be rejected when resent, since the record then exists or the login session has been used.
+	Retries int
+
+	// RetryDelay is the delay before the first retry, doubling on every retry. It defaults to 100ms.
+	RetryDelay time.Duration
+}
+
+// Client runs registrations, logins, and password changes against the endpoints of a Handler. It is safe for
+// concurrent use.
+type Client struct {
+	config ClientConfig
+	format format
+	mutex  sync.Mutex
+}
+
+// Session holds the result of a successful login.
+type Session struct {
+	// SessionKey is the key shared with the server.
+	SessionKey []byte
+
+	// ExportKey is the client's export key, as in opaque.Client.LoginFinish.
+	ExportKey []byte
+
+	// State is the finished login state, e.g. for opaque.Client.Exporter.
+	State *opaque.ClientLoginState
+
+	// Body is the body of the login-finish response, e.g. an application token written by the server's OnLogin.
+	Body []byte
+
+	// ReRegister is whether the server asks the client to register again, because its record was registered under a
+	// key version that is being retired. The client does so with ChangePassword, possibly to the same password.
+	ReRegister bool
+
+	// id identifies the login session on the server, for a password change.
+	id string
+}
+
+// NewClient returns a Client for the configuration.
+func NewClient(config *ClientConfig) (*Client, error) {
+	if config == nil || config.URL == "" || config.Client == nil {
+		return nil, errClientConfig
+	}
+
+	c := &Client{config: *config, format: formatRaw}
+	c.config.URL = strings.TrimSuffix(c.config.URL, "/")
+
+	if c.config.ContentType != "" {
+		f, ok := formatOf(c.config.ContentType)
+		if !ok {
+			return nil, errContentType
+		}
+
+		c.format = f
+	}
+
+	if c.config.HTTPClient == nil {
+		c.config.HTTPClient = http.DefaultClient
+	}
+
+	if c.config.Retries == 0 {
+		c.config.Retries = defaultRetries
+	}
+
+	if c.config.RetryDelay <= 0 {
+		c.config.RetryDelay = defaultRetryDelay
+	}
+
+	return c, nil
+}
+
+// Register registers the password for the credential identifier, and returns the export key. The client identity is
+// optional, and must be given again on login. If register-finish fails with a transport error, e.g. because the
+// response was lost, the record may or may not have been created: logging in with the password then tells, as it
+// succeeds with the same export key if it was, and fails with ErrAuthentication if the registration must be retried.
+func (c *Client) Register(ctx context.Context, credentialIdentifier, clientIdentity, password []byte) ([]byte, error) {
+	request, state := c.config.Client.RegistrationInit(password)
+
+	response, err := c.exchange(ctx, PathRegisterStart, &payload{
+		credentialIdentifier: credentialIdentifier,
+		message:              request.Serialize(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := c.config.Client.Deserialize.RegistrationResponse(response.message)
+	if err != nil {
+		return nil, err
+	}
+
+	record, exportKey, err := c.config.Client.RegistrationFinalize(
+		decoded,
+		clientIdentity,
+		c.config.ServerIdentity,
+		state,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := c.exchange(ctx, PathRegisterFinish, &payload{
+		credentialIdentifier: credentialIdentifier,
+		clientIdentity:       clientIdentity,
+		message:              record.Serialize(),
+	}); err != nil {
+		return nil, err
+	}
+
+	return exportKey, nil
+}
+
+// Login logs in with the password for the credential identifier. It fails with ErrAuthentication if the password is
+// wrong, the credential identifier unknown, or the server could not be authenticated.
+func (c *Client) Login(ctx context.Context, credentialIdentifier, clientIdentity, password []byte) (*Session, error) {
+	ke1, state := c.config.Client.LoginInit(password)
+
+	response, err := c.exchange(ctx, PathLoginStart, &payload{
+		credentialIdentifier: credentialIdentifier,
+		message:              ke1.Serialize(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ke2, err := c.config.Client.Deserialize.KE2(response.message)
+	if err != nil {
+		return nil, err
+	}
+
+	ke3, exportKey, err := c.config.Client.LoginFinish(clientIdentity, c.config.ServerIdentity, ke2, state)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAuthentication, err)
+	}
+
+	finish, err := c.exchange(ctx, PathLoginFinish, &payload{session: response.session, message: ke3.Serialize()})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		SessionKey: state.SessionKey(),
+		ExportKey:  exportKey,
+		State:      state,
+		Body:       finish.message,
+		ReRegister: finish.reRegister,
+		id:         response.session,
+	}, nil
+}
+
+// ChangePassword changes the password to newPassword in the login session, and returns the new export key. The client
+// identity must be the one the client registered with. The server only accepts a single password change per login
+// session, within its state lifetime after the login. It fails with ErrRecordChanged if the password has been changed
+// in another session since the login. A client whose Session asks to ReRegister does so by changing its password,
+// possibly to the same one.
+func (c *Client) ChangePassword(
+	ctx context.Context,
+	session *Session,
+	clientIdentity, newPassword []byte,
+) ([]byte, error) {
+	if session == nil {
+		return nil, errMissingSession
+	}
+
+	request, state, err := c.config.Client.PasswordChangeInit(newPassword, session.State)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.exchange(ctx, PathPasswordChangeStart, &payload{
+		session: session.id,
+		message: request.Serialize(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := c.config.Client.Deserialize.PasswordChangeResponse(response.message)
+	if err != nil {
+		return nil, err
+	}
+
+	upload, exportKey, err := c.config.Client.PasswordChangeFinalize(
+		decoded,
+		clientIdentity,
+		c.config.ServerIdentity,
+		state,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := c.exchange(ctx, PathPasswordChangeFinish, &payload{
+		session: session.id,
+		message: upload.Serialize(),
+	}); err != nil {
+		return nil, err
+	}
+
+	return exportKey, nil
+}
+
+func (c *Client) currentFormat() format {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.format
+}
+
+// negotiate switches to the other format if f is still the current one, and returns the new format.
+func (c *Client) negotiate(f format) format {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.format == f {
+		c.format = formatRaw
+		if f == formatRaw {
+			c.format = formatJSON
+		}
+	}
+
+	return c.format
+}
+
+// exchange sends the payload to the endpoint and returns the response payload. The message of responses without a
+// payload, i.e. of finish requests, is the body.
+func (c *Client) exchange(ctx context.Context, path string, p *payload) (*payload, error) {
+	f := c.currentFormat()
+
+	resp, err := c.post(ctx, path, p, f)
+	if err == nil && resp.StatusCode == http.StatusUnsupportedMediaType {
+		_ = resp.Body.Close()
+
+		if next := c.negotiate(f); next != f {
+			resp, err = c.post(ctx, path, p, next)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyLength))
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, statusError(path, resp.StatusCode, body)
+	}
+
+	if path == PathRegisterFinish || path == PathLoginFinish || path == PathPasswordChangeFinish {
+		return &payload{message: body, reRegister: resp.Header.Get(HeaderReRegister) == "true"}, nil
+	}
+
+	responseFormat, ok := formatOf(resp.Header.Get("Content-Type"))
+	if !ok {
+		return nil, fmt.Errorf("%w in response", ErrUnsupportedMediaType)
+	}
+
+	return decodePayload(responseFormat, resp.Header, bytes.NewReader(body))
+}
+
+// statusError returns the error matching the status of an error response to the endpoint, with the server's message.
+func statusError(path string, status int, body []byte) error {
+	var err error
+
+	switch status {
+	case http.StatusBadRequest:
+		err = ErrBadRequest
+	case http.StatusUnauthorized:
+		err = ErrAuthentication
+	case http.StatusConflict:
+		err = ErrRecordExists
+		if path == PathPasswordChangeStart || path == PathPasswordChangeFinish {
+			err = ErrRecordChanged
+		}
+	case http.StatusUnsupportedMediaType:
+		err = ErrUnsupportedMediaType
+	default:
+		err = fmt.Errorf("%w %d", ErrUnexpectedStatus, status)
+	}
+
+	return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(body)))
+}
+
+// retriable returns whether the requests to the endpoint can be resent, which is only the case of start requests, as
+// they don't change the server's state, or, for password-start, restore it.
+func retriable(path string) bool {
+	return path == PathRegisterStart || path == PathLoginStart || path == PathPasswordChangeStart
+}
+
+// post sends the payload in the format, resending start requests on transport errors.
+func (c *Client) post(ctx context.Context, path string, p *payload, f format) (*http.Response, error) {
+	header := http.Header{}
+
+	body, err := p.encode(f, header)
+	if err != nil {
+		return nil, err
+	}
+
+	header.Set("Accept", f.contentType())
+	delay := c.config.RetryDelay
+
+	retries := c.config.Retries
+	if !retriable(path) {
+		retries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.URL+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header = header.Clone()
+
+		resp, err := c.config.HTTPClient.Do(req)
+		if err == nil {
+			return resp, nil
+		}
+
+		if ctx.Err() != nil || attempt >= retries {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
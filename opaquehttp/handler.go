@@ -0,0 +1,651 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+// Package opaquehttp exposes OPAQUE registration, login, and password change over HTTP, with handlers for the server
+// side of the six exchanges: register-start, register-finish, login-start, login-finish, password-start, and
+// password-finish. Every exchange is a POST whose request and response are either raw, with the message in the body
+// and the other fields in headers, or JSON, as chosen by the request's Content-Type. Client runs the matching client
+// side.
+package opaquehttp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bytemare/opaque"
+	"github.com/bytemare/opaque/internal"
+	"github.com/bytemare/opaque/internal/encoding"
+)
+
+// Paths of the endpoints served by a Handler, relative to where it's mounted.
+const (
+	PathRegisterStart  = "/register/start"
+	PathRegisterFinish = "/register/finish"
+	PathLoginStart     = "/login/start"
+	PathLoginFinish    = "/login/finish"
+
+	PathPasswordChangeStart  = "/password/start"
+	PathPasswordChangeFinish = "/password/finish"
+
+	defaultStateLifetime = time.Minute
+	sessionLength        = 32
+	sealingKeyLength     = 32
+)
+
+var (
+	// ErrBadRequest indicates that a request is malformed, or holds an invalid message.
+	ErrBadRequest = errors.New("malformed request")
+
+	// ErrUnsupportedMediaType indicates that a request is neither raw nor JSON.
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+	// ErrRecordExists indicates that a registration was attempted for a credential identifier that already has a
+	// record. It's the error returned by RecordStore.Create.
+	ErrRecordExists = opaque.ErrRecordExists
+
+	// ErrRecordChanged indicates that a password change was attempted in a login session whose record has since been
+	// replaced, e.g. by another password change.
+	ErrRecordChanged = opaque.ErrRecordChanged
+
+	// ErrAuthentication indicates that a login or a password change failed, because the client could not be
+	// authenticated, or the login session is unknown, expired, or not finished.
+	ErrAuthentication = errors.New("authentication failed")
+
+	errBodyTooLarge                = errors.New("request body is too large")
+	errMissingCredentialIdentifier = errors.New("missing credential identifier")
+	errMissingSession              = errors.New("missing login session")
+	errSessionFinished             = errors.New("login session has already finished")
+	errLoginStateLength            = errors.New("invalid login state length")
+	errInternal                    = errors.New("internal server error")
+	errHandlerConfig               = errors.New(
+		"handler configuration must have a server, either keys or a keyring, and a record store")
+)
+
+// Config holds the parameters of a Handler.
+type Config struct {
+	// Server runs the protocol, and must be set.
+	Server *opaque.Server
+
+	// Keys is the server's key material. Either Keys or Keyring must be set.
+	Keys *opaque.ServerKeyMaterial
+
+	// KeyVersion is the version of Keys, stored in the records registered and changed through the handler, as with an
+	// opaque.ServerKeyring.
+	KeyVersion uint32
+
+	// Keyring holds the server's versioned key material, instead of Keys. Logins use the key material of the client's
+	// record, and registrations and password changes the current one. Clients whose record NeedsReRegistration are
+	// told so in the HeaderReRegister header of the login-finish response, and register again by changing their
+	// password, possibly to the same one, in that login session. Registrations are stored under the version that's
+	// current at register-finish, so key versions should not be added while registrations are in flight.
+	Keyring *opaque.ServerKeyring
+
+	// Records stores the client records, and must be set.
+	Records opaque.RecordStore
+
+	// States holds the login states between login-start and login-finish, and the finished ones until they're used
+	// for a password change. It defaults to a MemoryStateStore, which requires all requests of a login session to
+	// reach the same process.
+	States StateStore
+
+	// SealingKey encrypts and authenticates the login states with Server.SealState before they're given to States, as
+	// they hold the session's secrets. It must be at least 32 bytes long, and be shared by the handlers sharing a
+	// StateStore. It defaults to a random key, with which only this Handler can open its states.
+	SealingKey []byte
+
+	// ServerIdentity is the optional server identity used in logins.
+	ServerIdentity []byte
+
+	// FakeRecordSeed optionally makes responses to unknown credential identifiers stable, as in Server.GetRecord.
+	FakeRecordSeed []byte
+
+	// StateLifetime is the time a client has to finish a login, and then to change its password in the login session.
+	// It defaults to a minute.
+	StateLifetime time.Duration
+
+	// OnLogin is called on successful logins, with the credential identifier and the finished login state, e.g. to
+	// derive the session's keys with Server.Exporter and to open an application session. It must write the response.
+	// If nil, the response is 204 No Content.
+	OnLogin func(w http.ResponseWriter, r *http.Request, credentialIdentifier []byte, state *opaque.ServerLoginState)
+
+	// OnError, if set, is called with the errors that result in a 500 Internal Server Error, whose details are not
+	// sent to the client.
+	OnError func(r *http.Request, err error)
+}
+
+// Handler serves the OPAQUE endpoints. Registration endpoints accept any client, and should be wrapped in the
+// application's authorization middleware, e.g. to only allow enrollment of invited users. Password changes are
+// authenticated by the client's login session.
+type Handler struct {
+	config Config
+	mux    *http.ServeMux
+}
+
+// NewHandler returns a Handler for the configuration, serving the endpoints at their paths.
+func NewHandler(config *Config) (*Handler, error) {
+	if config == nil || config.Server == nil || config.Records == nil ||
+		(config.Keys == nil) == (config.Keyring == nil) {
+		return nil, errHandlerConfig
+	}
+
+	h := &Handler{config: *config, mux: http.NewServeMux()}
+
+	switch {
+	case len(h.config.SealingKey) == 0:
+		h.config.SealingKey = internal.RandomBytes(sealingKeyLength)
+	case len(h.config.SealingKey) < sealingKeyLength:
+		return nil, opaque.ErrInvalidSealingKey
+	default:
+		h.config.SealingKey = append([]byte(nil), h.config.SealingKey...)
+	}
+
+	if h.config.States == nil {
+		h.config.States = NewMemoryStateStore()
+	}
+
+	if h.config.StateLifetime <= 0 {
+		h.config.StateLifetime = defaultStateLifetime
+	}
+
+	h.mux.Handle(PathRegisterStart, h.RegisterStart())
+	h.mux.Handle(PathRegisterFinish, h.RegisterFinish())
+	h.mux.Handle(PathLoginStart, h.LoginStart())
+	h.mux.Handle(PathLoginFinish, h.LoginFinish())
+	h.mux.Handle(PathPasswordChangeStart, h.PasswordChangeStart())
+	h.mux.Handle(PathPasswordChangeFinish, h.PasswordChangeFinish())
+
+	return h, nil
+}
+
+// ServeHTTP dispatches the request to the endpoint of its path.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// exchange handles a request payload, and returns the response payload, which has no body if it has no message, or
+// nil if the exchange wrote the response itself.
+type exchange func(w http.ResponseWriter, r *http.Request, request *payload) (*payload, error)
+
+// endpoint returns a handler decoding the request, running the exchange, and encoding its response in the format of
+// the request.
+func (h *Handler) endpoint(status int, run exchange) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		f, ok := formatOf(r.Header.Get("Content-Type"))
+		if !ok {
+			h.fail(w, r, ErrUnsupportedMediaType)
+			return
+		}
+
+		request, err := decodePayload(f, r.Header, r.Body)
+		if err != nil {
+			if !errors.Is(err, errBodyTooLarge) {
+				err = badRequest(err)
+			}
+
+			h.fail(w, r, err)
+
+			return
+		}
+
+		response, err := run(w, r, request)
+		if err != nil {
+			h.fail(w, r, err)
+			return
+		}
+
+		if response == nil {
+			return
+		}
+
+		if response.message == nil {
+			w.WriteHeader(status)
+			return
+		}
+
+		body, err := response.encode(f, w.Header())
+		if err != nil {
+			h.fail(w, r, err)
+			return
+		}
+
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
+	})
+}
+
+// statusOf maps errors to the status of their response.
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, ErrBadRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUnsupportedMediaType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrRecordExists), errors.Is(err, ErrRecordChanged):
+		return http.StatusConflict
+	case errors.Is(err, ErrAuthentication):
+		return http.StatusUnauthorized
+	case errors.Is(err, errBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// fail writes the error response. Internal errors are only given to OnError.
+func (h *Handler) fail(w http.ResponseWriter, r *http.Request, err error) {
+	status := statusOf(err)
+	if status == http.StatusInternalServerError {
+		if h.config.OnError != nil {
+			h.config.OnError(r, err)
+		}
+
+		err = errInternal
+	}
+
+	http.Error(w, err.Error(), status)
+}
+
+func badRequest(err error) error {
+	return fmt.Errorf("%w: %v", ErrBadRequest, err)
+}
+
+// RegisterStart returns the handler of register-start, which takes the credential identifier and the
+// RegistrationRequest, and responds with the RegistrationResponse.
+func (h *Handler) RegisterStart() http.Handler {
+	return h.endpoint(http.StatusOK, func(_ http.ResponseWriter, _ *http.Request, p *payload) (*payload, error) {
+		if len(p.credentialIdentifier) == 0 {
+			return nil, badRequest(errMissingCredentialIdentifier)
+		}
+
+		request, err := h.config.Server.Deserialize.RegistrationRequest(p.message)
+		if err != nil {
+			return nil, badRequest(err)
+		}
+
+		_, keys := h.currentKeys()
+
+		response, err := h.config.Server.RegistrationResponse(request, keys, p.credentialIdentifier)
+		if err != nil {
+			return nil, err
+		}
+
+		return &payload{message: response.Serialize()}, nil
+	})
+}
+
+// RegisterFinish returns the handler of register-finish, which takes the credential identifier, the optional client
+// identity, and the RegistrationRecord, and stores the client record. It fails with 409 Conflict if a record already
+// exists for the credential identifier.
+func (h *Handler) RegisterFinish() http.Handler {
+	return h.endpoint(http.StatusCreated, func(_ http.ResponseWriter, _ *http.Request, p *payload) (*payload, error) {
+		if len(p.credentialIdentifier) == 0 {
+			return nil, badRequest(errMissingCredentialIdentifier)
+		}
+
+		record, err := h.config.Server.Deserialize.RegistrationRecord(p.message)
+		if err != nil {
+			return nil, badRequest(err)
+		}
+
+		version, _ := h.currentKeys()
+
+		if err := h.config.Records.Create(&opaque.ClientRecord{
+			CredentialIdentifier: p.credentialIdentifier,
+			ClientIdentity:       p.clientIdentity,
+			RegistrationRecord:   record,
+			KeyVersion:           version,
+		}); err != nil {
+			return nil, err
+		}
+
+		return &payload{}, nil
+	})
+}
+
+// LoginStart returns the handler of login-start, which takes the credential identifier and KE1, and responds with
+// the login session identifier and KE2. Unknown credential identifiers get a response from a fake record, and fail
+// in login-finish.
+func (h *Handler) LoginStart() http.Handler {
+	return h.endpoint(http.StatusOK, func(_ http.ResponseWriter, _ *http.Request, p *payload) (*payload, error) {
+		if len(p.credentialIdentifier) == 0 {
+			return nil, badRequest(errMissingCredentialIdentifier)
+		}
+
+		ke1, err := h.config.Server.Deserialize.KE1(p.message)
+		if err != nil {
+			return nil, badRequest(err)
+		}
+
+		record, err := h.config.Server.GetRecord(h.config.Records, p.credentialIdentifier, h.config.FakeRecordSeed)
+		if err != nil {
+			return nil, err
+		}
+
+		keys, err := h.recordKeys(record)
+		if err != nil {
+			return nil, err
+		}
+
+		ke2, state, err := h.config.Server.LoginInit(ke1, h.config.ServerIdentity, keys, record)
+		if err != nil {
+			return nil, err
+		}
+
+		login := &loginSession{
+			credentialIdentifier: p.credentialIdentifier,
+			recordDigest:         recordDigest(record),
+			state:                state,
+		}
+		session := base64.RawURLEncoding.EncodeToString(internal.RandomBytes(sessionLength))
+
+		if err := h.putLogin(session, login); err != nil {
+			return nil, err
+		}
+
+		return &payload{session: session, message: ke2.Serialize()}, nil
+	})
+}
+
+// LoginFinish returns the handler of login-finish, which takes the login session identifier and KE3, and calls
+// OnLogin if the client is authenticated. It fails with 401 Unauthorized otherwise. The login session can then be
+// used for a password change, until StateLifetime has passed. If the client's record NeedsReRegistration, the
+// response has the HeaderReRegister header.
+func (h *Handler) LoginFinish() http.Handler {
+	return h.endpoint(http.StatusNoContent, func(w http.ResponseWriter, r *http.Request, p *payload) (*payload, error) {
+		if p.session == "" {
+			return nil, badRequest(errMissingSession)
+		}
+
+		ke3, err := h.config.Server.Deserialize.KE3(p.message)
+		if err != nil {
+			return nil, badRequest(err)
+		}
+
+		login, err := h.takeLogin(p.session)
+		if err != nil {
+			return nil, err
+		}
+
+		// A finished login session can't be finished again, e.g. with a replayed KE3.
+		if login.state.Finished() {
+			return nil, fmt.Errorf("%w: %v", ErrAuthentication, errSessionFinished)
+		}
+
+		if err := h.config.Server.LoginFinish(ke3, login.state); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrAuthentication, err)
+		}
+
+		// The finished state is kept for a password change in this login session.
+		if err := h.putLogin(p.session, login); err != nil {
+			return nil, err
+		}
+
+		reRegister, err := h.needsReRegistration(login)
+		if err != nil {
+			return nil, err
+		}
+
+		if reRegister {
+			w.Header().Set(HeaderReRegister, "true")
+		}
+
+		if h.config.OnLogin == nil {
+			return &payload{}, nil
+		}
+
+		h.config.OnLogin(w, r, login.credentialIdentifier, login.state)
+
+		return nil, nil
+	})
+}
+
+// PasswordChangeStart returns the handler of password-start, which takes the identifier of a finished login session
+// and the RegistrationRequest for the new password, and responds with the PasswordChangeResponse, authenticated with
+// the login session's key and registering the new record under the current key material. It fails with 401
+// Unauthorized if the login session is unknown, expired, or not finished, and with 409 Conflict if the client's
+// record has changed since the login.
+func (h *Handler) PasswordChangeStart() http.Handler {
+	return h.endpoint(http.StatusOK, func(_ http.ResponseWriter, _ *http.Request, p *payload) (*payload, error) {
+		if p.session == "" {
+			return nil, badRequest(errMissingSession)
+		}
+
+		request, err := h.config.Server.Deserialize.RegistrationRequest(p.message)
+		if err != nil {
+			return nil, badRequest(err)
+		}
+
+		login, record, err := h.finishedLogin(p.session)
+		if err != nil {
+			return nil, err
+		}
+
+		version, keys := h.currentKeys()
+
+		response, err := h.config.Server.PasswordChangeResponse(request, login.state, keys, record)
+		if err != nil {
+			return nil, err
+		}
+
+		// The key version is kept for password-finish, as the current one may change in-between.
+		login.keyVersion = version
+
+		// The login session is kept for password-finish.
+		if err := h.putLogin(p.session, login); err != nil {
+			return nil, err
+		}
+
+		return &payload{message: response.Serialize()}, nil
+	})
+}
+
+// PasswordChangeFinish returns the handler of password-finish, which takes the identifier of the login session and
+// the PasswordChangeRecord, and replaces the client's record with the new one. It fails like password-start, and with
+// 401 Unauthorized if the record is not authenticated with the login session's key. The login session can't be used
+// anymore afterwards.
+func (h *Handler) PasswordChangeFinish() http.Handler {
+	return h.endpoint(http.StatusNoContent, func(_ http.ResponseWriter, _ *http.Request, p *payload) (*payload, error) {
+		if p.session == "" {
+			return nil, badRequest(errMissingSession)
+		}
+
+		upload, err := h.config.Server.Deserialize.PasswordChangeRecord(p.message)
+		if err != nil {
+			return nil, badRequest(err)
+		}
+
+		login, record, err := h.finishedLogin(p.session)
+		if err != nil {
+			return nil, err
+		}
+
+		server := h.config.Server
+
+		_, err = server.PasswordChangeFinish(upload, login.state, record, login.keyVersion, h.config.Records)
+		if errors.Is(err, opaque.ErrPasswordChangeAuthentication) {
+			return nil, fmt.Errorf("%w: %v", ErrAuthentication, err)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &payload{}, nil
+	})
+}
+
+// loginSession is what's kept of a login session between requests: the credential identifier, the digest of the
+// record the client logs in with, the key version of a started password change, and the server's login state.
+type loginSession struct {
+	credentialIdentifier []byte
+	recordDigest         []byte
+	keyVersion           uint32
+	state                *opaque.ServerLoginState
+}
+
+// currentKeys returns the key material of registrations and password changes, and its version.
+func (h *Handler) currentKeys() (uint32, *opaque.ServerKeyMaterial) {
+	if h.config.Keyring != nil {
+		return h.config.Keyring.Current()
+	}
+
+	return h.config.KeyVersion, h.config.Keys
+}
+
+// recordKeys returns the key material to log in with the record.
+func (h *Handler) recordKeys(record *opaque.ClientRecord) (*opaque.ServerKeyMaterial, error) {
+	if h.config.Keyring != nil {
+		return h.config.Keyring.ForRecord(record)
+	}
+
+	return h.config.Keys, nil
+}
+
+// needsReRegistration returns whether the record of the finished login session NeedsReRegistration.
+func (h *Handler) needsReRegistration(login *loginSession) (bool, error) {
+	if h.config.Keyring == nil {
+		return false, nil
+	}
+
+	record, err := h.config.Records.Get(login.credentialIdentifier)
+	if errors.Is(err, opaque.ErrRecordNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return h.config.Keyring.NeedsReRegistration(record), nil
+}
+
+// recordDigest returns a digest of the record, to later verify that it has not changed without storing it along the
+// login state.
+func recordDigest(record *opaque.ClientRecord) []byte {
+	version := make([]byte, 4)
+	binary.BigEndian.PutUint32(version, record.KeyVersion)
+
+	digest := sha256.Sum256(encoding.Concat3(
+		version,
+		encoding.EncodeVector(record.ClientIdentity),
+		record.RegistrationRecord.Serialize(),
+	))
+
+	return digest[:]
+}
+
+// putLogin seals the login state, and stores the login session under the session identifier for StateLifetime.
+func (h *Handler) putLogin(session string, login *loginSession) error {
+	expiry := time.Now().Add(h.config.StateLifetime)
+
+	sealed, err := h.config.Server.SealState(login.state, h.config.SealingKey, login.credentialIdentifier, expiry)
+	if err != nil {
+		return err
+	}
+
+	version := make([]byte, 4)
+	binary.BigEndian.PutUint32(version, login.keyVersion)
+
+	stored := encoding.Concatenate(
+		encoding.EncodeVector(login.credentialIdentifier),
+		encoding.EncodeVector(login.recordDigest),
+		version,
+		sealed,
+	)
+
+	return h.config.States.Put(session, stored, expiry)
+}
+
+// takeLogin removes and returns the login session stored under the session identifier. Sessions that are unknown,
+// expired, or can't be opened, e.g. sealed by a handler with another key, fail with ErrAuthentication.
+func (h *Handler) takeLogin(session string) (*loginSession, error) {
+	stored, err := h.config.States.Take(session)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, fmt.Errorf("%w: %v", ErrAuthentication, err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	credentialIdentifier, offset, err := encoding.DecodeVector(stored)
+	if err != nil {
+		return nil, fmt.Errorf("decoding login state: %w", err)
+	}
+
+	digest, length, err := encoding.DecodeVector(stored[offset:])
+	if err != nil {
+		return nil, fmt.Errorf("decoding login state: %w", err)
+	}
+
+	offset += length
+
+	if len(stored) < offset+4 {
+		return nil, fmt.Errorf("decoding login state: %w", errLoginStateLength)
+	}
+
+	version := binary.BigEndian.Uint32(stored[offset:])
+	offset += 4
+
+	state, err := h.config.Server.OpenState(stored[offset:], h.config.SealingKey, credentialIdentifier)
+	if errors.Is(err, opaque.ErrInvalidSealedState) || errors.Is(err, opaque.ErrSealedStateExpired) {
+		return nil, fmt.Errorf("%w: %v", ErrAuthentication, err)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("opening login state: %w", err)
+	}
+
+	return &loginSession{
+		credentialIdentifier: credentialIdentifier,
+		recordDigest:         digest,
+		keyVersion:           version,
+		state:                state,
+	}, nil
+}
+
+// finishedLogin removes and returns the login session stored under the session identifier, which must have
+// successfully finished, and the client's record, which must still be the one the client logged in with.
+func (h *Handler) finishedLogin(session string) (*loginSession, *opaque.ClientRecord, error) {
+	login, err := h.takeLogin(session)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !login.state.Finished() {
+		return nil, nil, fmt.Errorf("%w: %v", ErrAuthentication, opaque.ErrLoginNotFinished)
+	}
+
+	record, err := h.config.Records.Get(login.credentialIdentifier)
+	if errors.Is(err, opaque.ErrRecordNotFound) {
+		return nil, nil, fmt.Errorf("%w: %v", ErrRecordChanged, err)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !bytes.Equal(recordDigest(record), login.recordDigest) {
+		return nil, nil, ErrRecordChanged
+	}
+
+	return login, record, nil
+}
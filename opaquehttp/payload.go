@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaquehttp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+const (
+	// ContentTypeRaw is the media type of exchanges carrying the binary encoding of the messages in the body, and the
+	// other fields in headers.
+	ContentTypeRaw = "application/octet-stream"
+
+	// ContentTypeJSON is the media type of exchanges carrying a JSON object with base64url encoded fields.
+	ContentTypeJSON = "application/json"
+
+	// HeaderCredentialIdentifier holds the base64url encoded credential identifier of raw exchanges.
+	HeaderCredentialIdentifier = "Opaque-Credential-Identifier"
+
+	// HeaderClientIdentity holds the base64url encoded client identity of raw exchanges.
+	HeaderClientIdentity = "Opaque-Client-Identity"
+
+	// HeaderSession holds the login session identifier of raw exchanges.
+	HeaderSession = "Opaque-Session"
+
+	// HeaderReRegister is set to "true" in login-finish responses of clients whose record NeedsReRegistration, in any
+	// format.
+	HeaderReRegister = "Opaque-Re-Register"
+
+	// maxBodyLength bounds the size of request bodies, which is way above the size of any message.
+	maxBodyLength = 1 << 16
+)
+
+var errMissingMessage = errors.New("missing message")
+
+// format is the encoding of an exchange.
+type format byte
+
+const (
+	formatRaw format = iota + 1
+	formatJSON
+)
+
+func (f format) contentType() string {
+	if f == formatJSON {
+		return ContentTypeJSON
+	}
+
+	return ContentTypeRaw
+}
+
+// formatOf returns the format of the media type, and false if it's not supported.
+func formatOf(contentType string) (format, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return 0, false
+	}
+
+	switch mediaType {
+	case ContentTypeRaw:
+		return formatRaw, true
+	case ContentTypeJSON:
+		return formatJSON, true
+	default:
+		return 0, false
+	}
+}
+
+// payload is the content of a request or a response.
+type payload struct {
+	credentialIdentifier []byte
+	clientIdentity       []byte
+	session              string
+	message              []byte
+
+	// reRegister is whether a login-finish response has the HeaderReRegister header.
+	reRegister bool
+}
+
+// jsonPayload is the JSON representation of a payload.
+type jsonPayload struct {
+	CredentialIdentifier string `json:"credentialIdentifier,omitempty"`
+	ClientIdentity       string `json:"clientIdentity,omitempty"`
+	Session              string `json:"session,omitempty"`
+	Message              string `json:"message,omitempty"`
+}
+
+// encode returns the body of the payload in the format, and sets the headers it needs.
+func (p *payload) encode(f format, header http.Header) ([]byte, error) {
+	header.Set("Content-Type", f.contentType())
+
+	if f == formatJSON {
+		return json.Marshal(&jsonPayload{
+			CredentialIdentifier: base64.RawURLEncoding.EncodeToString(p.credentialIdentifier),
+			ClientIdentity:       base64.RawURLEncoding.EncodeToString(p.clientIdentity),
+			Session:              p.session,
+			Message:              base64.RawURLEncoding.EncodeToString(p.message),
+		})
+	}
+
+	if len(p.credentialIdentifier) != 0 {
+		header.Set(HeaderCredentialIdentifier, base64.RawURLEncoding.EncodeToString(p.credentialIdentifier))
+	}
+
+	if len(p.clientIdentity) != 0 {
+		header.Set(HeaderClientIdentity, base64.RawURLEncoding.EncodeToString(p.clientIdentity))
+	}
+
+	if p.session != "" {
+		header.Set(HeaderSession, p.session)
+	}
+
+	return p.message, nil
+}
+
+// decodePayload reads a payload in the format from the headers and the body.
+func decodePayload(f format, header http.Header, body io.Reader) (*payload, error) {
+	content, err := io.ReadAll(io.LimitReader(body, maxBodyLength+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading body: %w", err)
+	}
+
+	if len(content) > maxBodyLength {
+		return nil, errBodyTooLarge
+	}
+
+	var fields jsonPayload
+
+	if f == formatJSON {
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+
+		if err := decoder.Decode(&fields); err != nil {
+			return nil, fmt.Errorf("decoding JSON: %w", err)
+		}
+	} else {
+		fields = jsonPayload{
+			CredentialIdentifier: header.Get(HeaderCredentialIdentifier),
+			ClientIdentity:       header.Get(HeaderClientIdentity),
+			Session:              header.Get(HeaderSession),
+			Message:              base64.RawURLEncoding.EncodeToString(content),
+		}
+	}
+
+	p := &payload{session: fields.Session}
+
+	for _, field := range []struct {
+		name    string
+		encoded string
+		out     *[]byte
+	}{
+		{"credential identifier", fields.CredentialIdentifier, &p.credentialIdentifier},
+		{"client identity", fields.ClientIdentity, &p.clientIdentity},
+		{"message", fields.Message, &p.message},
+	} {
+		if *field.out, err = base64.RawURLEncoding.DecodeString(field.encoded); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", field.name, err)
+		}
+	}
+
+	if len(p.message) == 0 {
+		return nil, errMissingMessage
+	}
+
+	return p, nil
+}
@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaquehttp
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// memoryStateSweepInterval is the minimum time between two removals of all expired states from a MemoryStateStore.
+const memoryStateSweepInterval = time.Minute
+
+// ErrSessionNotFound indicates that there is no login state for the session, because it never existed, has already
+// been used, or has expired.
+var ErrSessionNotFound = errors.New("login session not found")
+
+// StateStore holds the server login states between login-start and login-finish, keyed by a random session
+// identifier. States are single use, and implementations must be safe for concurrent use.
+type StateStore interface {
+	// Put stores the state under the session identifier until expiry.
+	Put(session string, state []byte, expiry time.Time) error
+
+	// Take removes and returns the state stored under the session identifier, or ErrSessionNotFound if there is none
+	// or it has expired.
+	Take(session string) ([]byte, error)
+}
+
+type memoryState struct {
+	expiry time.Time
+	state  []byte
+}
+
+// MemoryStateStore is an in-memory StateStore, for servers that handle both steps of a login in the same process.
+// Expired states are never returned, and the ones of abandoned logins are dropped at most once a minute, when new
+// states are stored.
+type MemoryStateStore struct {
+	states    map[string]memoryState
+	nextSweep time.Time
+	mutex     sync.Mutex
+}
+
+// NewMemoryStateStore returns a new, empty, in-memory StateStore.
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{states: make(map[string]memoryState)}
+}
+
+// Put stores a copy of the state under the session identifier until expiry.
+func (m *MemoryStateStore) Put(session string, state []byte, expiry time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if now := time.Now(); now.After(m.nextSweep) {
+		for id, s := range m.states {
+			if now.After(s.expiry) {
+				delete(m.states, id)
+			}
+		}
+
+		m.nextSweep = now.Add(memoryStateSweepInterval)
+	}
+
+	m.states[session] = memoryState{expiry: expiry, state: append([]byte(nil), state...)}
+
+	return nil
+}
+
+// Take removes and returns the state stored under the session identifier, or ErrSessionNotFound if there is none or
+// it has expired.
+func (m *MemoryStateStore) Take(session string) ([]byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	s, ok := m.states[session]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	delete(m.states, session)
+
+	if time.Now().After(s.expiry) {
+		return nil, ErrSessionNotFound
+	}
+
+	return s.state, nil
+}
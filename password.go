@@ -0,0 +1,219 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque
+
+import (
+	"errors"
+
+	"github.com/bytemare/opaque/internal"
+	"github.com/bytemare/opaque/internal/tag"
+	"github.com/bytemare/opaque/message"
+)
+
+var (
+	// ErrPasswordChangeAuthentication indicates that the password change record is not authenticated with the key of
+	// the login session, e.g. because it has been swapped in transit or comes from another session.
+	ErrPasswordChangeAuthentication = errors.New("password change record authentication failed")
+
+	// ErrPasswordChangeResponseAuthentication indicates that the password change response is not authenticated with
+	// the key of the login session, e.g. because it has been swapped in transit, so that its server public key can't
+	// be trusted.
+	ErrPasswordChangeResponseAuthentication = errors.New("password change response authentication failed")
+
+	// ErrLoginNotFinished indicates that a login state that did not successfully finish was given where a finished
+	// login session is required, e.g. to change the password or export keys.
+	ErrLoginNotFinished = errors.New("login has not successfully finished")
+
+	errPasswordChangeStateMissing = errors.New("missing client password change state")
+)
+
+// ClientPasswordChangeState holds the client's state of a single password change, between PasswordChangeInit and
+// PasswordChangeFinalize.
+type ClientPasswordChangeState struct {
+	registration *ClientRegistrationState
+	sessionKey   []byte
+	oldExportKey []byte
+}
+
+// OldExportKey returns the export key of the login the password change happens in, derived from the old password, so
+// that the client can re-wrap data protected with it under the new export key.
+func (s *ClientPasswordChangeState) OldExportKey() []byte {
+	return s.oldExportKey
+}
+
+// passwordChangeMac returns the MAC authenticating the record with the login session key.
+func passwordChangeMac(conf *internal.Configuration, sessionKey []byte, record *message.RegistrationRecord) []byte {
+	macKey := conf.KDF.Expand(sessionKey, []byte(tag.PasswordChange), conf.KDF.Size())
+	return conf.MAC.MAC(macKey, record.Serialize())
+}
+
+// passwordChangeResponseMac returns the MAC authenticating the response with the login session key.
+func passwordChangeResponseMac(
+	conf *internal.Configuration,
+	sessionKey []byte,
+	response *message.RegistrationResponse,
+) []byte {
+	macKey := conf.KDF.Expand(sessionKey, []byte(tag.PasswordChangeResponse), conf.KDF.Size())
+	return conf.MAC.MAC(macKey, response.Serialize())
+}
+
+// PasswordChangeInit starts changing the password to newPassword, within the login session of the given state, which
+// must have been successfully finished with LoginFinish. The returned RegistrationRequest is to be sent to the server,
+// and the state given to PasswordChangeFinalize.
+func (c *Client) PasswordChangeInit(
+	newPassword []byte,
+	login *ClientLoginState,
+) (*message.RegistrationRequest, *ClientPasswordChangeState, error) {
+	if login == nil || !login.finalized {
+		return nil, nil, ErrLoginNotFinished
+	}
+
+	request, registration := c.RegistrationInit(newPassword)
+
+	return request, &ClientPasswordChangeState{
+		registration: registration,
+		sessionKey:   login.SessionKey(),
+		oldExportKey: login.ExportKey(),
+	}, nil
+}
+
+// PasswordChangeFinalize verifies that the server's response is authenticated with the login session key, and returns
+// the PasswordChangeRecord message, authenticated with the same key, and the new export key. The response's server
+// public key is then trusted, even if it's not the one of the login, e.g. after a rotation of the server's keys.
+func (c *Client) PasswordChangeFinalize(
+	resp *message.PasswordChangeResponse,
+	clientIdentity, serverIdentity []byte,
+	state *ClientPasswordChangeState,
+) (upload *message.PasswordChangeRecord, exportKey []byte, err error) {
+	if state == nil || state.registration == nil {
+		return nil, nil, errPasswordChangeStateMissing
+	}
+
+	if resp == nil || resp.RegistrationResponse == nil {
+		return nil, nil, ErrPasswordChangeResponseAuthentication
+	}
+
+	expected := passwordChangeResponseMac(c.conf, state.sessionKey, resp.RegistrationResponse)
+	if !c.conf.MAC.Equal(expected, resp.Mac) {
+		return nil, nil, ErrPasswordChangeResponseAuthentication
+	}
+
+	record, exportKey, err := c.RegistrationFinalize(
+		resp.RegistrationResponse,
+		clientIdentity,
+		serverIdentity,
+		state.registration,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &message.PasswordChangeRecord{
+		RegistrationRecord: record,
+		Mac:                passwordChangeMac(c.conf, state.sessionKey, record),
+	}, exportKey, nil
+}
+
+// PasswordChangeResponse returns the PasswordChangeResponse message to a password change request for the client's
+// record, in the login session of the state, which must have been successfully finished with LoginFinish. The new
+// record is registered under the given key material, whose version is then given to PasswordChangeFinish.
+func (s *Server) PasswordChangeResponse(
+	req *message.RegistrationRequest,
+	state *ServerLoginState,
+	keys *ServerKeyMaterial,
+	record *ClientRecord,
+) (*message.PasswordChangeResponse, error) {
+	if state == nil || state.ServerState == nil {
+		return nil, ErrNoState
+	}
+
+	if !state.Finished() {
+		return nil, ErrLoginNotFinished
+	}
+
+	if err := verifyRecord(record); err != nil {
+		return nil, err
+	}
+
+	response, err := s.RegistrationResponse(req, keys, record.CredentialIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	return &message.PasswordChangeResponse{
+		RegistrationResponse: response,
+		Mac:                  passwordChangeResponseMac(s.conf, state.SessionKey(), response),
+	}, nil
+}
+
+// PasswordChangeResponseWithKeyring is like PasswordChangeResponse, but registers the new record under the keyring's
+// current key material, and also returns its version. It's how a client whose record NeedsReRegistration registers
+// again, after a successful login, by changing its password, possibly to the same one.
+func (s *Server) PasswordChangeResponseWithKeyring(
+	req *message.RegistrationRequest,
+	state *ServerLoginState,
+	keyring *ServerKeyring,
+	record *ClientRecord,
+) (*message.PasswordChangeResponse, uint32, error) {
+	version, keys := keyring.Current()
+
+	response, err := s.PasswordChangeResponse(req, state, keys, record)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return response, version, nil
+}
+
+// PasswordChangeFinish verifies that the password change record is authenticated with the key of the login session,
+// and atomically replaces the client's record in the store with the new one, which it returns. keyVersion is the
+// version of the key material given to PasswordChangeResponse, and is stored in the new record. It returns
+// ErrLoginNotFinished if LoginFinish didn't succeed with the state, as the client is only authenticated then, and
+// ErrRecordChanged if the stored record is not the one the client logged in with anymore.
+func (s *Server) PasswordChangeFinish(
+	upload *message.PasswordChangeRecord,
+	state *ServerLoginState,
+	record *ClientRecord,
+	keyVersion uint32,
+	store RecordStore,
+) (*ClientRecord, error) {
+	if state == nil || state.ServerState == nil {
+		return nil, ErrNoState
+	}
+
+	if !state.Finished() {
+		return nil, ErrLoginNotFinished
+	}
+
+	if upload == nil || upload.RegistrationRecord == nil {
+		return nil, errRecordNil
+	}
+
+	expected := passwordChangeMac(s.conf, state.SessionKey(), upload.RegistrationRecord)
+	if !s.conf.MAC.Equal(expected, upload.Mac) {
+		return nil, ErrPasswordChangeAuthentication
+	}
+
+	if err := verifyRecord(record); err != nil {
+		return nil, err
+	}
+
+	updated := &ClientRecord{
+		CredentialIdentifier: record.CredentialIdentifier,
+		ClientIdentity:       record.ClientIdentity,
+		RegistrationRecord:   upload.RegistrationRecord,
+		KeyVersion:           keyVersion,
+	}
+
+	if err := store.Replace(record, updated); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
@@ -0,0 +1,222 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/bytemare/opaque/internal/encoding"
+)
+
+// clientRecordVersion is the version of the client record encoding.
+const clientRecordVersion byte = 1
+
+var (
+	// ErrRecordVersion indicates that the encoded client record has an unsupported version.
+	ErrRecordVersion = errors.New("unsupported client record version")
+
+	// ErrRecordConfiguration indicates that the encoded client record was created under another configuration.
+	ErrRecordConfiguration = errors.New("client record was created under a different configuration")
+
+	errRecordEncoding        = errors.New("invalid client record encoding")
+	errRecordNoConfiguration = errors.New("missing client record configuration")
+)
+
+// clientRecordJSON is the JSON representation of a ClientRecord, with base64url encoded values.
+type clientRecordJSON struct {
+	Version              byte   `json:"version"`
+	Configuration        string `json:"configuration"`
+	CredentialIdentifier string `json:"credential_identifier"`
+	ClientIdentity       string `json:"client_identity,omitempty"`
+	RegistrationRecord   string `json:"registration_record"`
+	KeyVersion           uint32 `json:"key_version,omitempty"`
+}
+
+// verify returns an error if the record can't have been created under the configuration, i.e. if its group differs
+// or it can't be decoded with the configuration's lengths and AKE group.
+func (c *ClientRecord) verify(conf *Configuration) error {
+	if conf == nil {
+		return errRecordNoConfiguration
+	}
+
+	if err := verifyRecord(c); err != nil {
+		return err
+	}
+
+	d, err := conf.Deserializer()
+	if err != nil {
+		return err
+	}
+
+	if c.RegistrationRecord.G != d.conf.Group {
+		return ErrRecordConfiguration
+	}
+
+	if _, err := d.RegistrationRecord(c.RegistrationRecord.Serialize()); err != nil {
+		return fmt.Errorf("%w: %v", ErrRecordConfiguration, err)
+	}
+
+	return nil
+}
+
+// Serialize returns the versioned byte encoding of the record, including the credential identifier, the client
+// identity, the server key version, and the serialized configuration it was created under. It can be decoded with
+// Deserializer.ClientRecord. The configuration must be the one the record was created under, as the length of the
+// record and its group are the only things that can be verified.
+func (c *ClientRecord) Serialize(conf *Configuration) ([]byte, error) {
+	if err := c.verify(conf); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 5)
+	header[0] = clientRecordVersion
+	binary.BigEndian.PutUint32(header[1:], c.KeyVersion)
+
+	return encoding.Concatenate(
+		header,
+		encoding.EncodeVector(conf.Serialize()),
+		encoding.EncodeVector(c.CredentialIdentifier),
+		encoding.EncodeVector(c.ClientIdentity),
+		encoding.EncodeVector(c.RegistrationRecord.Serialize()),
+	), nil
+}
+
+// SerializeJSON returns the versioned JSON encoding of the record, holding the same values as Serialize. It can be
+// decoded with Deserializer.ClientRecordJSON.
+func (c *ClientRecord) SerializeJSON(conf *Configuration) ([]byte, error) {
+	if err := c.verify(conf); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(&clientRecordJSON{
+		Version:              clientRecordVersion,
+		Configuration:        base64.RawURLEncoding.EncodeToString(conf.Serialize()),
+		CredentialIdentifier: base64.RawURLEncoding.EncodeToString(c.CredentialIdentifier),
+		ClientIdentity:       base64.RawURLEncoding.EncodeToString(c.ClientIdentity),
+		RegistrationRecord:   base64.RawURLEncoding.EncodeToString(c.RegistrationRecord.Serialize()),
+		KeyVersion:           c.KeyVersion,
+	})
+}
+
+func decodeRecordVectors(encoded []byte) (uint32, [][]byte, error) {
+	if len(encoded) == 0 {
+		return 0, nil, errRecordEncoding
+	}
+
+	if encoded[0] != clientRecordVersion {
+		return 0, nil, ErrRecordVersion
+	}
+
+	if len(encoded) < 5 {
+		return 0, nil, errRecordEncoding
+	}
+
+	keyVersion := binary.BigEndian.Uint32(encoded[1:5])
+	in := encoded[5:]
+
+	vectors := make([][]byte, 4)
+
+	for i := range vectors {
+		v, offset, err := encoding.DecodeVector(in)
+		if err != nil {
+			return 0, nil, fmt.Errorf("%w: %v", errRecordEncoding, err)
+		}
+
+		vectors[i] = v
+		in = in[offset:]
+	}
+
+	if len(in) != 0 {
+		return 0, nil, errRecordEncoding
+	}
+
+	return keyVersion, vectors, nil
+}
+
+// RecordConfiguration returns the configuration an encoded client record was created under, e.g. to select the
+// Deserializer to decode it with, or to find records to migrate.
+func RecordConfiguration(encoded []byte) (*Configuration, error) {
+	_, v, err := decodeRecordVectors(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return DeserializeConfiguration(v[0])
+}
+
+func (d *Deserializer) clientRecord(
+	keyVersion uint32,
+	encodedConf, credentialIdentifier, clientIdentity, record []byte,
+) (*ClientRecord, error) {
+	if !bytes.Equal(encodedConf, d.encodedConf) {
+		return nil, ErrRecordConfiguration
+	}
+
+	if len(credentialIdentifier) == 0 {
+		return nil, errRecordNoCredentialID
+	}
+
+	r, err := d.RegistrationRecord(record)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(clientIdentity) == 0 {
+		clientIdentity = nil
+	}
+
+	return &ClientRecord{
+		CredentialIdentifier: credentialIdentifier,
+		ClientIdentity:       clientIdentity,
+		RegistrationRecord:   r,
+		KeyVersion:           keyVersion,
+	}, nil
+}
+
+// ClientRecord takes a record encoded with ClientRecord.Serialize and returns the decoded ClientRecord. It returns
+// ErrRecordConfiguration if the record was created under a different configuration than the Deserializer's.
+func (d *Deserializer) ClientRecord(encoded []byte) (*ClientRecord, error) {
+	keyVersion, v, err := decodeRecordVectors(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.clientRecord(keyVersion, v[0], v[1], v[2], v[3])
+}
+
+// ClientRecordJSON takes a record encoded with ClientRecord.SerializeJSON and returns the decoded ClientRecord. It
+// returns ErrRecordConfiguration if the record was created under a different configuration than the Deserializer's.
+func (d *Deserializer) ClientRecordJSON(encoded []byte) (*ClientRecord, error) {
+	var r clientRecordJSON
+	if err := json.Unmarshal(encoded, &r); err != nil {
+		return nil, fmt.Errorf("%w: %v", errRecordEncoding, err)
+	}
+
+	if r.Version != clientRecordVersion {
+		return nil, ErrRecordVersion
+	}
+
+	values := make([][]byte, 4)
+
+	for i, s := range []string{r.Configuration, r.CredentialIdentifier, r.ClientIdentity, r.RegistrationRecord} {
+		v, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errRecordEncoding, err)
+		}
+
+		values[i] = v
+	}
+
+	return d.clientRecord(r.KeyVersion, values[0], values[1], values[2], values[3])
+}
@@ -9,8 +9,11 @@
 package opaque
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
 	"errors"
-	"fmt"
+	"time"
 
 	"github.com/bytemare/crypto/group"
 
@@ -26,12 +29,16 @@ var (
 	// ErrInvalidServerSecretKey indicates that server's secret key is invalid.
 	ErrInvalidServerSecretKey = errors.New("invalid server secret key")
 
-	// ErrAkeInvalidClientMac indicates that the MAC contained in the KE3 message is not valid in the given session.
+	// ErrAkeInvalidClientMac indicates that the MAC, or the signature in the SigmaI mode, contained in the KE3 message is
+	// not valid in the given session.
 	ErrAkeInvalidClientMac = errors.New("failed to authenticate client: invalid client mac")
 
 	// ErrInvalidState indicates that the given state is not valid due to a wrong length.
 	ErrInvalidState = errors.New("invalid state length")
 
+	// ErrNoState indicates that LoginFinish was called without the state returned by LoginInit.
+	ErrNoState = errors.New("missing server login state")
+
 	// ErrInvalidEnvelopeLength indicates the envelope contained in the record is of invalid length.
 	ErrInvalidEnvelopeLength = errors.New("record has invalid envelope length")
 
@@ -41,11 +48,37 @@ var (
 	// ErrInvalidOPRFSeedLength indicates that the OPRF seed is not of right length.
 	ErrInvalidOPRFSeedLength = errors.New("input OPRF seed length is invalid (must be of hash output length)")
 
+	// ErrInvalidFakeRecordSeedLength indicates that the fake record seed is not of right length.
+	ErrInvalidFakeRecordSeedLength = errors.New("fake record seed length is invalid (must be of hash output length)")
+
 	// ErrZeroSKS indicates that the server's private key is a zero scalar.
 	ErrZeroSKS = errors.New("server private key is zero")
+
+	// ErrInvalidSealingKey indicates that the key used to seal or open a login state is too short.
+	ErrInvalidSealingKey = errors.New("sealing key must be at least 32 bytes")
+
+	// ErrInvalidSealedState indicates that a sealed login state could not be opened, because it is malformed, has been
+	// tampered with, or was sealed under another key or for another credential identifier.
+	ErrInvalidSealedState = errors.New("invalid sealed state")
+
+	// ErrSealedStateExpired indicates that a sealed login state is authentic but has expired.
+	ErrSealedStateExpired = errors.New("sealed state has expired")
+)
+
+const (
+	// sealedStateVersion is the version of the sealed state encoding.
+	sealedStateVersion byte = 1
+
+	// version and expiry timestamp.
+	sealedStateHeaderLength = 1 + 8
+
+	// Flags prefixing the sealed login state, telling whether LoginFinish succeeded with it.
+	sealedStateOpen     byte = 0
+	sealedStateFinished byte = 1
 )
 
-// Server represents an OPAQUE Server, exposing its functions and holding its state.
+// Server represents an OPAQUE Server, exposing its functions. It only holds long-lived configuration and no session
+// state, so that a single instance can safely serve many concurrent registrations and logins.
 type Server struct {
 	Deserialize *Deserializer
 	conf        *internal.Configuration
@@ -64,12 +97,18 @@ func NewServer(c *Configuration) (*Server, error) {
 	}
 
 	return &Server{
-		Deserialize: &Deserializer{conf: conf},
+		Deserialize: &Deserializer{conf: conf, encodedConf: c.Serialize()},
 		conf:        conf,
-		Ake:         ake.NewServer(),
+		Ake:         ake.NewServer(c.akeMode()),
 	}, nil
 }
 
+// ServerLoginState holds the server's state of a single login session, returned by LoginInit. The caller must keep it,
+// in memory or serialized, and give it back to LoginFinish.
+type ServerLoginState struct {
+	*ake.ServerState
+}
+
 // GetConf return the internal configuration.
 func (s *Server) GetConf() *internal.Configuration {
 	return s.conf
@@ -86,21 +125,42 @@ func (s *Server) oprfResponse(element *group.Point, oprfSeed, credentialIdentifi
 	return s.conf.OPRF.Evaluate(ku, element)
 }
 
-// RegistrationResponse returns a RegistrationResponse message to the input RegistrationRequest message and given
-// identifiers.
+// RegistrationResponse returns a RegistrationResponse message to the input RegistrationRequest message, given the
+// server key material and the client's credential identifier.
 func (s *Server) RegistrationResponse(
 	req *message.RegistrationRequest,
-	serverPublicKey *group.Point,
-	credentialIdentifier, oprfSeed []byte,
-) *message.RegistrationResponse {
-	z := s.oprfResponse(req.BlindedMessage, oprfSeed, credentialIdentifier)
+	keys *ServerKeyMaterial,
+	credentialIdentifier []byte,
+) (*message.RegistrationResponse, error) {
+	if err := keys.verify(s.conf); err != nil {
+		return nil, err
+	}
+
+	z := s.oprfResponse(req.BlindedMessage, keys.oprfSeed, credentialIdentifier)
 
 	return &message.RegistrationResponse{
 		C:                s.conf.OPRF,
 		G:                s.conf.Group,
 		EvaluatedMessage: z,
-		Pks:              serverPublicKey,
+		Pks:              keys.publicKey,
+	}, nil
+}
+
+// RegistrationResponseWithKeyring is like RegistrationResponse, but uses the keyring's current key material. It also
+// returns the current key version, which the server must store in the resulting ClientRecord's KeyVersion.
+func (s *Server) RegistrationResponseWithKeyring(
+	req *message.RegistrationRequest,
+	keyring *ServerKeyring,
+	credentialIdentifier []byte,
+) (*message.RegistrationResponse, uint32, error) {
+	version, keys := keyring.Current()
+
+	response, err := s.RegistrationResponse(req, keys, credentialIdentifier)
+	if err != nil {
+		return nil, 0, err
 	}
+
+	return response, version, nil
 }
 
 func (s *Server) credentialResponse(
@@ -127,100 +187,262 @@ func (s *Server) credentialResponse(
 	}
 }
 
-func (s *Server) verifyInitInput(
-	serverSecretKey, serverPublicKey, oprfSeed []byte,
-	record *ClientRecord,
-) (*group.Scalar, error) {
-	sks, err := s.conf.Group.NewScalar().Decode(serverSecretKey)
-	if err != nil {
-		return nil, fmt.Errorf("%v: %w", ErrInvalidServerSecretKey, err)
+func (s *Server) verifyInitInput(keys *ServerKeyMaterial, record *ClientRecord) error {
+	if err := keys.verify(s.conf); err != nil {
+		return err
 	}
 
-	if sks.IsZero() {
-		return nil, ErrZeroSKS
+	if len(record.Envelope) != s.conf.EnvelopeSize {
+		return ErrInvalidEnvelopeLength
 	}
 
-	if len(oprfSeed) != s.conf.Hash.Size() {
-		return nil, ErrInvalidOPRFSeedLength
-	}
+	// The key material has been validated at creation, and we've checked that the client's envelope is of correct
+	// length, thus ensuring that the subsequent xor-ing input is the same length as the encryption pad.
 
-	if len(serverPublicKey) != s.conf.AkePointLength {
-		return nil, ErrInvalidPksLength
+	return nil
+}
+
+// LoginInit responds to a KE1 message with a KE2 message given server key material and client record. It also returns
+// the session state to be given to LoginFinish.
+func (s *Server) LoginInit(
+	ke1 *message.KE1,
+	serverIdentity []byte,
+	keys *ServerKeyMaterial,
+	record *ClientRecord,
+) (*message.KE2, *ServerLoginState, error) {
+	if err := s.verifyInitInput(keys, record); err != nil {
+		return nil, nil, err
 	}
 
-	_, err = s.conf.Group.NewElement().Decode(serverPublicKey)
-	if err != nil {
-		return nil, fmt.Errorf("invalid server public key: %w", err)
+	response := s.credentialResponse(ke1.CredentialRequest, keys.encodedPublicKey,
+		record.RegistrationRecord, record.CredentialIdentifier, keys.oprfSeed, record.TestMaskNonce)
+
+	clientIdentity := record.ClientIdentity
+
+	if clientIdentity == nil {
+		clientIdentity = encoding.SerializePoint(record.PublicKey, s.conf.Group)
 	}
 
-	if len(record.Envelope) != s.conf.EnvelopeSize {
-		return nil, ErrInvalidEnvelopeLength
+	if serverIdentity == nil {
+		serverIdentity = keys.encodedPublicKey
 	}
 
-	// We've checked that the server's public key and the client's envelope are of correct length,
-	// thus ensuring that the subsequent xor-ing input is the same length as the encryption pad.
+	ke2, state, err := s.Ake.Response(
+		s.conf,
+		serverIdentity,
+		keys.secretKey,
+		keys.signer,
+		clientIdentity,
+		record.PublicKey,
+		ke1,
+		response,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return sks, nil
+	return ke2, &ServerLoginState{state}, nil
 }
 
-// LoginInit responds to a KE1 message with a KE2 message given server credentials and client record.
-func (s *Server) LoginInit(
+// LoginInitWithKeyring is like LoginInit, but uses the keyring's key material of the version the record was
+// registered under, or the current one for fake records. It returns ErrUnknownKeyVersion if the keyring doesn't hold
+// the record's key version anymore. After a successful LoginFinish, ServerKeyring.NeedsReRegistration tells whether
+// the client should register again under the current version.
+func (s *Server) LoginInitWithKeyring(
 	ke1 *message.KE1,
-	serverIdentity, serverSecretKey, serverPublicKey, oprfSeed []byte,
+	serverIdentity []byte,
+	keyring *ServerKeyring,
 	record *ClientRecord,
-) (*message.KE2, error) {
-	sks, err := s.verifyInitInput(serverSecretKey, serverPublicKey, oprfSeed, record)
+) (*message.KE2, *ServerLoginState, error) {
+	keys, err := keyring.ForRecord(record)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	response := s.credentialResponse(ke1.CredentialRequest, serverPublicKey,
-		record.RegistrationRecord, record.CredentialIdentifier, oprfSeed, record.TestMaskNonce)
+	return s.LoginInit(ke1, serverIdentity, keys, record)
+}
 
-	clientIdentity := record.ClientIdentity
+// GetRecord returns the record registered in the store for the credential identifier. If there is none, it returns a
+// fake record instead, so that LoginInit still responds as if the client existed, defending against client
+// enumeration. If fakeRecordSeed is not nil, the fake record is derived from it, making responses for the same unknown
+// credential identifier stable, otherwise it's random. Only store errors other than ErrRecordNotFound are returned.
+func (s *Server) GetRecord(store RecordStore, credentialIdentifier, fakeRecordSeed []byte) (*ClientRecord, error) {
+	if fakeRecordSeed != nil && len(fakeRecordSeed) != s.conf.Hash.Size() {
+		return nil, ErrInvalidFakeRecordSeedLength
+	}
 
-	if clientIdentity == nil {
-		clientIdentity = encoding.SerializePoint(record.PublicKey, s.conf.Group)
+	record, err := store.Get(credentialIdentifier)
+	if errors.Is(err, ErrRecordNotFound) {
+		if fakeRecordSeed == nil {
+			return fakeRecord(s.conf, credentialIdentifier), nil
+		}
+
+		return deterministicFakeRecord(s.conf, fakeRecordSeed, credentialIdentifier), nil
 	}
 
-	if serverIdentity == nil {
-		serverIdentity = serverPublicKey
+	if err != nil {
+		return nil, err
 	}
 
-	ke2 := s.Ake.Response(s.conf, serverIdentity, sks, clientIdentity, record.PublicKey, ke1, response)
+	return record, nil
+}
+
+// LoginInitFromStore is like LoginInit, but looks up the client record in the store, falling back to a fake record
+// for unknown credential identifiers, as in GetRecord.
+func (s *Server) LoginInitFromStore(
+	ke1 *message.KE1,
+	serverIdentity []byte,
+	keys *ServerKeyMaterial,
+	fakeRecordSeed, credentialIdentifier []byte,
+	store RecordStore,
+) (*message.KE2, *ServerLoginState, error) {
+	record, err := s.GetRecord(store, credentialIdentifier, fakeRecordSeed)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return ke2, nil
+	return s.LoginInit(ke1, serverIdentity, keys, record)
 }
 
-// LoginFinish returns an error if the KE3 received from the client holds an invalid mac, and nil if correct.
-func (s *Server) LoginFinish(ke3 *message.KE3) error {
-	if !s.Ake.Finalize(s.conf, ke3) {
+// LoginFinish returns an error if the KE3 received from the client holds an invalid mac for the session state, and nil
+// if correct.
+func (s *Server) LoginFinish(ke3 *message.KE3, state *ServerLoginState) error {
+	if state == nil || state.ServerState == nil {
+		return ErrNoState
+	}
+
+	if !s.Ake.Finalize(s.conf, state.ServerState, ke3) {
 		return ErrAkeInvalidClientMac
 	}
 
 	return nil
 }
 
-// SessionKey returns the session key if the previous call to LoginInit() was successful.
-func (s *Server) SessionKey() []byte {
-	return s.Ake.SessionKey()
+// DeserializeState decodes a login session state previously serialized with ServerLoginState.Serialize.
+func (s *Server) DeserializeState(state []byte) (*ServerLoginState, error) {
+	macLength, secretLength := s.conf.MAC.Size(), s.conf.KDF.Size()
+
+	if s.conf.SignatureLength == 0 {
+		if len(state) != macLength+secretLength {
+			return nil, ErrInvalidState
+		}
+
+		return &ServerLoginState{ake.NewServerState(state[:macLength], state[macLength:])}, nil
+	}
+
+	if len(state) != macLength+secretLength+s.conf.Hash.Size()+s.conf.AkePointLength {
+		return nil, ErrInvalidState
+	}
+
+	offset := macLength + secretLength
+
+	return &ServerLoginState{ake.NewSignedServerState(
+		state[:macLength],
+		state[macLength:offset],
+		state[offset:offset+s.conf.Hash.Size()],
+		state[offset+s.conf.Hash.Size():],
+	)}, nil
 }
 
-// ExpectedMAC returns the expected client MAC if the previous call to LoginInit() was successful.
-func (s *Server) ExpectedMAC() []byte {
-	return s.Ake.ExpectedMAC()
+// sealingAEAD returns the AEAD used to seal login states, keyed with a key derived from the server's sealing key.
+func (s *Server) sealingAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) < internal.SeedLength {
+		return nil, ErrInvalidSealingKey
+	}
+
+	block, err := aes.NewCipher(s.conf.KDF.Expand(key, []byte(tag.SealedState), 32))
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// sealedStateAD returns the additional data authenticated with a sealed state, binding it to the header, the
+// credential identifier, and the serialized configuration, which includes the AKE mode and the context.
+func sealedStateAD(header, credentialIdentifier, encodedConf []byte) []byte {
+	return encoding.Concat3(header, encoding.EncodeVector(credentialIdentifier), encoding.EncodeVector(encodedConf))
 }
 
-// SetAKEState sets the internal state of the AKE server from the given bytes.
-func (s *Server) SetAKEState(state []byte) error {
-	if len(state) != s.conf.MAC.Size()+s.conf.KDF.Size() {
-		return ErrInvalidState
+// SealState encrypts and authenticates the login state under the server's sealing key, binding it to the credential
+// identifier of the record it was created for. The returned blob is safe to store outside the server, e.g. in a cookie
+// or a shared cache, until KE3 is received, or after LoginFinish, to later change the password or export keys in the
+// login session. It can only be opened with OpenState until expiry. The key must be at least 32 bytes long, and
+// should be different from the server's AKE secret key and OPRF seed.
+func (s *Server) SealState(
+	state *ServerLoginState,
+	key, credentialIdentifier []byte,
+	expiry time.Time,
+) ([]byte, error) {
+	if state == nil || state.ServerState == nil {
+		return nil, ErrNoState
 	}
 
-	return s.Ake.SetState(state[:s.conf.MAC.Size()], state[s.conf.MAC.Size():])
+	aead, err := s.sealingAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, sealedStateHeaderLength)
+	header[0] = sealedStateVersion
+	binary.BigEndian.PutUint64(header[1:], uint64(expiry.Unix()))
+
+	nonce := internal.RandomBytes(aead.NonceSize())
+	ad := sealedStateAD(header, credentialIdentifier, s.Deserialize.encodedConf)
+
+	// The state is prefixed with whether the login has finished, so that a restored state can be used where a finished
+	// login is required.
+	plaintext := encoding.Concat([]byte{sealedStateOpen}, state.Serialize())
+	if state.Finished() {
+		plaintext[0] = sealedStateFinished
+	}
+
+	return aead.Seal(encoding.Concat(header, nonce), nonce, plaintext, ad), nil
 }
 
-// SerializeState returns the internal state of the AKE server serialized to bytes.
-func (s *Server) SerializeState() []byte {
-	return s.Ake.SerializeState()
+// OpenState decrypts and verifies a login state sealed with SealState for the given credential identifier. It fails
+// with ErrInvalidSealedState if the state has been tampered with or was sealed for another credential identifier,
+// configuration, or key, and with ErrSealedStateExpired if its expiry has passed. A state sealed after a successful
+// LoginFinish is restored as finished.
+func (s *Server) OpenState(sealed, key, credentialIdentifier []byte) (*ServerLoginState, error) {
+	aead, err := s.sealingAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < sealedStateHeaderLength+aead.NonceSize()+aead.Overhead() || sealed[0] != sealedStateVersion {
+		return nil, ErrInvalidSealedState
+	}
+
+	header := sealed[:sealedStateHeaderLength]
+	nonce := sealed[sealedStateHeaderLength : sealedStateHeaderLength+aead.NonceSize()]
+	ciphertext := sealed[sealedStateHeaderLength+aead.NonceSize():]
+
+	ad := sealedStateAD(header, credentialIdentifier, s.Deserialize.encodedConf)
+
+	state, err := aead.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return nil, ErrInvalidSealedState
+	}
+
+	// The expiry is only trusted once authenticated.
+	expiry := int64(binary.BigEndian.Uint64(header[1:]))
+	if time.Now().Unix() > expiry {
+		return nil, ErrSealedStateExpired
+	}
+
+	if len(state) == 0 || state[0] > sealedStateFinished {
+		return nil, ErrInvalidSealedState
+	}
+
+	restored, err := s.DeserializeState(state[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	if state[0] == sealedStateFinished {
+		ake.SetFinished(restored.ServerState)
+	}
+
+	return restored, nil
 }
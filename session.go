@@ -0,0 +1,132 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque
+
+import (
+	"errors"
+
+	"github.com/bytemare/opaque/internal"
+	"github.com/bytemare/opaque/internal/encoding"
+	"github.com/bytemare/opaque/internal/tag"
+)
+
+const (
+	// maxLabelLength is the maximum length of an exporter label, that is encoded on one byte with its prefix.
+	maxLabelLength = 255 - len(tag.LabelPrefix)
+
+	// maxExportLength is the maximum length of an exported key, that is encoded on two bytes.
+	maxExportLength = 1<<16 - 1
+
+	labelKey = "key"
+	labelIV  = "iv"
+)
+
+var (
+	// ErrExportLength indicates that the requested exported key length is zero or too long for the KDF.
+	ErrExportLength = errors.New("invalid exported key length")
+
+	// ErrExportLabel indicates that the exporter label is empty or too long.
+	ErrExportLabel = errors.New("invalid exporter label")
+)
+
+// SessionExporter derives keys from a finished login session, similar to the TLS exporter. Keys are bound to the
+// session secret and to the whole transcript, so both parties obtain the same keys if, and only if, they took part in
+// the same session. It is returned by Client.Exporter and Server.Exporter.
+type SessionExporter struct {
+	conf          *internal.Configuration
+	exporter      []byte
+	clientTraffic []byte
+	serverTraffic []byte
+	isClient      bool
+}
+
+func newSessionExporter(conf *internal.Configuration, sessionSecret, clientMac []byte, isClient bool) *SessionExporter {
+	derive := func(label string) []byte {
+		return conf.KDF.Expand(sessionSecret, buildExportLabel(conf.KDF.Size(), label, clientMac), conf.KDF.Size())
+	}
+
+	return &SessionExporter{
+		conf:          conf,
+		exporter:      derive(tag.ExporterSecret),
+		clientTraffic: derive(tag.ClientTraffic),
+		serverTraffic: derive(tag.ServerTraffic),
+		isClient:      isClient,
+	}
+}
+
+func buildExportLabel(length int, label string, context []byte) []byte {
+	return encoding.Concat3(
+		encoding.I2OSP(length, 2),
+		encoding.EncodeVectorLen([]byte(tag.LabelPrefix+label), 1),
+		encoding.EncodeVectorLen(context, 1),
+	)
+}
+
+func (e *SessionExporter) verifyLength(length int) error {
+	if length <= 0 || length > maxExportLength || length > 255*e.conf.KDF.Size() {
+		return ErrExportLength
+	}
+
+	return nil
+}
+
+// Export returns a key of the given length for the label and the optional context. Different labels or contexts
+// yield independent keys. Applications should use a distinct label for every use.
+func (e *SessionExporter) Export(label string, context []byte, length int) ([]byte, error) {
+	if label == "" || len(label) > maxLabelLength {
+		return nil, ErrExportLabel
+	}
+
+	if err := e.verifyLength(length); err != nil {
+		return nil, err
+	}
+
+	h := e.conf.Hash.New()
+	h.Write(context)
+
+	return e.conf.KDF.Expand(e.exporter, buildExportLabel(length, label, h.Sum()), length), nil
+}
+
+// TrafficKeys returns the directional keys of the given length protecting client-to-server and server-to-client
+// traffic. They are independent of the keys returned by Export.
+func (e *SessionExporter) TrafficKeys(length int) (clientToServer, serverToClient []byte, err error) {
+	if err := e.verifyLength(length); err != nil {
+		return nil, nil, err
+	}
+
+	return e.trafficKey(e.clientTraffic, labelKey, length), e.trafficKey(e.serverTraffic, labelKey, length), nil
+}
+
+func (e *SessionExporter) trafficKey(secret []byte, label string, length int) []byte {
+	return e.conf.KDF.Expand(secret, buildExportLabel(length, label, nil), length)
+}
+
+// Exporter returns the SessionExporter of the login session, which must have been successfully finished with
+// LoginFinish.
+func (c *Client) Exporter(state *ClientLoginState) (*SessionExporter, error) {
+	if state == nil || !state.finalized {
+		return nil, ErrLoginNotFinished
+	}
+
+	return newSessionExporter(c.conf, state.Ake.SessionKey(), state.Ake.ClientMac(), true), nil
+}
+
+// Exporter returns the SessionExporter of the login session. It returns ErrLoginNotFinished if LoginFinish didn't
+// succeed with the state, as the client is only authenticated then.
+func (s *Server) Exporter(state *ServerLoginState) (*SessionExporter, error) {
+	if state == nil || state.ServerState == nil {
+		return nil, ErrNoState
+	}
+
+	if !state.Finished() {
+		return nil, ErrLoginNotFinished
+	}
+
+	return newSessionExporter(s.conf, state.SessionKey(), state.ExpectedMAC(), false), nil
+}
@@ -0,0 +1,531 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/bytemare/opaque/internal/encoding"
+	"github.com/bytemare/opaque/message"
+)
+
+const (
+	fileStoreOpPut    byte = 1
+	fileStoreOpDelete byte = 2
+
+	// operation and 4-byte payload length.
+	fileStoreEntryHeaderLength = 5
+)
+
+var (
+	// ErrRecordNotFound indicates that no record exists for the credential identifier.
+	ErrRecordNotFound = errors.New("record not found")
+
+	// ErrStoreClosed indicates that the record store has been closed.
+	ErrStoreClosed = errors.New("record store is closed")
+
+	// ErrRecordExists indicates that a record already exists for the credential identifier of a record to create.
+	ErrRecordExists = errors.New("a record already exists for the credential identifier")
+
+	// ErrRecordChanged indicates that the stored record is not the expected one anymore, e.g. because it has been
+	// replaced concurrently.
+	ErrRecordChanged = errors.New("stored record has changed")
+
+	errRecordNil              = errors.New("record is nil")
+	errRecordNoCredentialID   = errors.New("record has no credential identifier")
+	errRecordNoPublicKey      = errors.New("record has no client public key")
+	errRecordIDMismatch       = errors.New("records have different credential identifiers")
+	errFileStoreCorruptedFile = errors.New("corrupted record store file")
+)
+
+// RecordStore is the interface to persist and retrieve client records, keyed by their credential identifier.
+// Implementations must be safe for concurrent use.
+type RecordStore interface {
+	// Get returns the record registered for the credential identifier, or ErrRecordNotFound if there is none.
+	Get(credentialIdentifier []byte) (*ClientRecord, error)
+
+	// Put stores the record under its credential identifier, replacing any existing one.
+	Put(record *ClientRecord) error
+
+	// Create atomically stores the record under its credential identifier if there is none yet, and returns
+	// ErrRecordExists otherwise, so that concurrent registrations for the same credential identifier can't overwrite
+	// each other.
+	Create(record *ClientRecord) error
+
+	// Replace atomically stores newRecord in place of oldRecord, if the stored record is still oldRecord. It returns
+	// ErrRecordNotFound if there is none, and ErrRecordChanged if it's another record.
+	Replace(oldRecord, newRecord *ClientRecord) error
+
+	// Delete removes the record registered for the credential identifier, or returns ErrRecordNotFound if there is
+	// none.
+	Delete(credentialIdentifier []byte) error
+
+	// List returns the credential identifiers of all stored records, in lexicographic order.
+	List() ([][]byte, error)
+}
+
+func verifyRecord(record *ClientRecord) error {
+	if record == nil || record.RegistrationRecord == nil {
+		return errRecordNil
+	}
+
+	if len(record.CredentialIdentifier) == 0 {
+		return errRecordNoCredentialID
+	}
+
+	if record.PublicKey == nil {
+		return errRecordNoPublicKey
+	}
+
+	return nil
+}
+
+func verifyReplacement(oldRecord, newRecord *ClientRecord) error {
+	if err := verifyRecord(oldRecord); err != nil {
+		return err
+	}
+
+	if err := verifyRecord(newRecord); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(oldRecord.CredentialIdentifier, newRecord.CredentialIdentifier) {
+		return errRecordIDMismatch
+	}
+
+	return nil
+}
+
+func isSameRecord(a, b *ClientRecord) bool {
+	return a.KeyVersion == b.KeyVersion &&
+		bytes.Equal(a.ClientIdentity, b.ClientIdentity) &&
+		bytes.Equal(a.RegistrationRecord.Serialize(), b.RegistrationRecord.Serialize())
+}
+
+// copyRecord returns a deep copy of the record, sharing no memory with it.
+func copyRecord(record *ClientRecord) *ClientRecord {
+	r := &message.RegistrationRecord{
+		G:          record.RegistrationRecord.G,
+		MaskingKey: append([]byte(nil), record.MaskingKey...),
+		Envelope:   append([]byte(nil), record.Envelope...),
+	}
+
+	if record.PublicKey != nil {
+		r.PublicKey = record.PublicKey.Copy()
+	}
+
+	return &ClientRecord{
+		CredentialIdentifier: append([]byte(nil), record.CredentialIdentifier...),
+		ClientIdentity:       append([]byte(nil), record.ClientIdentity...),
+		RegistrationRecord:   r,
+		KeyVersion:           record.KeyVersion,
+	}
+}
+
+func sortedIdentifiers(records map[string]*ClientRecord) [][]byte {
+	ids := make([]string, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	list := make([][]byte, len(ids))
+	for i, id := range ids {
+		list[i] = []byte(id)
+	}
+
+	return list
+}
+
+// MemoryRecordStore is an in-memory RecordStore. Its content is lost when the process exits.
+type MemoryRecordStore struct {
+	records map[string]*ClientRecord
+	mutex   sync.RWMutex
+}
+
+// NewMemoryRecordStore returns a new, empty, in-memory RecordStore.
+func NewMemoryRecordStore() *MemoryRecordStore {
+	return &MemoryRecordStore{records: make(map[string]*ClientRecord)}
+}
+
+// Get returns a copy of the record registered for the credential identifier, or ErrRecordNotFound if there is none.
+func (m *MemoryRecordStore) Get(credentialIdentifier []byte) (*ClientRecord, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	record, ok := m.records[string(credentialIdentifier)]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	return copyRecord(record), nil
+}
+
+// Put stores a copy of the record under its credential identifier, replacing any existing one.
+func (m *MemoryRecordStore) Put(record *ClientRecord) error {
+	if err := verifyRecord(record); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.records[string(record.CredentialIdentifier)] = copyRecord(record)
+
+	return nil
+}
+
+// Create atomically stores a copy of the record under its credential identifier, if there is none yet.
+func (m *MemoryRecordStore) Create(record *ClientRecord) error {
+	if err := verifyRecord(record); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.records[string(record.CredentialIdentifier)]; ok {
+		return ErrRecordExists
+	}
+
+	m.records[string(record.CredentialIdentifier)] = copyRecord(record)
+
+	return nil
+}
+
+// Replace atomically stores a copy of newRecord in place of oldRecord, if the stored record is still oldRecord.
+func (m *MemoryRecordStore) Replace(oldRecord, newRecord *ClientRecord) error {
+	if err := verifyReplacement(oldRecord, newRecord); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.expect(oldRecord); err != nil {
+		return err
+	}
+
+	m.records[string(newRecord.CredentialIdentifier)] = copyRecord(newRecord)
+
+	return nil
+}
+
+// expect returns an error if the stored record is not oldRecord. The caller must hold the lock.
+func (m *MemoryRecordStore) expect(oldRecord *ClientRecord) error {
+	current, ok := m.records[string(oldRecord.CredentialIdentifier)]
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	if !isSameRecord(current, oldRecord) {
+		return ErrRecordChanged
+	}
+
+	return nil
+}
+
+// Delete removes the record registered for the credential identifier, or returns ErrRecordNotFound if there is none.
+func (m *MemoryRecordStore) Delete(credentialIdentifier []byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.records[string(credentialIdentifier)]; !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(m.records, string(credentialIdentifier))
+
+	return nil
+}
+
+// List returns the credential identifiers of all stored records, in lexicographic order.
+func (m *MemoryRecordStore) List() ([][]byte, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return sortedIdentifiers(m.records), nil
+}
+
+// FileRecordStore is a RecordStore backed by an append-only file. Every modification appends an entry to the file
+// and syncs it to disk before returning, records being encoded with ClientRecord.Serialize. The file is replayed in
+// memory when opened, and an incomplete trailing entry, e.g. from a crash during a write, is discarded.
+type FileRecordStore struct {
+	file   *os.File
+	memory *MemoryRecordStore
+	conf   *Configuration
+	d      *Deserializer
+	mutex  sync.Mutex
+}
+
+// NewFileRecordStore opens, or creates, the append-only record file at path, for records of the given configuration.
+func NewFileRecordStore(path string, c *Configuration) (*FileRecordStore, error) {
+	if c == nil {
+		c = DefaultConfiguration()
+	}
+
+	d, err := c.Deserializer()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening record store: %w", err)
+	}
+
+	f := &FileRecordStore{
+		file:   file,
+		memory: NewMemoryRecordStore(),
+		conf:   c,
+		d:      d,
+	}
+
+	if err := f.replay(); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// replay loads all entries of the file in memory, and positions the file at the end of the last complete entry.
+func (f *FileRecordStore) replay() error {
+	content, err := io.ReadAll(f.file)
+	if err != nil {
+		return fmt.Errorf("reading record store: %w", err)
+	}
+
+	offset := 0
+
+	for len(content)-offset >= fileStoreEntryHeaderLength {
+		length := encoding.OS2IP(content[offset+1 : offset+fileStoreEntryHeaderLength])
+		end := offset + fileStoreEntryHeaderLength + length
+
+		if end > len(content) {
+			break
+		}
+
+		if err := f.apply(content[offset], content[offset+fileStoreEntryHeaderLength:end]); err != nil {
+			return fmt.Errorf("%w at offset %d: %v", errFileStoreCorruptedFile, offset, err)
+		}
+
+		offset = end
+	}
+
+	if offset != len(content) {
+		if err := f.file.Truncate(int64(offset)); err != nil {
+			return fmt.Errorf("truncating incomplete record store entry: %w", err)
+		}
+	}
+
+	if _, err := f.file.Seek(int64(offset), io.SeekStart); err != nil {
+		return fmt.Errorf("seeking record store: %w", err)
+	}
+
+	return nil
+}
+
+func (f *FileRecordStore) apply(op byte, payload []byte) error {
+	switch op {
+	case fileStoreOpPut:
+		record, err := f.d.ClientRecord(payload)
+		if err != nil {
+			return err
+		}
+
+		return f.memory.Put(record)
+	case fileStoreOpDelete:
+		return f.memory.Delete(payload)
+	default:
+		return fmt.Errorf("unknown operation %d", op)
+	}
+}
+
+// append writes the entry at the end of the file and syncs it. On failure, the file is truncated back to its previous
+// end, so that no partial or unsynced entry remains, and the store is closed if that fails too.
+func (f *FileRecordStore) append(op byte, payload []byte) error {
+	if f.file == nil {
+		return ErrStoreClosed
+	}
+
+	offset, err := f.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("seeking record store: %w", err)
+	}
+
+	entry := encoding.Concatenate([]byte{op}, encoding.I2OSP(len(payload), 4), payload)
+
+	if _, err = f.file.Write(entry); err != nil {
+		err = fmt.Errorf("writing record store entry: %w", err)
+	} else if err = f.file.Sync(); err != nil {
+		err = fmt.Errorf("syncing record store: %w", err)
+	}
+
+	if err != nil {
+		return f.rollback(offset, err)
+	}
+
+	return nil
+}
+
+// rollback truncates the file back to offset after the failure of an append, and returns the failure. If the file
+// can't be restored, the store is closed, as later entries would follow a torn one.
+func (f *FileRecordStore) rollback(offset int64, failure error) error {
+	err := f.file.Truncate(offset)
+	if err == nil {
+		_, err = f.file.Seek(offset, io.SeekStart)
+	}
+
+	if err != nil {
+		_ = f.file.Close()
+		f.file = nil
+
+		return fmt.Errorf("%w, and rolling it back failed, closing the store: %v", failure, err)
+	}
+
+	return failure
+}
+
+// encode returns the encoding of the record to write in the file. The record is validated, and its encoding decoded as
+// it would be on replay, before anything is written, so that the file never holds a record that would be rejected.
+func (f *FileRecordStore) encode(record *ClientRecord) ([]byte, error) {
+	if err := verifyRecord(record); err != nil {
+		return nil, err
+	}
+
+	encoded, err := record.Serialize(f.conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := f.d.ClientRecord(encoded); err != nil {
+		return nil, err
+	}
+
+	return encoded, nil
+}
+
+// Get returns the record registered for the credential identifier, or ErrRecordNotFound if there is none.
+func (f *FileRecordStore) Get(credentialIdentifier []byte) (*ClientRecord, error) {
+	return f.memory.Get(credentialIdentifier)
+}
+
+// Put durably stores the record under its credential identifier, replacing any existing one.
+func (f *FileRecordStore) Put(record *ClientRecord) error {
+	encoded, err := f.encode(record)
+	if err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.append(fileStoreOpPut, encoded); err != nil {
+		return err
+	}
+
+	return f.memory.Put(record)
+}
+
+// Create atomically and durably stores the record under its credential identifier, if there is none yet.
+func (f *FileRecordStore) Create(record *ClientRecord) error {
+	encoded, err := f.encode(record)
+	if err != nil {
+		return err
+	}
+
+	// All modifications go through f.mutex, so no record can be stored between the check and the write.
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, err := f.memory.Get(record.CredentialIdentifier); err == nil {
+		return ErrRecordExists
+	}
+
+	if err := f.append(fileStoreOpPut, encoded); err != nil {
+		return err
+	}
+
+	return f.memory.Put(record)
+}
+
+// Replace atomically and durably stores newRecord in place of oldRecord, if the stored record is still oldRecord.
+func (f *FileRecordStore) Replace(oldRecord, newRecord *ClientRecord) error {
+	if err := verifyReplacement(oldRecord, newRecord); err != nil {
+		return err
+	}
+
+	encoded, err := f.encode(newRecord)
+	if err != nil {
+		return err
+	}
+
+	// All modifications go through f.mutex, so the stored record can't change between the check and the write.
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.memory.mutex.RLock()
+	err = f.memory.expect(oldRecord)
+	f.memory.mutex.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	if err := f.append(fileStoreOpPut, encoded); err != nil {
+		return err
+	}
+
+	return f.memory.Put(newRecord)
+}
+
+// Delete durably removes the record registered for the credential identifier, or returns ErrRecordNotFound without
+// writing anything if there is none.
+func (f *FileRecordStore) Delete(credentialIdentifier []byte) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, err := f.memory.Get(credentialIdentifier); err != nil {
+		return err
+	}
+
+	if err := f.append(fileStoreOpDelete, credentialIdentifier); err != nil {
+		return err
+	}
+
+	return f.memory.Delete(credentialIdentifier)
+}
+
+// List returns the credential identifiers of all stored records, in lexicographic order.
+func (f *FileRecordStore) List() ([][]byte, error) {
+	return f.memory.List()
+}
+
+// Close closes the underlying file. The store can't be modified afterwards.
+func (f *FileRecordStore) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+
+	return err
+}
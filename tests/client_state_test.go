@@ -0,0 +1,237 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/bytemare/crypto/ksf"
+
+	"github.com/bytemare/opaque"
+	"github.com/bytemare/opaque/internal"
+)
+
+func TestClientState_Registration(t *testing.T) {
+	password := []byte("password")
+	credID := internal.RandomBytes(32)
+
+	for _, key := range [][]byte{nil, internal.RandomBytes(32)} {
+		for _, conf := range confs {
+			client, _ := conf.Conf.Client()
+			server, _ := conf.Conf.Server()
+			keys := serverKeys(t, conf.Conf)
+
+			r1, state := client.RegistrationInit(password)
+
+			encoded, err := client.SerializeRegistrationState(state, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r2, err := server.RegistrationResponse(r1, keys, credID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// A fresh client must be able to finalize the registration.
+			fresh, _ := conf.Conf.Client()
+
+			restored, err := fresh.DeserializeRegistrationState(encoded, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			record, exportKey, err := fresh.RegistrationFinalize(r2, nil, nil, restored)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The record must allow a login with the same password.
+			rec := &opaque.ClientRecord{CredentialIdentifier: credID, RegistrationRecord: record}
+			_, loginExportKey := login(t, conf.Conf, password, keys, rec)
+
+			if !bytes.Equal(exportKey, loginExportKey) {
+				t.Fatal("export keys from restored registration and login differ")
+			}
+		}
+	}
+}
+
+func TestClientState_Login(t *testing.T) {
+	password := []byte("password")
+	credID := internal.RandomBytes(32)
+
+	for _, key := range [][]byte{nil, internal.RandomBytes(32)} {
+		for _, conf := range confs {
+			client, _ := conf.Conf.Client()
+			server, _ := conf.Conf.Server()
+			keys := serverKeys(t, conf.Conf)
+			rec := buildRecord(credID, password, keys, client, server)
+
+			ke1, state := client.LoginInit(password)
+
+			encoded, err := client.SerializeLoginState(state, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ke2, serverState, err := server.LoginInit(ke1, nil, keys, rec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// A fresh client must be able to finish the login.
+			fresh, _ := conf.Conf.Client()
+
+			restored, err := fresh.DeserializeLoginState(encoded, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ke3, _, err := fresh.LoginFinish(nil, nil, ke2, restored)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := server.LoginFinish(ke3, serverState); err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(restored.SessionKey(), serverState.SessionKey()) {
+				t.Fatal("session keys differ")
+			}
+		}
+	}
+}
+
+func TestClientState_Finalized(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	client, _ := conf.Client()
+	server, _ := conf.Server()
+	keys := serverKeys(t, conf)
+	rec := buildRecord(internal.RandomBytes(32), []byte("yo"), keys, client, server)
+
+	ke1, state := client.LoginInit([]byte("yo"))
+	ke2, _, err := server.LoginInit(ke1, nil, keys, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := client.LoginFinish(nil, nil, ke2, state); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.SerializeLoginState(state, nil); !errors.Is(err, opaque.ErrStateFinalized) {
+		t.Fatalf("expected %q when exporting a finalized state, got %q", opaque.ErrStateFinalized, err)
+	}
+}
+
+func TestClientState_InvalidInput(t *testing.T) {
+	key := internal.RandomBytes(32)
+	client, _ := opaque.DefaultConfiguration().Client()
+	_, state := client.LoginInit([]byte("yo"))
+
+	authenticated, err := client.SerializeLoginState(state, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unauthenticated, err := client.SerializeLoginState(state, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tampered state.
+	tampered := make([]byte, len(authenticated))
+	copy(tampered, authenticated)
+	tampered[len(tampered)/2] ^= 0xff
+
+	if _, err := client.DeserializeLoginState(tampered, key); !errors.Is(err, opaque.ErrClientStateAuthentication) {
+		t.Fatalf("expected %q for tampered state, got %q", opaque.ErrClientStateAuthentication, err)
+	}
+
+	// Wrong key.
+	if _, err := client.DeserializeLoginState(authenticated, internal.RandomBytes(32)); !errors.Is(
+		err,
+		opaque.ErrClientStateAuthentication,
+	) {
+		t.Fatalf("expected %q for wrong key, got %q", opaque.ErrClientStateAuthentication, err)
+	}
+
+	// Missing key.
+	if _, err := client.DeserializeLoginState(authenticated, nil); !errors.Is(err, opaque.ErrClientStateAuthentication) {
+		t.Fatalf("expected %q for missing key, got %q", opaque.ErrClientStateAuthentication, err)
+	}
+
+	// Unauthenticated state when expecting an authenticated one.
+	if _, err := client.DeserializeLoginState(unauthenticated, key); !errors.Is(
+		err,
+		opaque.ErrClientStateAuthentication,
+	) {
+		t.Fatalf("expected %q for unauthenticated state, got %q", opaque.ErrClientStateAuthentication, err)
+	}
+
+	// Unsupported version.
+	version := make([]byte, len(unauthenticated))
+	copy(version, unauthenticated)
+	version[0] = 0xff
+
+	if _, err := client.DeserializeLoginState(version, nil); !errors.Is(err, opaque.ErrClientStateVersion) {
+		t.Fatalf("expected %q for unsupported version, got %q", opaque.ErrClientStateVersion, err)
+	}
+
+	// State exported under another configuration with the same groups, with or without a key.
+	otherKSF := opaque.DefaultConfiguration()
+	otherKSF.KSF = ksf.Argon2id
+	otherContext := opaque.DefaultConfiguration()
+	otherContext.Context = []byte("context")
+
+	for _, other := range []*opaque.Configuration{otherKSF, otherContext} {
+		otherClient, _ := other.Client()
+
+		for _, k := range [][]byte{nil, key} {
+			encoded, err := otherClient.SerializeLoginState(state, k)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := client.DeserializeLoginState(encoded, k); err == nil || errors.Is(
+				err,
+				opaque.ErrClientStateAuthentication,
+			) {
+				t.Fatalf("expected configuration error for state of another configuration, got %v", err)
+			}
+		}
+	}
+
+	// Registration state given as login state.
+	_, regState := client.RegistrationInit([]byte("yo"))
+
+	encoded, err := client.SerializeRegistrationState(regState, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.DeserializeLoginState(encoded, nil); err == nil {
+		t.Fatal("expected error when restoring a registration state as login state")
+	}
+
+	// Truncated state.
+	if _, err := client.DeserializeLoginState(unauthenticated[:len(unauthenticated)-1], nil); err == nil {
+		t.Fatal("expected error for truncated state")
+	}
+
+	// State from another configuration.
+	other, _ := confs[1].Conf.Client()
+	if _, err := other.DeserializeLoginState(unauthenticated, nil); err == nil {
+		t.Fatal("expected error for a state from another configuration")
+	}
+}
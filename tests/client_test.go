@@ -9,6 +9,8 @@
 package opaque_test
 
 import (
+	"bytes"
+	"errors"
 	"strings"
 	"testing"
 
@@ -31,15 +33,13 @@ func TestClientRegistrationFinalize_InvalidPks(t *testing.T) {
 	for _, conf := range confs {
 		client, _ := conf.Conf.Client()
 		server, _ := conf.Conf.Server()
-		_, pks := conf.Conf.KeyGen()
-		oprfSeed := internal.RandomBytes(conf.Conf.Hash.Size())
-		r1 := client.RegistrationInit([]byte("yo"))
+		keys := serverKeys(t, conf.Conf)
+		r1, _ := client.RegistrationInit([]byte("yo"))
 
-		pk, err := server.GetConf().Group.NewElement().Decode(pks)
+		r2, err := server.RegistrationResponse(r1, keys, credID)
 		if err != nil {
-			panic(err)
+			t.Fatal(err)
 		}
-		r2 := server.RegistrationResponse(r1, pk, credID, oprfSeed)
 
 		// message length
 		badr2 := internal.RandomBytes(15)
@@ -50,7 +50,7 @@ func TestClientRegistrationFinalize_InvalidPks(t *testing.T) {
 		}
 
 		// invalid data
-		badr2 = encoding.Concat(getBadElement(t, conf), pks)
+		badr2 = encoding.Concat(getBadElement(t, conf), keys.PublicKey())
 		expected = "invalid OPRF evaluation"
 		if _, err := client.Deserialize.RegistrationResponse(badr2); err == nil ||
 			!strings.HasPrefix(err.Error(), expected) {
@@ -73,7 +73,7 @@ func TestClientFinish_BadEvaluation(t *testing.T) {
 	*/
 	for _, conf := range confs {
 		client, _ := conf.Conf.Client()
-		_ = client.LoginInit([]byte("yo"))
+		_, _ = client.LoginInit([]byte("yo"))
 		r2 := encoding.Concat(
 			getBadElement(t, conf),
 			internal.RandomBytes(
@@ -101,25 +101,25 @@ func TestClientFinish_BadMaskedResponse(t *testing.T) {
 	for _, conf := range confs {
 		client, _ := conf.Conf.Client()
 		server, _ := conf.Conf.Server()
-		sks, pks := conf.Conf.KeyGen()
-		oprfSeed := internal.RandomBytes(conf.Conf.Hash.Size())
-		rec := buildRecord(credID, oprfSeed, []byte("yo"), pks, client, server)
+		keys := serverKeys(t, conf.Conf)
+		rec := buildRecord(credID, []byte("yo"), keys, client, server)
 
-		ke1 := client.LoginInit([]byte("yo"))
-		ke2, _ := server.LoginInit(ke1, nil, sks, pks, oprfSeed, rec)
+		ke1, state := client.LoginInit([]byte("yo"))
+		ke2, _, _ := server.LoginInit(ke1, nil, keys, rec)
 
 		goodLength := encoding.PointLength[client.GetConf().Group] + client.GetConf().EnvelopeSize
 		expected := "invalid masked response length"
 
 		// too short
 		ke2.MaskedResponse = internal.RandomBytes(goodLength - 1)
-		if _, _, err := client.LoginFinish(nil, nil, ke2); err == nil || !strings.HasPrefix(err.Error(), expected) {
+		if _, _, err := client.LoginFinish(nil, nil, ke2, state); err == nil || !strings.HasPrefix(err.Error(), expected) {
 			t.Fatalf("expected error for short response - got %v", err)
 		}
 
-		// too long
+		// too long, in a new login as a failed one can't be resumed
+		_, state = client.LoginInit([]byte("yo"))
 		ke2.MaskedResponse = internal.RandomBytes(goodLength + 1)
-		if _, _, err := client.LoginFinish(nil, nil, ke2); err == nil || !strings.HasPrefix(err.Error(), expected) {
+		if _, _, err := client.LoginFinish(nil, nil, ke2, state); err == nil || !strings.HasPrefix(err.Error(), expected) {
 			t.Fatalf("expected error for long response - got %v", err)
 		}
 	}
@@ -134,26 +134,25 @@ func TestClientFinish_InvalidEnvelopeTag(t *testing.T) {
 	for _, conf := range confs {
 		client, _ := conf.Conf.Client()
 		server, _ := conf.Conf.Server()
-		sks, pks := conf.Conf.KeyGen()
-		oprfSeed := internal.RandomBytes(conf.Conf.Hash.Size())
-		rec := buildRecord(credID, oprfSeed, []byte("yo"), pks, client, server)
+		keys := serverKeys(t, conf.Conf)
+		rec := buildRecord(credID, []byte("yo"), keys, client, server)
 
-		ke1 := client.LoginInit([]byte("yo"))
-		ke2, _ := server.LoginInit(ke1, nil, sks, pks, oprfSeed, rec)
+		ke1, state := client.LoginInit([]byte("yo"))
+		ke2, _, _ := server.LoginInit(ke1, nil, keys, rec)
 
-		env, _, err := getEnvelope(client, ke2)
+		env, _, err := getEnvelope(client, state, ke2)
 		if err != nil {
 			t.Fatal(err)
 		}
 
 		// tamper the envelope
 		env.AuthTag = internal.RandomBytes(client.GetConf().MAC.Size())
-		clear := encoding.Concat(pks, env.Serialize())
+		clear := encoding.Concat(keys.PublicKey(), env.Serialize())
 		ke2.MaskedResponse = xorResponse(server.GetConf(), rec.MaskingKey, ke2.MaskingNonce, clear)
 
 		// too short
 		expected := "recover envelope: invalid envelope authentication tag"
-		if _, _, err := client.LoginFinish(nil, nil, ke2); err == nil || !strings.HasPrefix(err.Error(), expected) {
+		if _, _, err := client.LoginFinish(nil, nil, ke2, state); err == nil || !strings.HasPrefix(err.Error(), expected) {
 			t.Fatalf("expected error for invalid envelope mac - got %v", err)
 		}
 	}
@@ -180,12 +179,11 @@ func TestClientFinish_InvalidKE2KeyEncoding(t *testing.T) {
 	for _, conf := range confs {
 		client, _ := conf.Conf.Client()
 		server, _ := conf.Conf.Server()
-		sks, pks := conf.Conf.KeyGen()
-		oprfSeed := internal.RandomBytes(conf.Conf.Hash.Size())
-		rec := buildRecord(credID, oprfSeed, []byte("yo"), pks, client, server)
+		keys := serverKeys(t, conf.Conf)
+		rec := buildRecord(credID, []byte("yo"), keys, client, server)
 
-		ke1 := client.LoginInit([]byte("yo"))
-		ke2, _ := server.LoginInit(ke1, nil, sks, pks, oprfSeed, rec)
+		ke1, state := client.LoginInit([]byte("yo"))
+		ke2, _, _ := server.LoginInit(ke1, nil, keys, rec)
 		// epks := ke2.EpkS
 
 		// tamper epks
@@ -199,7 +197,7 @@ func TestClientFinish_InvalidKE2KeyEncoding(t *testing.T) {
 
 		// tamper PKS
 		// ke2.EpkS = server.Group.NewElement().Mult(server.Group.NewScalar().Random())
-		env, randomizedPwd, err := getEnvelope(client, ke2)
+		env, randomizedPwd, err := getEnvelope(client, state, ke2)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -224,17 +222,19 @@ func TestClientFinish_InvalidKE2KeyEncoding(t *testing.T) {
 		ke2.MaskedResponse = xorResponse(server.GetConf(), rec.MaskingKey, ke2.MaskingNonce, clear)
 
 		expected = "invalid server public key"
-		if _, _, err := client.LoginFinish(nil, nil, ke2); err == nil || !strings.HasPrefix(err.Error(), expected) {
+		if _, _, err := client.LoginFinish(nil, nil, ke2, state); err == nil || !strings.HasPrefix(err.Error(), expected) {
 			t.Fatalf("expected error for invalid envelope mac - got %q", err)
 		}
 
-		// replace PKS
+		// replace PKS, in a new login as a failed one can't be resumed
+		ke1, state = client.LoginInit([]byte("yo"))
+		ke2, _, _ = server.LoginInit(ke1, nil, keys, rec)
 		fakepks := server.GetConf().Group.Base().Mult(server.GetConf().Group.NewScalar().Random()).Bytes()
 		clear = encoding.Concat(fakepks, env.Serialize())
 		ke2.MaskedResponse = xorResponse(server.GetConf(), rec.MaskingKey, ke2.MaskingNonce, clear)
 
 		expected = "recover envelope: invalid envelope authentication tag"
-		if _, _, err := client.LoginFinish(nil, nil, ke2); err == nil || !strings.HasPrefix(err.Error(), expected) {
+		if _, _, err := client.LoginFinish(nil, nil, ke2, state); err == nil || !strings.HasPrefix(err.Error(), expected) {
 			t.Fatalf("expected error for invalid envelope mac - got %q", err)
 		}
 	}
@@ -249,16 +249,15 @@ func TestClientFinish_InvalidKE2Mac(t *testing.T) {
 	for _, conf := range confs {
 		client, _ := conf.Conf.Client()
 		server, _ := conf.Conf.Server()
-		sks, pks := conf.Conf.KeyGen()
-		oprfSeed := internal.RandomBytes(conf.Conf.Hash.Size())
-		rec := buildRecord(credID, oprfSeed, []byte("yo"), pks, client, server)
+		keys := serverKeys(t, conf.Conf)
+		rec := buildRecord(credID, []byte("yo"), keys, client, server)
 
-		ke1 := client.LoginInit([]byte("yo"))
-		ke2, _ := server.LoginInit(ke1, nil, sks, pks, oprfSeed, rec)
+		ke1, state := client.LoginInit([]byte("yo"))
+		ke2, _, _ := server.LoginInit(ke1, nil, keys, rec)
 
 		ke2.Mac = internal.RandomBytes(client.GetConf().MAC.Size())
 		expected := " AKE finalization: invalid server mac"
-		if _, _, err := client.LoginFinish(nil, nil, ke2); err == nil || !strings.HasPrefix(err.Error(), expected) {
+		if _, _, err := client.LoginFinish(nil, nil, ke2, state); err == nil || !strings.HasPrefix(err.Error(), expected) {
 			t.Fatalf("expected error for invalid epks encoding - got %q", err)
 		}
 	}
@@ -268,7 +267,7 @@ func TestClientFinish_MissingKe1(t *testing.T) {
 	expectedError := "missing KE1 in client state"
 	conf := opaque.DefaultConfiguration()
 	client, _ := conf.Client()
-	if _, _, err := client.LoginFinish(nil, nil, nil); err == nil || !strings.EqualFold(err.Error(), expectedError) {
+	if _, _, err := client.LoginFinish(nil, nil, nil, nil); err == nil || !strings.EqualFold(err.Error(), expectedError) {
 		t.Fatalf(
 			"expected error when calling LoginFinish without pre-existing KE1, want %q, got %q",
 			expectedError,
@@ -276,3 +275,100 @@ func TestClientFinish_MissingKe1(t *testing.T) {
 		)
 	}
 }
+
+func TestClientRegistrationFinalize_StateFinalized(t *testing.T) {
+	credID := internal.RandomBytes(32)
+	conf := opaque.DefaultConfiguration()
+	client, _ := conf.Client()
+	server, _ := conf.Server()
+	keys := serverKeys(t, conf)
+
+	r1, state := client.RegistrationInit([]byte("yo"))
+	r2, err := server.RegistrationResponse(r1, keys, credID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := client.RegistrationFinalize(r2, nil, nil, state); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := client.RegistrationFinalize(r2, nil, nil, state); !errors.Is(err, opaque.ErrStateFinalized) {
+		t.Fatalf("expected %q when finalizing a registration state twice, got %q", opaque.ErrStateFinalized, err)
+	}
+}
+
+func TestClientLoginFinish_StateFinalized(t *testing.T) {
+	credID := internal.RandomBytes(32)
+	conf := opaque.DefaultConfiguration()
+	client, _ := conf.Client()
+	server, _ := conf.Server()
+	keys := serverKeys(t, conf)
+	rec := buildRecord(credID, []byte("yo"), keys, client, server)
+
+	ke1, state := client.LoginInit([]byte("yo"))
+	ke2, _, err := server.LoginInit(ke1, nil, keys, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := client.LoginFinish(nil, nil, ke2, state); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := client.LoginFinish(nil, nil, ke2, state); !errors.Is(err, opaque.ErrStateFinalized) {
+		t.Fatalf("expected %q when finalizing a login state twice, got %q", opaque.ErrStateFinalized, err)
+	}
+}
+
+func TestClientLoginFinish_FailedStateConsumed(t *testing.T) {
+	credID := internal.RandomBytes(32)
+	conf := opaque.DefaultConfiguration()
+	client, _ := conf.Client()
+	server, _ := conf.Server()
+	keys := serverKeys(t, conf)
+	rec := buildRecord(credID, []byte("yo"), keys, client, server)
+
+	ke1, state := client.LoginInit([]byte("yo"))
+	ke2, _, err := server.LoginInit(ke1, nil, keys, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mac := ke2.Mac
+	ke2.Mac = internal.RandomBytes(len(mac))
+
+	if _, _, err := client.LoginFinish(nil, nil, ke2, state); err == nil {
+		t.Fatal("expected error for invalid server mac")
+	}
+
+	// The ephemeral secret key and nonce of the failed login are not used again, even with a valid KE2.
+	ke2.Mac = mac
+
+	if _, _, err := client.LoginFinish(nil, nil, ke2, state); !errors.Is(err, opaque.ErrStateFinalized) {
+		t.Fatalf("expected %q when finishing a failed login state again, got %q", opaque.ErrStateFinalized, err)
+	}
+
+	if _, err := client.SerializeLoginState(state, nil); !errors.Is(err, opaque.ErrStateFinalized) {
+		t.Fatalf("expected %q when exporting a failed login state, got %q", opaque.ErrStateFinalized, err)
+	}
+}
+
+func TestClientLoginInit_IndependentSessions(t *testing.T) {
+	client, _ := opaque.DefaultConfiguration().Client()
+
+	ke1a, _ := client.LoginInit([]byte("yo"))
+	ke1b, _ := client.LoginInit([]byte("yo"))
+
+	if bytes.Equal(ke1a.NonceU, ke1b.NonceU) {
+		t.Fatal("two sessions on the same client share the same nonce")
+	}
+
+	if bytes.Equal(ke1a.EpkU.Bytes(), ke1b.EpkU.Bytes()) {
+		t.Fatal("two sessions on the same client share the same ephemeral public key")
+	}
+
+	if bytes.Equal(ke1a.BlindedMessage.Bytes(), ke1b.BlindedMessage.Bytes()) {
+		t.Fatal("two sessions on the same client share the same blinded element")
+	}
+}
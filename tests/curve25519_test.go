@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/bytemare/crypto/group"
+
+	"github.com/bytemare/opaque"
+	"github.com/bytemare/opaque/internal/encoding"
+)
+
+var (
+	errInvalidAkePoint  = errors.New("point is the identity or not in the prime-order subgroup")
+	errInvalidClientEPK = errors.New("invalid ephemeral client public key")
+	errInvalidServerEPK = errors.New("invalid ephemeral server public key")
+)
+
+func curve25519Conf(mode opaque.AKEMode) *opaque.Configuration {
+	conf := opaque.DefaultConfiguration()
+	conf.AKE = opaque.Curve25519Sha512
+	conf.Mode = mode
+
+	return conf
+}
+
+// lowOrderPoints returns the encodings of a point of order 2, and of a point of mixed order, i.e. the sum of a valid
+// point and a point of low order.
+func lowOrderPoints(t *testing.T) [][]byte {
+	g := group.Curve25519Sha512
+
+	// u = 0 is the point of order 2.
+	lowOrder, err := g.NewElement().Decode(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mixed := g.Base().Mult(g.NewScalar().Random()).Add(lowOrder)
+
+	return [][]byte{encoding.SerializePoint(lowOrder, g), encoding.SerializePoint(mixed, g)}
+}
+
+func TestCurve25519_Login(t *testing.T) {
+	for i := 0; i < 8; i++ {
+		conf := curve25519Conf(opaque.TripleDH)
+		keys := serverKeys(t, conf)
+		test := &testParams{
+			Configuration: conf,
+			username:      []byte("client"),
+			userID:        []byte("client"),
+			serverID:      []byte("server"),
+			password:      []byte("password"),
+			serverKeys:    keys.Serialize(),
+		}
+
+		// Messages go through their encodings, with Ristretto255 OPRF elements and Curve25519 AKE elements. These only
+		// hold the x-coordinate, and the sign of the points must thus not matter.
+		record, exportKeyReg := testRegistration(t, test)
+		exportKeyLogin := testAuthentication(t, test, record)
+
+		if !bytes.Equal(exportKeyReg, exportKeyLogin) {
+			t.Errorf("export keys differ")
+		}
+	}
+}
+
+func TestCurve25519_DeterministicFakeRecord(t *testing.T) {
+	conf := curve25519Conf(opaque.TripleDH)
+	seed := conf.GenerateFakeRecordSeed()
+
+	r1, err := conf.GetDeterministicFakeRecord(seed, []byte("unknown"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r2, err := conf.GetDeterministicFakeRecord(seed, []byte("unknown"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(r1.PublicKey.Bytes(), r2.PublicKey.Bytes()) || !bytes.Equal(r1.MaskingKey, r2.MaskingKey) {
+		t.Fatal("deterministic fake records differ")
+	}
+}
+
+func TestCurve25519_LowOrderPoints(t *testing.T) {
+	conf := curve25519Conf(opaque.TripleDH)
+	client, _ := conf.Client()
+	server, _ := conf.Server()
+	keys := serverKeys(t, conf)
+	record := buildRecord([]byte("credID"), []byte("password"), keys, client, server)
+
+	ke1, _ := client.LoginInit([]byte("password"))
+
+	ke2, _, err := server.LoginInit(ke1, nil, keys, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encodedKE1 := ke1.Serialize()
+	encodedKE2 := ke2.Serialize()
+	ke1Offset := len(encodedKE1) - 32
+	ke2Offset := len(encodedKE2) - conf.MAC.Size() - 32
+
+	for _, point := range lowOrderPoints(t) {
+		badKE1 := append(append([]byte(nil), encodedKE1[:ke1Offset]...), point...)
+		if _, err := server.Deserialize.KE1(badKE1); err == nil || err.Error() != errInvalidClientEPK.Error() {
+			t.Fatalf("expected error %q, got %v", errInvalidClientEPK, err)
+		}
+
+		badKE2 := append([]byte(nil), encodedKE2...)
+		copy(badKE2[ke2Offset:], point)
+
+		if _, err := client.Deserialize.KE2(badKE2); err == nil || err.Error() != errInvalidServerEPK.Error() {
+			t.Fatalf("expected error %q, got %v", errInvalidServerEPK, err)
+		}
+
+		if _, err := client.Deserialize.DecodeAkePublicKey(point); err == nil ||
+			err.Error() != errInvalidAkePoint.Error() {
+			t.Fatalf("expected error %q, got %v", errInvalidAkePoint, err)
+		}
+	}
+}
+
+func TestCurve25519_Modes(t *testing.T) {
+	for _, mode := range []opaque.AKEMode{opaque.HMQV, opaque.SigmaI} {
+		if _, err := curve25519Conf(mode).Client(); !errors.Is(err, opaque.ErrModeGroup) {
+			t.Fatalf("expected error on Curve25519 in mode %d, got %v", mode, err)
+		}
+	}
+}
+
+func TestCurve25519_OPRF(t *testing.T) {
+	conf := curve25519Conf(opaque.TripleDH)
+	conf.OPRF = opaque.Curve25519Sha512
+
+	if _, err := conf.Client(); err == nil || err.Error() != "invalid OPRF group id" {
+		t.Fatalf("expected error on Curve25519 OPRF, got %v", err)
+	}
+}
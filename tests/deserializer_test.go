@@ -9,7 +9,10 @@
 package opaque_test
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/bytemare/crypto/group"
@@ -165,3 +168,80 @@ func TestDeserializeKE3(t *testing.T) {
 		t.Fatalf("Expected error for DeserializeKE1. want %q, got %q", errInvalidMessageLength, err)
 	}
 }
+
+func TestDeserializeJSON(t *testing.T) {
+	c := opaque.DefaultConfiguration()
+	client, _ := c.Client()
+	d := client.Deserialize
+	ke1, _ := client.LoginInit([]byte("password"))
+
+	encoded, err := json.Marshal(ke1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields map[string]string
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	// edit returns the JSON encoding of ke1 with the fields set to the base64url encoding of the values, or removed
+	// for nil values.
+	edit := func(values map[string][]byte) string {
+		edited := make(map[string]string, len(fields))
+		for k, v := range fields {
+			edited[k] = v
+		}
+
+		for k, v := range values {
+			if v == nil {
+				delete(edited, k)
+			} else {
+				edited[k] = base64.RawURLEncoding.EncodeToString(v)
+			}
+		}
+
+		e, _ := json.Marshal(edited)
+
+		return string(e)
+	}
+
+	nonce, _ := base64.RawURLEncoding.DecodeString(fields["client_nonce"])
+	epk, _ := base64.RawURLEncoding.DecodeString(fields["client_ephemeral_pk"])
+
+	for name, in := range map[string]string{
+		"not an object": `"ke1"`,
+		"unknown field": edit(map[string][]byte{"client_identity": []byte("client")}),
+		"duplicate":     `{"client_nonce":"","client_nonce":""}`,
+		"not a string":  `{"client_nonce":1}`,
+		"invalid value": `{"client_nonce":"!"}`,
+		"trailing data": string(encoded) + "{}",
+	} {
+		if _, err := d.KE1JSON([]byte(in)); err == nil ||
+			!strings.HasPrefix(err.Error(), "invalid JSON message encoding") {
+			t.Fatalf("%s: expected JSON error, got %v", name, err)
+		}
+	}
+
+	for name, in := range map[string]string{
+		"missing field": edit(map[string][]byte{"client_nonce": nil}),
+		"shifted field": edit(map[string][]byte{
+			"client_nonce":        nonce[1:],
+			"client_ephemeral_pk": append(nonce[:1:1], epk...),
+		}),
+	} {
+		if _, err := d.KE1JSON([]byte(in)); err == nil || err.Error() != errInvalidMessageLength.Error() {
+			t.Fatalf("%s: expected error %q, got %v", name, errInvalidMessageLength, err)
+		}
+	}
+
+	// Invalid points are rejected as in the binary encoding.
+	_, binaryErr := d.KE1(encoding.Concat3(ke1.CredentialRequest.Serialize(), nonce, make([]byte, len(epk))))
+
+	identity := edit(map[string][]byte{"client_ephemeral_pk": make([]byte, len(epk))})
+
+	if _, err := d.KE1JSON([]byte(identity)); err == nil ||
+		binaryErr == nil || err.Error() != binaryErr.Error() {
+		t.Fatalf("expected error %v, got %v", binaryErr, err)
+	}
+}
@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/bytemare/opaque"
+	"github.com/bytemare/opaque/exportkey"
+	"github.com/bytemare/opaque/internal"
+)
+
+func exportKeys(t *testing.T, conf *opaque.Configuration, exportKey []byte) *exportkey.Keys {
+	k, err := exportkey.New(conf, exportKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return k
+}
+
+func TestExportKey_Derive(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	k := exportKeys(t, conf, internal.RandomBytes(64))
+
+	a, err := k.Derive("backup", 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := k.Derive("backup", 32)
+	c, _ := k.Derive("messages", 32)
+	d, _ := k.Derive("backup", 16)
+
+	if len(a) != 32 || !bytes.Equal(a, b) || bytes.Equal(a, c) || bytes.Equal(a[:16], d) {
+		t.Fatal("unexpected derived keys")
+	}
+
+	if _, err := k.Derive("", 32); !errors.Is(err, exportkey.ErrNoPurpose) {
+		t.Fatalf("expected error %q, got %v", exportkey.ErrNoPurpose, err)
+	}
+
+	if longest, err := k.Derive("backup", 255*conf.KDF.Size()); err != nil || len(longest) != 255*conf.KDF.Size() {
+		t.Fatalf("unexpected error or length for the longest key: %v", err)
+	}
+
+	for _, length := range []int{0, -1, 255*conf.KDF.Size() + 1} {
+		if _, err := k.Derive("backup", length); !errors.Is(err, exportkey.ErrKeyLength) {
+			t.Fatalf("expected error %q for length %d, got %v", exportkey.ErrKeyLength, length, err)
+		}
+	}
+
+	if _, err := exportkey.New(conf, nil); !errors.Is(err, exportkey.ErrNoExportKey) {
+		t.Fatalf("expected error %q, got %v", exportkey.ErrNoExportKey, err)
+	}
+}
+
+func TestExportKey_Blob(t *testing.T) {
+	for _, conf := range confs {
+		k := exportKeys(t, conf.Conf, internal.RandomBytes(64))
+		plaintext := []byte("backup")
+		ad := []byte("credential identifier")
+
+		blob, err := k.Seal("backup", plaintext, ad)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opened, err := k.Open("backup", blob, ad)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(opened, plaintext) {
+			t.Fatal("opened blob differs")
+		}
+
+		other := exportKeys(t, conf.Conf, internal.RandomBytes(64))
+		tampered := append([]byte(nil), blob...)
+		tampered[len(tampered)-1] ^= 1
+
+		for name, open := range map[string]func() ([]byte, error){
+			"other key":     func() ([]byte, error) { return other.Open("backup", blob, ad) },
+			"other purpose": func() ([]byte, error) { return k.Open("messages", blob, ad) },
+			"other ad":      func() ([]byte, error) { return k.Open("backup", blob, nil) },
+			"tampered":      func() ([]byte, error) { return k.Open("backup", tampered, ad) },
+		} {
+			if _, err := open(); !errors.Is(err, exportkey.ErrBlobAuthentication) {
+				t.Fatalf("%s: expected error %q, got %v", name, exportkey.ErrBlobAuthentication, err)
+			}
+		}
+
+		version := append([]byte{0xff}, blob[1:]...)
+		if _, err := k.Open("backup", version, ad); !errors.Is(err, exportkey.ErrBlobVersion) {
+			t.Fatalf("expected error %q, got %v", exportkey.ErrBlobVersion, err)
+		}
+
+		for _, short := range [][]byte{nil, blob[:10]} {
+			if _, err := k.Open("backup", short, ad); err == nil {
+				t.Fatal("expected error on short blob")
+			}
+		}
+	}
+}
+
+func TestExportKey_PasswordChange(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	p := loggedIn(t, conf, []byte("old"))
+	ad := p.record.CredentialIdentifier
+	oldKeys := exportKeys(t, conf, p.clientLogin.ExportKey())
+
+	b1, _ := oldKeys.Seal("backup", []byte("first"), ad)
+	b2, _ := oldKeys.Seal("backup", []byte("second"), ad)
+
+	upload, oldExportKey, newExportKey := p.upload(t, []byte("new"))
+	if _, err := p.finish(upload, p.serverLogin); err != nil {
+		t.Fatal(err)
+	}
+
+	newKeys := exportKeys(t, conf, newExportKey)
+
+	blobs, err := exportkey.Reencrypt(exportKeys(t, conf, oldExportKey), newKeys, "backup", ad, b1, b2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, expected := range []string{"first", "second"} {
+		opened, err := newKeys.Open("backup", blobs[i], ad)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(opened) != expected {
+			t.Fatalf("blob %d differs after re-encryption", i)
+		}
+	}
+
+	if _, err := exportkey.Reencrypt(newKeys, oldKeys, "backup", ad, b1); !errors.Is(
+		err, exportkey.ErrBlobAuthentication) {
+		t.Fatalf("expected error %q, got %v", exportkey.ErrBlobAuthentication, err)
+	}
+}
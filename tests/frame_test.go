@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/bytemare/opaque"
+	"github.com/bytemare/opaque/message"
+)
+
+func TestFrame_Configurations(t *testing.T) {
+	confA := opaque.DefaultConfiguration()
+	confB := opaque.DefaultConfiguration()
+	confB.Context = []byte("another deployment")
+
+	if bytes.Equal(confA.ID(), confB.ID()) || len(confA.ID()) != opaque.ConfigurationIDLength {
+		t.Fatal("unexpected configuration identifiers")
+	}
+
+	client, _ := confB.Client()
+	ke1, _ := client.LoginInit([]byte("password"))
+
+	frame, err := confB.Frame(ke1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A server supporting both configurations selects the Deserializer of the frame.
+	deserializers := make(map[string]*opaque.Deserializer)
+
+	for _, conf := range []*opaque.Configuration{confA, confB} {
+		d, err := conf.Deserializer()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		deserializers[string(conf.ID())] = d
+	}
+
+	header, err := opaque.DecodeFrameHeader(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if header.Type != opaque.MessageKE1 || !bytes.Equal(header.ConfigurationID, confB.ID()) {
+		t.Fatal("unexpected frame header")
+	}
+
+	decoded, err := deserializers[string(header.ConfigurationID)].Decode(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := decoded.(*message.KE1); !ok {
+		t.Fatalf("expected a KE1, got %T", decoded)
+	}
+
+	if _, err := deserializers[string(confA.ID())].Decode(frame); !errors.Is(err, opaque.ErrFrameConfiguration) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrFrameConfiguration, err)
+	}
+}
+
+func TestFrame_Invalid(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	client, _ := conf.Client()
+	d, _ := conf.Deserializer()
+	request, _ := client.RegistrationInit([]byte("password"))
+
+	frame, err := conf.Frame(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := conf.Frame(&message.CredentialRequest{}); err == nil {
+		t.Fatal("expected error on framing a message without type")
+	}
+
+	edit := func(f func([]byte) []byte) []byte {
+		return f(append([]byte(nil), frame...))
+	}
+
+	if _, err := d.Decode(edit(func(b []byte) []byte {
+		b[1]++
+		return b
+	})); !errors.Is(err, opaque.ErrFrameVersion) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrFrameVersion, err)
+	}
+
+	for name, invalid := range map[string][]byte{
+		"empty":             nil,
+		"truncated header":  frame[:5],
+		"truncated message": frame[:len(frame)-1],
+		"trailing bytes":    append(edit(func(b []byte) []byte { return b }), 0),
+		"unknown type": edit(func(b []byte) []byte {
+			b[0] = 0
+			return b
+		}),
+		// A RegistrationRequest doesn't decode as a KE1, even though it could be of the same length as one.
+		"other type": edit(func(b []byte) []byte {
+			b[0] = byte(opaque.MessageKE1)
+			return b
+		}),
+	} {
+		if _, err := d.Decode(invalid); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
@@ -73,18 +73,17 @@ var confs = []configuration{
 		},
 		Curve: elliptic.P521(),
 	},
-	//{
-	//	Conf: &opaque.Configuration{
-	//		OPRF: opaque.RistrettoSha512,
-	//		KDF:  crypto.SHA512,
-	//		MAC:  crypto.SHA512,
-	//		Hash: crypto.SHA512,
-	//		KSF:  ksf.Scrypt,
-	//		Mode: opaque.Internal,
-	//		AKE:  opaque.Curve25519Sha512,
-	//	},
-	//	Curve: nil,
-	//},
+	{
+		Conf: &opaque.Configuration{
+			OPRF: opaque.RistrettoSha512,
+			KDF:  crypto.SHA512,
+			MAC:  crypto.SHA512,
+			Hash: crypto.SHA512,
+			KSF:  ksf.Scrypt,
+			AKE:  opaque.Curve25519Sha512,
+		},
+		Curve: nil,
+	},
 }
 
 func getBadRistrettoScalar() []byte {
@@ -146,8 +145,8 @@ func getBadElement(t *testing.T, c configuration) []byte {
 	switch c.Conf.AKE {
 	case opaque.RistrettoSha512:
 		return getBadRistrettoElement()
-	// case opaque.Curve25519Sha512:
-	//	return getBad25519Element()
+	case opaque.Curve25519Sha512:
+		return getBad25519Element()
 	default:
 		return getBadNistElement(t, group.Group(c.Conf.AKE))
 	}
@@ -157,26 +156,37 @@ func getBadScalar(t *testing.T, c configuration) []byte {
 	switch c.Conf.AKE {
 	case opaque.RistrettoSha512:
 		return getBadRistrettoScalar()
-	// case opaque.Curve25519Sha512:
-	//	return getBad25519Scalar()
+	case opaque.Curve25519Sha512:
+		return getBad25519Scalar()
 	default:
 		return badScalar(t, oprf.Ciphersuite(c.Conf.AKE).Group(), c.Curve)
 	}
 }
 
+func serverKeys(t *testing.T, conf *opaque.Configuration) *opaque.ServerKeyMaterial {
+	keys, err := conf.GenerateServerKeyMaterial()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keys
+}
+
 func buildRecord(
-	credID, oprfSeed, password, pks []byte,
+	credID, password []byte,
+	keys *opaque.ServerKeyMaterial,
 	client *opaque.Client,
 	server *opaque.Server,
 ) *opaque.ClientRecord {
-	conf := server.GetConf()
-	r1 := client.RegistrationInit(password)
-	pk, err := conf.Group.NewElement().Decode(pks)
+	r1, state := client.RegistrationInit(password)
+	r2, err := server.RegistrationResponse(r1, keys, credID)
+	if err != nil {
+		panic(err)
+	}
+	r3, _, err := client.RegistrationFinalize(r2, nil, nil, state)
 	if err != nil {
 		panic(err)
 	}
-	r2 := server.RegistrationResponse(r1, pk, credID, oprfSeed)
-	r3, _ := client.RegistrationFinalize(r2, nil, nil)
 
 	return &opaque.ClientRecord{
 		CredentialIdentifier: credID,
@@ -186,6 +196,36 @@ func buildRecord(
 	}
 }
 
+// login runs a full login for the record, and returns the session and export keys.
+func login(
+	t *testing.T,
+	conf *opaque.Configuration,
+	password []byte,
+	keys *opaque.ServerKeyMaterial,
+	record *opaque.ClientRecord,
+) (sessionKey, exportKey []byte) {
+	client, _ := conf.Client()
+	server, _ := conf.Server()
+
+	ke1, clientState := client.LoginInit(password)
+
+	ke2, serverState, err := server.LoginInit(ke1, nil, keys, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ke3, exportKey, err := client.LoginFinish(nil, nil, ke2, clientState)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.LoginFinish(ke3, serverState); err != nil {
+		t.Fatal(err)
+	}
+
+	return clientState.SessionKey(), exportKey
+}
+
 func xorResponse(c *internal.Configuration, key, nonce, in []byte) []byte {
 	pad := c.KDF.Expand(
 		key,
@@ -203,17 +243,21 @@ func xorResponse(c *internal.Configuration, key, nonce, in []byte) []byte {
 	return dst
 }
 
-func buildPRK(client *opaque.Client, evaluation *group.Point) ([]byte, error) {
+func buildPRK(client *opaque.Client, state *opaque.ClientLoginState, evaluation *group.Point) ([]byte, error) {
 	conf := client.GetConf()
-	unblinded := client.OPRF.Finalize(evaluation)
+	unblinded := state.OPRF.Finalize(evaluation)
 	hardened := conf.KSF.Harden(unblinded, nil, conf.OPRFPointLength)
 
 	return conf.KDF.Extract(nil, hardened), nil
 }
 
-func getEnvelope(client *opaque.Client, ke2 *message.KE2) (*keyrecovery.Envelope, []byte, error) {
+func getEnvelope(
+	client *opaque.Client,
+	state *opaque.ClientLoginState,
+	ke2 *message.KE2,
+) (*keyrecovery.Envelope, []byte, error) {
 	conf := client.GetConf()
-	randomizedPwd, err := buildPRK(client, ke2.EvaluatedMessage)
+	randomizedPwd, err := buildPRK(client, state, ke2.EvaluatedMessage)
 	if err != nil {
 		return nil, nil, fmt.Errorf("finalizing OPRF : %w", err)
 	}
@@ -0,0 +1,197 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bytemare/opaque"
+	"github.com/bytemare/opaque/internal"
+)
+
+func keyring(t *testing.T, conf *opaque.Configuration, versions ...uint32) *opaque.ServerKeyring {
+	k := opaque.NewServerKeyring()
+
+	for _, v := range versions {
+		if err := k.Add(v, serverKeys(t, conf)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return k
+}
+
+func TestServerKeyring(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	k := keyring(t, conf, 2, 1)
+
+	if v, keys := k.Current(); v != 2 || keys == nil {
+		t.Fatalf("expected current version 2, got %d", v)
+	}
+
+	if !reflect.DeepEqual(k.Versions(), []uint32{1, 2}) {
+		t.Fatalf("unexpected versions %v", k.Versions())
+	}
+
+	if err := k.Add(1, serverKeys(t, conf)); !errors.Is(err, opaque.ErrKeyVersionExists) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrKeyVersionExists, err)
+	}
+
+	if err := k.Add(3, nil); !errors.Is(err, opaque.ErrNoServerKeyMaterial) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrNoServerKeyMaterial, err)
+	}
+
+	if err := k.Add(3, serverKeys(t, confs[1].Conf)); !errors.Is(err, opaque.ErrServerKeyMaterialConfiguration) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrServerKeyMaterialConfiguration, err)
+	}
+
+	if err := k.Remove(2); !errors.Is(err, opaque.ErrRemoveCurrentKeyVersion) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrRemoveCurrentKeyVersion, err)
+	}
+
+	if err := k.Remove(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := k.Get(1); !errors.Is(err, opaque.ErrUnknownKeyVersion) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrUnknownKeyVersion, err)
+	}
+}
+
+func TestServerKeyring_Serialization(t *testing.T) {
+	for _, conf := range confs {
+		k := keyring(t, conf.Conf, 1, 5)
+
+		decoded, err := conf.Conf.DeserializeServerKeyring(k.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(decoded.Serialize(), k.Serialize()) {
+			t.Fatal("decoded keyring differs")
+		}
+
+		if v, _ := decoded.Current(); v != 5 {
+			t.Fatalf("expected current version 5, got %d", v)
+		}
+
+		encoded := k.Serialize()
+		if _, err := conf.Conf.DeserializeServerKeyring(encoded[:len(encoded)-1]); err == nil {
+			t.Fatal("expected error on truncated keyring")
+		}
+	}
+}
+
+func TestServerKeyring_Rotation(t *testing.T) {
+	for _, conf := range confs {
+		password := []byte("password")
+		k := keyring(t, conf.Conf, 1)
+		p := loggedInWithKeyring(t, conf.Conf, password, k)
+
+		// Rotate: new registrations use the current version, and records of version 1 still log in with their key
+		// material.
+		if err := k.Add(2, serverKeys(t, conf.Conf)); err != nil {
+			t.Fatal(err)
+		}
+
+		r1, _ := p.client.RegistrationInit(password)
+
+		_, version, err := p.server.RegistrationResponseWithKeyring(r1, k, p.record.CredentialIdentifier)
+		if err != nil || version != 2 {
+			t.Fatalf("expected key version 2, got %d (%v)", version, err)
+		}
+
+		clientLogin, serverLogin := p.logIn(t, password)
+
+		if !k.NeedsReRegistration(p.record) {
+			t.Fatal("expected the record to need re-registration")
+		}
+
+		// In the login session, the client registers again under the current version by changing its password to the
+		// same one.
+		req, state, err := p.client.PasswordChangeInit(password, clientLogin)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, version, err := p.server.PasswordChangeResponseWithKeyring(req, serverLogin, k, p.record)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		upload, _, err := p.client.PasswordChangeFinalize(resp, nil, nil, state)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p.record, err = p.server.PasswordChangeFinish(upload, serverLogin, p.record, version, p.store)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p.record.KeyVersion != 2 || k.NeedsReRegistration(p.record) {
+			t.Fatalf("expected the record to be of current version, got %d", p.record.KeyVersion)
+		}
+
+		if err := k.Remove(1); err != nil {
+			t.Fatal(err)
+		}
+
+		p.logIn(t, password)
+	}
+}
+
+func TestServerKeyring_UnknownVersion(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	client, _ := conf.Client()
+	server, _ := conf.Server()
+	k := keyring(t, conf, 1)
+	_, keys := k.Current()
+	record := buildRecord(internal.RandomBytes(32), []byte("password"), keys, client, server)
+	record.KeyVersion = 3
+
+	ke1, _ := client.LoginInit([]byte("password"))
+	if _, _, err := server.LoginInitWithKeyring(ke1, nil, k, record); !errors.Is(err, opaque.ErrUnknownKeyVersion) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrUnknownKeyVersion, err)
+	}
+}
+
+func TestServerKeyring_FakeRecord(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	client, _ := conf.Client()
+	server, _ := conf.Server()
+	k := keyring(t, conf, 4)
+	_, current := k.Current()
+
+	record, err := server.GetRecord(opaque.NewMemoryRecordStore(), internal.RandomBytes(32), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if k.NeedsReRegistration(record) {
+		t.Fatal("fake records must not need re-registration")
+	}
+
+	keys, err := k.ForRecord(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(keys.PublicKey(), current.PublicKey()) {
+		t.Fatal("fake records must use the current key material")
+	}
+
+	ke1, _ := client.LoginInit([]byte("password"))
+	if _, _, err := server.LoginInitWithKeyring(ke1, nil, k, record); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,385 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque_test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"errors"
+	"testing"
+
+	"github.com/bytemare/crypto/ksf"
+
+	"github.com/bytemare/opaque"
+	"github.com/bytemare/opaque/internal"
+)
+
+var (
+	errInvalidKSFParameters = errors.New("invalid KSF parameters")
+	errKeyStretcherKSF      = errors.New("a KeyStretcher can't be used with a KSF identifier")
+)
+
+// stretcher is a custom KeyStretcher recording the salts it's called with.
+type stretcher struct {
+	salts [][]byte
+}
+
+func (s *stretcher) Harden(password, salt []byte, length int) []byte {
+	s.salts = append(s.salts, salt)
+	mac := hmac.New(sha512.New, salt)
+	_, _ = mac.Write(password)
+
+	return mac.Sum(nil)[:length]
+}
+
+func ksfConf(id ksf.Identifier) *opaque.Configuration {
+	conf := opaque.DefaultConfiguration()
+	conf.KSF = id
+
+	return conf
+}
+
+func parameterizedConfs() []*opaque.Configuration {
+	scrypt := ksfConf(ksf.Scrypt)
+	scrypt.Scrypt = &opaque.ScryptParameters{N: 16, R: 8, P: 1}
+
+	argon := ksfConf(ksf.Argon2id)
+	argon.Argon2id = &opaque.Argon2idParameters{Time: 1, Memory: 64, Threads: 2}
+
+	pbkdf := ksfConf(ksf.PBKDF2Sha512)
+	pbkdf.PBKDF2 = &opaque.PBKDF2Parameters{Iterations: 10}
+
+	return []*opaque.Configuration{scrypt, argon, pbkdf}
+}
+
+func TestKSFParameters_Serialization(t *testing.T) {
+	for _, conf := range parameterizedConfs() {
+		encoded := conf.Serialize()
+
+		decoded, err := opaque.DeserializeConfiguration(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !isSameConf(conf, decoded) {
+			t.Fatalf("%s: decoded configuration differs", conf.KSF)
+		}
+
+		// The parameters are bound to the encoding, which is unchanged without them.
+		defaults := ksfConf(conf.KSF)
+		if bytes.Equal(encoded, defaults.Serialize()) {
+			t.Fatalf("%s: parameters are not encoded", conf.KSF)
+		}
+
+		if !bytes.HasPrefix(encoded, defaults.Serialize()) {
+			t.Fatalf("%s: parameters change the encoding of the other fields", conf.KSF)
+		}
+	}
+}
+
+func TestKSFParameters_Login(t *testing.T) {
+	password := []byte("password")
+
+	for _, conf := range parameterizedConfs() {
+		client, _ := conf.Client()
+		server, _ := conf.Server()
+		keys := serverKeys(t, conf)
+		record := buildRecord(internal.RandomBytes(32), password, keys, client, server)
+
+		login(t, conf, password, keys, record)
+
+		// The client must use the parameters, and thus fails to recover its credentials with the defaults.
+		defaults, _ := ksfConf(conf.KSF).Client()
+		ke1, state := defaults.LoginInit(password)
+
+		ke2, _, err := server.LoginInit(ke1, nil, keys, record)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := defaults.LoginFinish(nil, nil, ke2, state); err == nil {
+			t.Fatalf("%s: expected error when logging in with the default parameters", conf.KSF)
+		}
+	}
+}
+
+func TestKSFParameters_Invalid(t *testing.T) {
+	tests := map[string]func(c *opaque.Configuration){
+		"scrypt N not a power of 2": func(c *opaque.Configuration) {
+			c.Scrypt = &opaque.ScryptParameters{N: 24, R: 8, P: 1}
+		},
+		"scrypt N of 1": func(c *opaque.Configuration) { c.Scrypt = &opaque.ScryptParameters{N: 1, R: 8, P: 1} },
+		"scrypt R of 0": func(c *opaque.Configuration) { c.Scrypt = &opaque.ScryptParameters{N: 16, P: 1} },
+		"scrypt R*P too large": func(c *opaque.Configuration) {
+			c.Scrypt = &opaque.ScryptParameters{N: 16, R: 1 << 15, P: 1 << 15}
+		},
+		"argon2id time of 0": func(c *opaque.Configuration) {
+			c.KSF = ksf.Argon2id
+			c.Argon2id = &opaque.Argon2idParameters{Memory: 64, Threads: 1}
+		},
+		"argon2id too many threads": func(c *opaque.Configuration) {
+			c.KSF = ksf.Argon2id
+			c.Argon2id = &opaque.Argon2idParameters{Time: 1, Memory: 1 << 16, Threads: 256}
+		},
+		"argon2id too little memory": func(c *opaque.Configuration) {
+			c.KSF = ksf.Argon2id
+			c.Argon2id = &opaque.Argon2idParameters{Time: 1, Memory: 15, Threads: 2}
+		},
+		"pbkdf2 no iterations": func(c *opaque.Configuration) {
+			c.KSF = ksf.PBKDF2Sha512
+			c.PBKDF2 = &opaque.PBKDF2Parameters{}
+		},
+		"scrypt more than 1 GiB": func(c *opaque.Configuration) {
+			c.Scrypt = &opaque.ScryptParameters{N: 1 << 21, R: 8, P: 1}
+		},
+		"scrypt P too large": func(c *opaque.Configuration) {
+			c.Scrypt = &opaque.ScryptParameters{N: 16, R: 8, P: 17}
+		},
+		"argon2id more than 1 GiB": func(c *opaque.Configuration) {
+			c.KSF = ksf.Argon2id
+			c.Argon2id = &opaque.Argon2idParameters{Time: 1, Memory: 1<<20 + 1, Threads: 1}
+		},
+		"argon2id time too large": func(c *opaque.Configuration) {
+			c.KSF = ksf.Argon2id
+			c.Argon2id = &opaque.Argon2idParameters{Time: 17, Memory: 64, Threads: 1}
+		},
+		"pbkdf2 too many iterations": func(c *opaque.Configuration) {
+			c.KSF = ksf.PBKDF2Sha512
+			c.PBKDF2 = &opaque.PBKDF2Parameters{Iterations: 1<<24 + 1}
+		},
+	}
+
+	// Parameters set for another KSF are not encoded.
+	misplaced := map[string]func(c *opaque.Configuration){
+		"parameters of another KSF": func(c *opaque.Configuration) {
+			c.PBKDF2 = &opaque.PBKDF2Parameters{Iterations: 10}
+		},
+		"parameters of several KSFs": func(c *opaque.Configuration) {
+			c.Scrypt = &opaque.ScryptParameters{N: 16, R: 8, P: 1}
+			c.PBKDF2 = &opaque.PBKDF2Parameters{Iterations: 10}
+		},
+		"parameters without KSF": func(c *opaque.Configuration) {
+			c.KSF = 0
+			c.Scrypt = &opaque.ScryptParameters{N: 16, R: 8, P: 1}
+		},
+	}
+
+	for name, setBad := range tests {
+		conf := opaque.DefaultConfiguration()
+		setBad(conf)
+
+		if _, err := conf.Client(); err == nil || err.Error() != errInvalidKSFParameters.Error() {
+			t.Fatalf("%s: expected error %q, got %v", name, errInvalidKSFParameters, err)
+		}
+
+		if _, err := opaque.DeserializeConfiguration(conf.Serialize()); err == nil ||
+			err.Error() != errInvalidKSFParameters.Error() {
+			t.Fatalf("%s: expected error %q on deserialization, got %v", name, errInvalidKSFParameters, err)
+		}
+	}
+
+	for name, setBad := range misplaced {
+		conf := opaque.DefaultConfiguration()
+		setBad(conf)
+
+		if _, err := conf.Client(); err == nil || err.Error() != errInvalidKSFParameters.Error() {
+			t.Fatalf("%s: expected error %q, got %v", name, errInvalidKSFParameters, err)
+		}
+	}
+}
+
+func TestKSFParameters_Limits(t *testing.T) {
+	scrypt := ksfConf(ksf.Scrypt)
+	scrypt.Scrypt = &opaque.ScryptParameters{N: 1 << 20, R: 8, P: 16}
+
+	argon := ksfConf(ksf.Argon2id)
+	argon.Argon2id = &opaque.Argon2idParameters{Time: 16, Memory: 1 << 20, Threads: 255}
+
+	pbkdf := ksfConf(ksf.PBKDF2Sha512)
+	pbkdf.PBKDF2 = &opaque.PBKDF2Parameters{Iterations: 1 << 24}
+
+	// The largest parameters are accepted, but not run here.
+	for _, conf := range []*opaque.Configuration{scrypt, argon, pbkdf} {
+		if _, err := conf.Client(); err != nil {
+			t.Fatalf("%s: %v", conf.KSF, err)
+		}
+
+		if _, err := opaque.DeserializeConfiguration(conf.Serialize()); err != nil {
+			t.Fatalf("%s: %v", conf.KSF, err)
+		}
+	}
+}
+
+func TestKSFParameters_InvalidEncoding(t *testing.T) {
+	conf := parameterizedConfs()[0]
+	encoded := conf.Serialize()
+
+	// Trailing data after the parameters.
+	if _, err := opaque.DeserializeConfiguration(append(encoded, 0)); err == nil {
+		t.Fatal("expected error on trailing data")
+	}
+
+	// Empty salt.
+	if _, err := opaque.DeserializeConfiguration(append(encoded, 0, 0)); !errors.Is(
+		err,
+		internal.ErrConfigurationInvalidLength,
+	) {
+		t.Fatalf("expected error %q, got %v", internal.ErrConfigurationInvalidLength, err)
+	}
+
+	// Truncated parameters.
+	if _, err := opaque.DeserializeConfiguration(encoded[:len(encoded)-1]); err == nil {
+		t.Fatal("expected error on truncated parameters")
+	}
+
+	// Parameters of the wrong length for the KSF.
+	bad := append(conf.Serialize()[:len(encoded)-14], 0, 8)
+	bad = append(bad, encoded[len(encoded)-12:len(encoded)-4]...)
+
+	if _, err := opaque.DeserializeConfiguration(bad); err == nil || err.Error() != errInvalidKSFParameters.Error() {
+		t.Fatalf("expected error %q, got %v", errInvalidKSFParameters, err)
+	}
+
+	// Parameters for a KSF that has none.
+	bcrypt := append(ksfConf(ksf.Bcrypt).Serialize(), encoded[len(encoded)-16:]...)
+
+	if _, err := opaque.DeserializeConfiguration(bcrypt); err == nil ||
+		err.Error() != errInvalidKSFParameters.Error() {
+		t.Fatalf("expected error %q, got %v", errInvalidKSFParameters, err)
+	}
+}
+
+func TestKeyStretcher(t *testing.T) {
+	custom := &stretcher{}
+	salt := []byte("deployment salt")
+	conf := ksfConf(0)
+	conf.KeyStretcher = custom
+	conf.KSFSalt = salt
+	keys := serverKeys(t, conf)
+	test := &testParams{
+		Configuration: conf,
+		username:      []byte("client"),
+		userID:        []byte("client"),
+		serverID:      []byte("server"),
+		password:      []byte("password"),
+		serverKeys:    keys.Serialize(),
+	}
+
+	record, exportKeyReg := testRegistration(t, test)
+	exportKeyLogin := testAuthentication(t, test, record)
+
+	if !bytes.Equal(exportKeyReg, exportKeyLogin) {
+		t.Fatal("export keys differ")
+	}
+
+	if len(custom.salts) != 2 || !bytes.Equal(custom.salts[0], salt) || !bytes.Equal(custom.salts[1], salt) {
+		t.Fatalf("expected the stretcher to be called with the salt in registration and login, got %q", custom.salts)
+	}
+
+	// The stretcher, and its salt, change the randomized password.
+	server, _ := conf.Server()
+	identity := ksfConf(0)
+	identity.KSFSalt = salt
+	otherSalt := ksfConf(0)
+	otherSalt.KeyStretcher = custom
+	otherSalt.KSFSalt = []byte("other salt")
+
+	for _, other := range []*opaque.Configuration{identity, otherSalt} {
+		client, _ := other.Client()
+		ke1, state := client.LoginInit(test.password)
+
+		ke2, _, err := server.LoginInit(ke1, nil, keys, record)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := client.LoginFinish(nil, nil, ke2, state); err == nil {
+			t.Fatal("expected error when logging in with another stretcher or salt")
+		}
+	}
+}
+
+func TestKeyStretcher_KSF(t *testing.T) {
+	conf := ksfConf(ksf.Scrypt)
+	conf.KeyStretcher = &stretcher{}
+
+	if _, err := conf.Client(); err == nil || err.Error() != errKeyStretcherKSF.Error() {
+		t.Fatalf("expected error %q, got %v", errKeyStretcherKSF, err)
+	}
+}
+
+func TestKeyStretcher_Serialization(t *testing.T) {
+	conf := ksfConf(0)
+	conf.KeyStretcher = &stretcher{}
+	identity := ksfConf(0)
+
+	// The custom stretcher is marked in the encoding, which then differs from the one of the identity KSF.
+	if bytes.Equal(conf.Serialize(), identity.Serialize()) || bytes.Equal(conf.ID(), identity.ID()) {
+		t.Fatal("the custom KSF is not part of the encoding")
+	}
+
+	decoded, err := opaque.DeserializeConfiguration(conf.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !decoded.CustomKSF || decoded.KSF != 0 {
+		t.Fatal("expected a decoded configuration marked with the custom KSF")
+	}
+
+	if _, err := decoded.Client(); !errors.Is(err, opaque.ErrMissingKeyStretcher) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrMissingKeyStretcher, err)
+	}
+
+	if _, err := decoded.Server(); !errors.Is(err, opaque.ErrMissingKeyStretcher) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrMissingKeyStretcher, err)
+	}
+
+	decoded.KeyStretcher = conf.KeyStretcher
+
+	if _, err := decoded.Client(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decoded.Serialize(), conf.Serialize()) {
+		t.Fatal("expected the same encoding once the stretcher is set")
+	}
+
+	// The marker can't be combined with a KSF.
+	decoded.KSF = ksf.Scrypt
+
+	if _, err := decoded.Client(); err == nil || err.Error() != errKeyStretcherKSF.Error() {
+		t.Fatalf("expected error %q, got %v", errKeyStretcherKSF, err)
+	}
+}
+
+func TestKSFSalt_Serialization(t *testing.T) {
+	withParams := parameterizedConfs()[0]
+	withoutParams := ksfConf(ksf.Scrypt)
+
+	for _, conf := range []*opaque.Configuration{withParams, withoutParams} {
+		conf.KSFSalt = []byte("salt")
+
+		decoded, err := opaque.DeserializeConfiguration(conf.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !isSameConf(conf, decoded) {
+			t.Fatal("decoded configuration differs")
+		}
+	}
+
+	// Empty parameters are only valid before a salt.
+	encoded := append(ksfConf(ksf.Scrypt).Serialize(), 1, byte(opaque.TripleDH), 0, 0)
+	if _, err := opaque.DeserializeConfiguration(encoded); !errors.Is(err, internal.ErrConfigurationInvalidLength) {
+		t.Fatalf("expected error %q, got %v", internal.ErrConfigurationInvalidLength, err)
+	}
+}
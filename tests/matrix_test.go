@@ -0,0 +1,252 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque_test
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/bytemare/opaque"
+	"github.com/bytemare/opaque/internal"
+	"github.com/bytemare/opaque/message"
+)
+
+var (
+	matrixOPRF = []opaque.Group{opaque.RistrettoSha512, opaque.P256Sha256, opaque.P384Sha512, opaque.P521Sha512}
+	matrixAKE  = []opaque.Group{
+		opaque.RistrettoSha512,
+		opaque.P256Sha256,
+		opaque.P384Sha512,
+		opaque.P521Sha512,
+		opaque.Curve25519Sha512,
+	}
+	matrixHash  = []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512}
+	matrixModes = []opaque.AKEMode{opaque.TripleDH, opaque.HMQV, opaque.SigmaI}
+
+	groupNames = map[opaque.Group]string{
+		opaque.RistrettoSha512:  "Ristretto255",
+		opaque.P256Sha256:       "P256",
+		opaque.P384Sha512:       "P384",
+		opaque.P521Sha512:       "P521",
+		opaque.Curve25519Sha512: "Curve25519",
+	}
+	modeNames = map[opaque.AKEMode]string{opaque.TripleDH: "3DH", opaque.HMQV: "HMQV", opaque.SigmaI: "SIGMA-I"}
+)
+
+type serializer interface {
+	Serialize() []byte
+}
+
+// roundTrip decodes the encoding of the message, and checks that the result encodes the same.
+func roundTrip(t *testing.T, name string, m serializer, decode func([]byte) (serializer, error)) {
+	t.Helper()
+
+	encoded := m.Serialize()
+
+	decoded, err := decode(encoded)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+
+	if !bytes.Equal(encoded, decoded.Serialize()) {
+		t.Fatalf("%s: encodings differ after deserialization", name)
+	}
+}
+
+// jsonRoundTrip decodes the JSON encoding of the message, and checks that the result has the same binary encoding.
+func jsonRoundTrip(t *testing.T, name string, m serializer, decode func([]byte) (serializer, error)) {
+	t.Helper()
+
+	encoded, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+
+	decoded, err := decode(encoded)
+	if err != nil {
+		t.Fatalf("%s JSON: %v", name, err)
+	}
+
+	if !bytes.Equal(m.Serialize(), decoded.Serialize()) {
+		t.Fatalf("%s: encodings differ after JSON deserialization", name)
+	}
+}
+
+// frameRoundTrip decodes the frame of the message, and checks that the result has the same type and encoding.
+func frameRoundTrip(t *testing.T, conf *opaque.Configuration, d *opaque.Deserializer, name string, m opaque.Message) {
+	t.Helper()
+
+	frame, err := conf.Frame(m)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+
+	decoded, err := d.Decode(frame)
+	if err != nil {
+		t.Fatalf("%s frame: %v", name, err)
+	}
+
+	if fmt.Sprintf("%T", decoded) != fmt.Sprintf("%T", m) || !bytes.Equal(m.Serialize(), decoded.Serialize()) {
+		t.Fatalf("%s: message differs after frame decoding", name)
+	}
+}
+
+// matrixLogin runs a registration and a login, in which all messages and the server state go through a round-trip
+// with a Deserializer of the configuration, and the messages also through their JSON encoding and their frame.
+func matrixLogin(t *testing.T, conf *opaque.Configuration) {
+	client, err := conf.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := conf.Server()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := conf.Deserializer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := serverKeys(t, conf)
+	password := []byte("password")
+	credID := internal.RandomBytes(32)
+
+	// Registration.
+	r1, regState := client.RegistrationInit(password)
+	roundTrip(t, "RegistrationRequest", r1, func(b []byte) (serializer, error) { return d.RegistrationRequest(b) })
+	jsonRoundTrip(t, "RegistrationRequest", r1, func(b []byte) (serializer, error) {
+		return d.RegistrationRequestJSON(b)
+	})
+	frameRoundTrip(t, conf, d, "RegistrationRequest", r1)
+
+	r2, err := server.RegistrationResponse(r1, keys, credID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roundTrip(t, "RegistrationResponse", r2, func(b []byte) (serializer, error) { return d.RegistrationResponse(b) })
+	jsonRoundTrip(t, "RegistrationResponse", r2, func(b []byte) (serializer, error) {
+		return d.RegistrationResponseJSON(b)
+	})
+	frameRoundTrip(t, conf, d, "RegistrationResponse", r2)
+
+	r3, exportKeyReg, err := client.RegistrationFinalize(r2, nil, nil, regState)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roundTrip(t, "RegistrationRecord", r3, func(b []byte) (serializer, error) { return d.RegistrationRecord(b) })
+	jsonRoundTrip(t, "RegistrationRecord", r3, func(b []byte) (serializer, error) {
+		return d.RegistrationRecordJSON(b)
+	})
+	frameRoundTrip(t, conf, d, "RegistrationRecord", r3)
+
+	passwordChange := &message.PasswordChangeRecord{RegistrationRecord: r3, Mac: internal.RandomBytes(conf.MAC.Size())}
+	jsonRoundTrip(t, "PasswordChangeRecord", passwordChange, func(b []byte) (serializer, error) {
+		return d.PasswordChangeRecordJSON(b)
+	})
+	frameRoundTrip(t, conf, d, "PasswordChangeRecord", passwordChange)
+
+	passwordChangeResponse := &message.PasswordChangeResponse{
+		RegistrationResponse: r2,
+		Mac:                  internal.RandomBytes(conf.MAC.Size()),
+	}
+	roundTrip(t, "PasswordChangeResponse", passwordChangeResponse, func(b []byte) (serializer, error) {
+		return d.PasswordChangeResponse(b)
+	})
+	jsonRoundTrip(t, "PasswordChangeResponse", passwordChangeResponse, func(b []byte) (serializer, error) {
+		return d.PasswordChangeResponseJSON(b)
+	})
+	frameRoundTrip(t, conf, d, "PasswordChangeResponse", passwordChangeResponse)
+
+	record := &opaque.ClientRecord{CredentialIdentifier: credID, RegistrationRecord: r3}
+
+	// Login.
+	ke1, clientState := client.LoginInit(password)
+	roundTrip(t, "KE1", ke1, func(b []byte) (serializer, error) { return d.KE1(b) })
+	jsonRoundTrip(t, "KE1", ke1, func(b []byte) (serializer, error) { return d.KE1JSON(b) })
+	frameRoundTrip(t, conf, d, "KE1", ke1)
+	jsonRoundTrip(t, "CredentialRequest", ke1.CredentialRequest, func(b []byte) (serializer, error) {
+		return d.CredentialRequestJSON(b)
+	})
+
+	ke2, serverState, err := server.LoginInit(ke1, nil, keys, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roundTrip(t, "KE2", ke2, func(b []byte) (serializer, error) { return d.KE2(b) })
+	jsonRoundTrip(t, "KE2", ke2, func(b []byte) (serializer, error) { return d.KE2JSON(b) })
+	frameRoundTrip(t, conf, d, "KE2", ke2)
+	jsonRoundTrip(t, "CredentialResponse", ke2.CredentialResponse, func(b []byte) (serializer, error) {
+		return d.CredentialResponseJSON(b)
+	})
+
+	ke3, exportKeyLogin, err := client.LoginFinish(nil, nil, ke2, clientState)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roundTrip(t, "KE3", ke3, func(b []byte) (serializer, error) { return d.KE3(b) })
+	jsonRoundTrip(t, "KE3", ke3, func(b []byte) (serializer, error) { return d.KE3JSON(b) })
+	frameRoundTrip(t, conf, d, "KE3", ke3)
+	roundTrip(t, "ServerState", serverState, func(b []byte) (serializer, error) { return server.DeserializeState(b) })
+
+	if err := server.LoginFinish(ke3, serverState); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(clientState.SessionKey(), serverState.SessionKey()) {
+		t.Fatal("session keys differ")
+	}
+
+	if !bytes.Equal(exportKeyReg, exportKeyLogin) {
+		t.Fatal("export keys differ")
+	}
+}
+
+// matrixConfigurations returns every combination of OPRF group, AKE group, hash function, and AKE mode.
+func matrixConfigurations() map[string]*opaque.Configuration {
+	confs := make(map[string]*opaque.Configuration)
+
+	for _, o := range matrixOPRF {
+		for _, a := range matrixAKE {
+			for _, h := range matrixHash {
+				for _, mode := range matrixModes {
+					name := fmt.Sprintf("%s-%s-%s-%s", groupNames[o], groupNames[a], h, modeNames[mode])
+					confs[name] = &opaque.Configuration{OPRF: o, KDF: h, MAC: h, Hash: h, AKE: a, Mode: mode}
+				}
+			}
+		}
+	}
+
+	return confs
+}
+
+func TestConfigurationMatrix(t *testing.T) {
+	for name, conf := range matrixConfigurations() {
+		conf := conf
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := conf.Client(); errors.Is(err, opaque.ErrModeGroup) {
+				t.Skip(err)
+			}
+
+			matrixLogin(t, conf)
+		})
+	}
+}
@@ -23,13 +23,14 @@ import (
 	"github.com/bytemare/opaque/internal"
 	"github.com/bytemare/opaque/internal/encoding"
 	"github.com/bytemare/opaque/internal/oprf"
+	"github.com/bytemare/opaque/message"
 )
 
 const dbgErr = "%v"
 
 type testParams struct {
 	*opaque.Configuration
-	username, userID, serverID, password, serverSecretKey, serverPublicKey, oprfSeed []byte
+	username, userID, serverID, password, serverKeys []byte
 }
 
 func TestFull(t *testing.T) {
@@ -46,12 +47,14 @@ func TestFull(t *testing.T) {
 		userID:        username,
 		serverID:      ids,
 		password:      password,
-		oprfSeed:      conf.GenerateOPRFSeed(),
 	}
 
-	serverSecretKey, pks := conf.KeyGen()
-	test.serverSecretKey = serverSecretKey
-	test.serverPublicKey = pks
+	keys, err := conf.GenerateServerKeyMaterial()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.serverKeys = keys.Serialize()
 
 	/*
 		Registration
@@ -69,13 +72,94 @@ func TestFull(t *testing.T) {
 	}
 }
 
+func TestFull_HMQV(t *testing.T) {
+	for _, c := range confs {
+		// HMQV is not available with the x-only encoding of Curve25519.
+		if c.Conf.AKE == opaque.Curve25519Sha512 {
+			continue
+		}
+
+		conf := *c.Conf
+		conf.Mode = opaque.HMQV
+
+		t.Run(string(conf.OPRF), func(t *testing.T) {
+			keys, err := conf.GenerateServerKeyMaterial()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			test := &testParams{
+				Configuration: &conf,
+				username:      []byte("client"),
+				userID:        []byte("client"),
+				serverID:      []byte("server"),
+				password:      []byte("password"),
+				serverKeys:    keys.Serialize(),
+			}
+
+			record, exportKeyReg := testRegistration(t, test)
+			exportKeyLogin := testAuthentication(t, test, record)
+
+			if !bytes.Equal(exportKeyReg, exportKeyLogin) {
+				t.Errorf("export keys differ")
+			}
+		})
+	}
+}
+
+func TestAKEMode_Mismatch(t *testing.T) {
+	password := []byte("password")
+	clientConf := opaque.DefaultConfiguration()
+	serverConf := opaque.DefaultConfiguration()
+	serverConf.Mode = opaque.HMQV
+
+	client, _ := clientConf.Client()
+	server, _ := serverConf.Server()
+
+	keys, err := serverConf.GenerateServerKeyMaterial()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credID := internal.RandomBytes(32)
+	request, regState := client.RegistrationInit(password)
+	response, err := server.RegistrationResponse(request, keys, credID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upload, _, err := client.RegistrationFinalize(response, nil, nil, regState)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := &opaque.ClientRecord{
+		CredentialIdentifier: credID,
+		RegistrationRecord:   upload,
+	}
+
+	ke1, loginState := client.LoginInit(password)
+
+	ke2, _, err := server.LoginInit(ke1, nil, keys, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := client.LoginFinish(nil, nil, ke2, loginState); err == nil ||
+		!strings.Contains(err.Error(), "invalid server mac") {
+		t.Fatalf("expected error on mismatching AKE modes, got %v", err)
+	}
+}
+
 func testRegistration(t *testing.T, p *testParams) (*opaque.ClientRecord, []byte) {
 	// Client
 	client, _ := p.Client()
 
 	var m1s []byte
+	var state *opaque.ClientRegistrationState
 	{
-		reqReg := client.RegistrationInit(p.password)
+		var reqReg *message.RegistrationRequest
+		reqReg, state = client.RegistrationInit(p.password)
 		m1s = reqReg.Serialize()
 	}
 
@@ -90,12 +174,15 @@ func testRegistration(t *testing.T, p *testParams) (*opaque.ClientRecord, []byte
 		}
 
 		credID = internal.RandomBytes(32)
-		pks, err := server.Deserialize.DecodeAkePublicKey(p.serverPublicKey)
+		keys, err := p.DeserializeServerKeyMaterial(p.serverKeys)
 		if err != nil {
 			t.Fatalf(dbgErr, err)
 		}
 
-		respReg := server.RegistrationResponse(m1, pks, credID, p.oprfSeed)
+		respReg, err := server.RegistrationResponse(m1, keys, credID)
+		if err != nil {
+			t.Fatalf(dbgErr, err)
+		}
 
 		m2s = respReg.Serialize()
 	}
@@ -109,7 +196,11 @@ func testRegistration(t *testing.T, p *testParams) (*opaque.ClientRecord, []byte
 			t.Fatalf(dbgErr, err)
 		}
 
-		upload, key := client.RegistrationFinalize(m2, p.username, p.serverID)
+		upload, key, err := client.RegistrationFinalize(m2, p.username, p.serverID, state)
+		if err != nil {
+			t.Fatalf(dbgErr, err)
+		}
+
 		exportKeyReg = key
 
 		m3s = upload.Serialize()
@@ -136,8 +227,10 @@ func testAuthentication(t *testing.T, p *testParams, record *opaque.ClientRecord
 	client, _ := p.Client()
 
 	var m4s []byte
+	var clientState *opaque.ClientLoginState
 	{
-		ke1 := client.LoginInit(p.password)
+		var ke1 *message.KE1
+		ke1, clientState = client.LoginInit(p.password)
 		m4s = ke1.Serialize()
 	}
 
@@ -151,12 +244,17 @@ func testAuthentication(t *testing.T, p *testParams, record *opaque.ClientRecord
 			t.Fatalf(dbgErr, err)
 		}
 
-		ke2, err := server.LoginInit(m4, p.serverID, p.serverSecretKey, p.serverPublicKey, p.oprfSeed, record)
+		keys, err := p.DeserializeServerKeyMaterial(p.serverKeys)
 		if err != nil {
 			t.Fatalf(dbgErr, err)
 		}
 
-		state = server.SerializeState()
+		ke2, s, err := server.LoginInit(m4, p.serverID, keys, record)
+		if err != nil {
+			t.Fatalf(dbgErr, err)
+		}
+
+		state = s.Serialize()
 
 		m5s = ke2.Serialize()
 	}
@@ -171,14 +269,14 @@ func testAuthentication(t *testing.T, p *testParams, record *opaque.ClientRecord
 			t.Fatalf(dbgErr, err)
 		}
 
-		ke3, key, err := client.LoginFinish(p.username, p.serverID, m5)
+		ke3, key, err := client.LoginFinish(p.username, p.serverID, m5, clientState)
 		if err != nil {
 			t.Fatalf(dbgErr, err)
 		}
 		exportKeyLogin = key
 
 		m6s = ke3.Serialize()
-		clientKey = client.SessionKey()
+		clientKey = clientState.SessionKey()
 	}
 
 	// Server
@@ -190,15 +288,16 @@ func testAuthentication(t *testing.T, p *testParams, record *opaque.ClientRecord
 			t.Fatalf(dbgErr, err)
 		}
 
-		if err := server.SetAKEState(state); err != nil {
+		s, err := server.DeserializeState(state)
+		if err != nil {
 			t.Fatalf(dbgErr, err)
 		}
 
-		if err := server.LoginFinish(m6); err != nil {
+		if err := server.LoginFinish(m6, s); err != nil {
 			t.Fatalf(dbgErr, err)
 		}
 
-		serverKey = server.SessionKey()
+		serverKey = s.SessionKey()
 	}
 
 	if !bytes.Equal(clientKey, serverKey) {
@@ -224,9 +323,19 @@ func isSameConf(a, b *opaque.Configuration) bool {
 	if a.KSF != b.KSF {
 		return false
 	}
+	if !reflect.DeepEqual(a.Scrypt, b.Scrypt) || !reflect.DeepEqual(a.Argon2id, b.Argon2id) ||
+		!reflect.DeepEqual(a.PBKDF2, b.PBKDF2) {
+		return false
+	}
+	if !bytes.Equal(a.KSFSalt, b.KSFSalt) {
+		return false
+	}
 	if a.AKE != b.AKE {
 		return false
 	}
+	if a.Mode != b.Mode {
+		return false
+	}
 
 	return bytes.Equal(a.Context, b.Context)
 }
@@ -245,6 +354,44 @@ func TestConfiguration_Deserialization(t *testing.T) {
 	}
 }
 
+func TestConfiguration_OriginalEncoding(t *testing.T) {
+	// The encoding of the default configuration before AKE modes and KSF parameters were added.
+	original := []byte{1, 7, 7, 7, 2, 1, 0, 0}
+
+	conf, err := opaque.DeserializeConfiguration(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !isSameConf(conf, opaque.DefaultConfiguration()) || !bytes.Equal(conf.Serialize(), original) {
+		t.Fatal("the original encoding changed")
+	}
+
+	hmqv := opaque.DefaultConfiguration()
+	hmqv.Mode = opaque.HMQV
+	encoded := hmqv.Serialize()
+
+	if !bytes.Equal(encoded, append(original, 1, byte(opaque.HMQV))) {
+		t.Fatal("unexpected extension encoding")
+	}
+
+	decoded, err := opaque.DeserializeConfiguration(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !isSameConf(hmqv, decoded) {
+		t.Fatal("decoded configuration differs")
+	}
+
+	// An unknown extension version, and an extension that adds nothing, are rejected.
+	for _, extension := range [][]byte{{2, byte(opaque.HMQV)}, {1, byte(opaque.TripleDH)}, {1, 0}, {1}} {
+		if _, err := opaque.DeserializeConfiguration(append(original, extension...)); err == nil {
+			t.Fatalf("expected error for extension %v", extension)
+		}
+	}
+}
+
 /*
 	The following tests look for failing conditions.
 */
@@ -353,9 +500,28 @@ func TestBadConfiguration(t *testing.T) {
 			},
 			error: "invalid AKE group id",
 		},
+		{
+			name: "Unsupported AKE",
+			makeBad: func() []byte {
+				return setBadValue(5, int(group.Edwards25519Sha512))
+			},
+			error: "invalid AKE group id",
+		},
+		{
+			name: "Bad AKE mode",
+			makeBad: func() []byte {
+				return append(opaque.DefaultConfiguration().Serialize(), 1, 9)
+			},
+			error: "invalid AKE mode",
+		},
 	}
 
 	convertToBadConf := func(encoded []byte) *opaque.Configuration {
+		mode := opaque.TripleDH
+		if len(encoded) > 9 { // The extension follows the empty context.
+			mode = opaque.AKEMode(encoded[9])
+		}
+
 		return &opaque.Configuration{
 			OPRF:    opaque.Group(encoded[0]),
 			KDF:     crypto.Hash(encoded[1]),
@@ -363,6 +529,7 @@ func TestBadConfiguration(t *testing.T) {
 			Hash:    crypto.Hash(encoded[3]),
 			KSF:     ksf.Identifier(encoded[4]),
 			AKE:     opaque.Group(encoded[5]),
+			Mode:    mode,
 			Context: encoded[5:],
 		}
 	}
@@ -426,3 +593,46 @@ func TestFakeRecord(t *testing.T) {
 		t.Fatal("expected error on invalid configuration")
 	}
 }
+
+func TestDeterministicFakeRecord(t *testing.T) {
+	for _, conf := range confs {
+		seed := conf.Conf.GenerateFakeRecordSeed()
+
+		r1, err := conf.Conf.GetDeterministicFakeRecord(seed, []byte("alice"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r2, _ := conf.Conf.GetDeterministicFakeRecord(seed, []byte("alice"))
+		if !isSameRecord(r1, r2) {
+			t.Fatal("fake records for the same seed and credential identifier differ")
+		}
+
+		r3, _ := conf.Conf.GetDeterministicFakeRecord(seed, []byte("bob"))
+		if bytes.Equal(r1.PublicKey.Bytes(), r3.PublicKey.Bytes()) || bytes.Equal(r1.MaskingKey, r3.MaskingKey) {
+			t.Fatal("fake records for different credential identifiers are equal")
+		}
+
+		r4, _ := conf.Conf.GetDeterministicFakeRecord(conf.Conf.GenerateFakeRecordSeed(), []byte("alice"))
+		if bytes.Equal(r1.PublicKey.Bytes(), r4.PublicKey.Bytes()) || bytes.Equal(r1.MaskingKey, r4.MaskingKey) {
+			t.Fatal("fake records for different seeds are equal")
+		}
+
+		// The fake record must be usable as a record.
+		if _, err := r1.Serialize(conf.Conf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conf := opaque.DefaultConfiguration()
+	if _, err := conf.GetDeterministicFakeRecord([]byte("short"), nil); !errors.Is(
+		err,
+		opaque.ErrInvalidFakeRecordSeedLength,
+	) {
+		t.Fatalf("expected %q, got %q", opaque.ErrInvalidFakeRecordSeedLength, err)
+	}
+
+	if _, err := (&opaque.Configuration{}).GetDeterministicFakeRecord(nil, nil); err == nil {
+		t.Fatal("expected error on invalid configuration")
+	}
+}
@@ -0,0 +1,832 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bytemare/opaque"
+	"github.com/bytemare/opaque/message"
+	"github.com/bytemare/opaque/opaquehttp"
+)
+
+// httpFields are the fields of an exchange, sent in headers and the body in raw exchanges, or as a JSON object.
+type httpFields struct {
+	CredentialIdentifier string `json:"credentialIdentifier,omitempty"`
+	ClientIdentity       string `json:"clientIdentity,omitempty"`
+	Session              string `json:"session,omitempty"`
+	Message              string `json:"message,omitempty"`
+}
+
+type httpTest struct {
+	conf     *opaque.Configuration
+	server   *httptest.Server
+	sessions chan []byte
+	json     bool
+}
+
+func newHTTPTest(t *testing.T, useJSON bool) *httpTest {
+	return newWrappedHTTPTest(t, useJSON, nil, nil)
+}
+
+// newWrappedHTTPTest returns an httpTest whose handler is wrapped in the middleware, if any, and whose configuration
+// is edited by configure, if any.
+func newWrappedHTTPTest(
+	t *testing.T,
+	useJSON bool,
+	middleware func(http.Handler) http.Handler,
+	configure func(*opaquehttp.Config),
+) *httpTest {
+	conf := opaque.DefaultConfiguration()
+	server, _ := conf.Server()
+	h := &httpTest{conf: conf, sessions: make(chan []byte, 1), json: useJSON}
+
+	config := &opaquehttp.Config{
+		Server:  server,
+		Keys:    serverKeys(t, conf),
+		Records: opaque.NewMemoryRecordStore(),
+		OnLogin: func(w http.ResponseWriter, _ *http.Request, _ []byte, state *opaque.ServerLoginState) {
+			h.sessions <- state.SessionKey()
+			_, _ = w.Write([]byte("token"))
+		},
+		OnError: func(_ *http.Request, err error) {
+			t.Errorf("unexpected internal error: %v", err)
+		},
+	}
+
+	if configure != nil {
+		configure(config)
+	}
+
+	handler, err := opaquehttp.NewHandler(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if middleware == nil {
+		h.server = httptest.NewServer(handler)
+	} else {
+		h.server = httptest.NewServer(middleware(handler))
+	}
+
+	t.Cleanup(h.server.Close)
+
+	return h
+}
+
+func encode64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode64(t *testing.T, s string) []byte {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// post sends the fields to the endpoint, and returns the status and the fields of the response.
+func (h *httpTest) post(t *testing.T, path string, fields *httpFields) (int, *httpFields) {
+	var (
+		body        []byte
+		contentType string
+		err         error
+	)
+
+	header := http.Header{}
+
+	if h.json {
+		contentType = opaquehttp.ContentTypeJSON
+		if body, err = json.Marshal(fields); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		contentType = opaquehttp.ContentTypeRaw
+		body = decode64(t, fields.Message)
+		header.Set(opaquehttp.HeaderCredentialIdentifier, fields.CredentialIdentifier)
+		header.Set(opaquehttp.HeaderClientIdentity, fields.ClientIdentity)
+		header.Set(opaquehttp.HeaderSession, fields.Session)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.server.URL+path, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header = header
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := h.server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &httpFields{}
+
+	switch {
+	case resp.StatusCode != http.StatusOK || len(content) == 0 || path == opaquehttp.PathLoginFinish ||
+		path == opaquehttp.PathPasswordChangeFinish:
+	case h.json:
+		if err := json.Unmarshal(content, out); err != nil {
+			t.Fatal(err)
+		}
+	default:
+		out.Session = resp.Header.Get(opaquehttp.HeaderSession)
+		out.Message = encode64(content)
+	}
+
+	return resp.StatusCode, out
+}
+
+func (h *httpTest) register(t *testing.T, credentialIdentifier, password []byte) int {
+	client, _ := h.conf.Client()
+	request, state := client.RegistrationInit(password)
+
+	status, fields := h.post(t, opaquehttp.PathRegisterStart, &httpFields{
+		CredentialIdentifier: encode64(credentialIdentifier),
+		Message:              encode64(request.Serialize()),
+	})
+	if status != http.StatusOK {
+		t.Fatalf("register-start: unexpected status %d", status)
+	}
+
+	response, err := client.Deserialize.RegistrationResponse(decode64(t, fields.Message))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record, _, err := client.RegistrationFinalize(response, nil, nil, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, _ = h.post(t, opaquehttp.PathRegisterFinish, &httpFields{
+		CredentialIdentifier: encode64(credentialIdentifier),
+		Message:              encode64(record.Serialize()),
+	})
+
+	return status
+}
+
+// login returns the status of login-finish, and the client's session key on success.
+func (h *httpTest) login(t *testing.T, credentialIdentifier, password []byte) (int, []byte) {
+	client, _ := h.conf.Client()
+	ke1, state := client.LoginInit(password)
+
+	status, fields := h.post(t, opaquehttp.PathLoginStart, &httpFields{
+		CredentialIdentifier: encode64(credentialIdentifier),
+		Message:              encode64(ke1.Serialize()),
+	})
+	if status != http.StatusOK || fields.Session == "" {
+		t.Fatalf("login-start: unexpected status %d", status)
+	}
+
+	ke2, err := client.Deserialize.KE2(decode64(t, fields.Message))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ke3, _, err := client.LoginFinish(nil, nil, ke2, state)
+	if err != nil {
+		// The client can't authenticate, and sends a KE3 it didn't compute, which the server must reject.
+		ke3 = &message.KE3{Mac: make([]byte, h.conf.MAC.Size())}
+	}
+
+	status, _ = h.post(t, opaquehttp.PathLoginFinish, &httpFields{
+		Session: fields.Session,
+		Message: encode64(ke3.Serialize()),
+	})
+
+	if err != nil {
+		return status, nil
+	}
+
+	return status, state.SessionKey()
+}
+
+func TestHTTP_Login(t *testing.T) {
+	for _, useJSON := range []bool{false, true} {
+		h := newHTTPTest(t, useJSON)
+		credID := []byte("client")
+		password := []byte("password")
+
+		if status := h.register(t, credID, password); status != http.StatusCreated {
+			t.Fatalf("register-finish: unexpected status %d", status)
+		}
+
+		status, sessionKey := h.login(t, credID, password)
+		if status != http.StatusOK {
+			t.Fatalf("login-finish: unexpected status %d", status)
+		}
+
+		if !bytes.Equal(sessionKey, <-h.sessions) {
+			t.Fatal("session keys differ")
+		}
+
+		// Wrong password, and unknown client.
+		if status, _ := h.login(t, credID, []byte("wrong")); status != http.StatusUnauthorized {
+			t.Fatalf("wrong password: unexpected status %d", status)
+		}
+
+		if status, _ := h.login(t, []byte("unknown"), password); status != http.StatusUnauthorized {
+			t.Fatalf("unknown client: unexpected status %d", status)
+		}
+
+		// Registering again is rejected.
+		if status := h.register(t, credID, []byte("new password")); status != http.StatusConflict {
+			t.Fatalf("re-registration: unexpected status %d", status)
+		}
+	}
+}
+
+func TestHTTP_SessionReuse(t *testing.T) {
+	h := newHTTPTest(t, false)
+	credID := []byte("client")
+	password := []byte("password")
+	h.register(t, credID, password)
+
+	client, _ := h.conf.Client()
+	ke1, state := client.LoginInit(password)
+
+	_, fields := h.post(t, opaquehttp.PathLoginStart, &httpFields{
+		CredentialIdentifier: encode64(credID),
+		Message:              encode64(ke1.Serialize()),
+	})
+
+	ke2, _ := client.Deserialize.KE2(decode64(t, fields.Message))
+	ke3, _, _ := client.LoginFinish(nil, nil, ke2, state)
+	finish := &httpFields{Session: fields.Session, Message: encode64(ke3.Serialize())}
+
+	if status, _ := h.post(t, opaquehttp.PathLoginFinish, finish); status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+
+	<-h.sessions
+
+	if status, _ := h.post(t, opaquehttp.PathLoginFinish, finish); status != http.StatusUnauthorized {
+		t.Fatalf("session reuse: unexpected status %d", status)
+	}
+}
+
+// recordingStates is a StateStore that keeps a copy of the states it's given.
+type recordingStates struct {
+	opaquehttp.StateStore
+	stored [][]byte
+	mutex  sync.Mutex
+}
+
+func (r *recordingStates) Put(session string, state []byte, expiry time.Time) error {
+	r.mutex.Lock()
+	r.stored = append(r.stored, append([]byte(nil), state...))
+	r.mutex.Unlock()
+
+	return r.StateStore.Put(session, state, expiry)
+}
+
+func TestHTTP_SealedStates(t *testing.T) {
+	states := &recordingStates{StateStore: opaquehttp.NewMemoryStateStore()}
+	withStates := func(c *opaquehttp.Config) { c.States = states }
+	h := newWrappedHTTPTest(t, false, nil, withStates)
+	credID := []byte("client")
+	password := []byte("password")
+	h.register(t, credID, password)
+
+	status, sessionKey := h.login(t, credID, password)
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+
+	<-h.sessions
+
+	// The states holding the session key, before and after login-finish, are only given sealed to the store.
+	if len(states.stored) != 2 {
+		t.Fatalf("expected 2 stored states, got %d", len(states.stored))
+	}
+
+	for _, stored := range states.stored {
+		if bytes.Contains(stored, sessionKey) {
+			t.Fatal("the login state was stored in the clear")
+		}
+	}
+
+	// Another handler sharing the store, but with its own sealing key, can't open the states of the first one.
+	other := newWrappedHTTPTest(t, false, nil, withStates)
+	client, _ := h.conf.Client()
+	ke1, state := client.LoginInit(password)
+
+	_, fields := h.post(t, opaquehttp.PathLoginStart, &httpFields{
+		CredentialIdentifier: encode64(credID),
+		Message:              encode64(ke1.Serialize()),
+	})
+
+	ke2, _ := client.Deserialize.KE2(decode64(t, fields.Message))
+	ke3, _, _ := client.LoginFinish(nil, nil, ke2, state)
+	finish := &httpFields{Session: fields.Session, Message: encode64(ke3.Serialize())}
+
+	if status, _ := other.post(t, opaquehttp.PathLoginFinish, finish); status != http.StatusUnauthorized {
+		t.Fatalf("other sealing key: unexpected status %d", status)
+	}
+}
+
+func TestHTTP_BadRequests(t *testing.T) {
+	h := newHTTPTest(t, false)
+	url := h.server.URL + opaquehttp.PathLoginStart
+
+	// Method.
+	resp, err := h.server.Client().Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("GET: unexpected status %d", resp.StatusCode)
+	}
+
+	// Media type.
+	resp, err = h.server.Client().Post(url, "text/plain", bytes.NewReader([]byte("ke1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("media type: unexpected status %d", resp.StatusCode)
+	}
+
+	// Malformed messages and fields.
+	for name, fields := range map[string]*httpFields{
+		"invalid KE1": {
+			CredentialIdentifier: encode64([]byte("client")),
+			Message:              encode64([]byte("ke1")),
+		},
+		"no credential identifier": {Message: encode64(make([]byte, 96))},
+		"bad credential identifier": {
+			CredentialIdentifier: "!",
+			Message:              encode64(make([]byte, 96)),
+		},
+	} {
+		if status, _ := h.post(t, opaquehttp.PathLoginStart, fields); status != http.StatusBadRequest {
+			t.Fatalf("%s: unexpected status %d", name, status)
+		}
+	}
+
+	h.json = true
+	if status, _ := h.post(t, opaquehttp.PathLoginFinish, &httpFields{Message: encode64([]byte("ke3"))}); status !=
+		http.StatusBadRequest {
+		t.Fatalf("no session: unexpected status %d", status)
+	}
+}
+
+func TestHTTP_Config(t *testing.T) {
+	if _, err := opaquehttp.NewHandler(&opaquehttp.Config{}); err == nil {
+		t.Fatal("expected error on incomplete configuration")
+	}
+
+	conf := opaque.DefaultConfiguration()
+	server, _ := conf.Server()
+
+	if _, err := opaquehttp.NewHandler(&opaquehttp.Config{
+		Server:  server,
+		Keys:    serverKeys(t, conf),
+		Keyring: keyring(t, conf, 1),
+		Records: opaque.NewMemoryRecordStore(),
+	}); err == nil {
+		t.Fatal("expected error on both keys and a keyring")
+	}
+
+	if _, err := opaquehttp.NewHandler(&opaquehttp.Config{
+		Server:     server,
+		Keys:       serverKeys(t, conf),
+		Records:    opaque.NewMemoryRecordStore(),
+		SealingKey: make([]byte, 16),
+	}); !errors.Is(err, opaque.ErrInvalidSealingKey) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrInvalidSealingKey, err)
+	}
+}
+
+func TestMemoryStateStore(t *testing.T) {
+	s := opaquehttp.NewMemoryStateStore()
+
+	if err := s.Put("live", []byte("state"), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Put("expired", []byte("state"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	if state, err := s.Take("live"); err != nil || !bytes.Equal(state, []byte("state")) {
+		t.Fatalf("unexpected state %q, %v", state, err)
+	}
+
+	for _, session := range []string{"live", "expired", "unknown"} {
+		if _, err := s.Take(session); !errors.Is(err, opaquehttp.ErrSessionNotFound) {
+			t.Fatalf("%s: expected error %q, got %v", session, opaquehttp.ErrSessionNotFound, err)
+		}
+	}
+}
+
+func (h *httpTest) client(t *testing.T, config *opaquehttp.ClientConfig) *opaquehttp.Client {
+	client, _ := h.conf.Client()
+	config.URL = h.server.URL
+	config.Client = client
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = h.server.Client()
+	}
+
+	c, err := opaquehttp.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestHTTPClient(t *testing.T) {
+	ctx := context.Background()
+
+	for _, contentType := range []string{opaquehttp.ContentTypeRaw, opaquehttp.ContentTypeJSON} {
+		h := newHTTPTest(t, false)
+		c := h.client(t, &opaquehttp.ClientConfig{ContentType: contentType})
+		credID := []byte("client")
+		clientID := []byte("client@example.com")
+		password := []byte("password")
+
+		exportKey, err := c.Register(ctx, credID, clientID, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		session, err := c.Login(ctx, credID, clientID, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(session.SessionKey, <-h.sessions) {
+			t.Fatal("session keys differ")
+		}
+
+		if !bytes.Equal(exportKey, session.ExportKey) || string(session.Body) != "token" {
+			t.Fatal("unexpected export key or response body")
+		}
+
+		for name, login := range map[string][][]byte{
+			"wrong password":  {credID, clientID, []byte("wrong")},
+			"unknown client":  {[]byte("unknown"), clientID, password},
+			"wrong client ID": {credID, []byte("other"), password},
+		} {
+			if _, err := c.Login(ctx, login[0], login[1], login[2]); !errors.Is(err, opaquehttp.ErrAuthentication) {
+				t.Fatalf("%s: expected error %q, got %v", name, opaquehttp.ErrAuthentication, err)
+			}
+		}
+
+		if _, err := c.Register(ctx, credID, nil, password); !errors.Is(err, opaquehttp.ErrRecordExists) {
+			t.Fatalf("expected error %q, got %v", opaquehttp.ErrRecordExists, err)
+		}
+	}
+}
+
+func TestHTTPClient_PasswordChange(t *testing.T) {
+	ctx := context.Background()
+
+	for _, contentType := range []string{opaquehttp.ContentTypeRaw, opaquehttp.ContentTypeJSON} {
+		h := newHTTPTest(t, false)
+		c := h.client(t, &opaquehttp.ClientConfig{ContentType: contentType})
+		credID := []byte("client")
+		clientID := []byte("client@example.com")
+		oldPassword, newPassword := []byte("old"), []byte("new")
+
+		if _, err := c.Register(ctx, credID, clientID, oldPassword); err != nil {
+			t.Fatal(err)
+		}
+
+		session, err := c.Login(ctx, credID, clientID, oldPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		<-h.sessions
+
+		// Another login session, made obsolete by the password change.
+		other, err := c.Login(ctx, credID, clientID, oldPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		<-h.sessions
+
+		exportKey, err := c.ChangePassword(ctx, session, clientID, newPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The login session can only be used for a single password change.
+		if _, err := c.ChangePassword(ctx, session, clientID, newPassword); !errors.Is(
+			err,
+			opaquehttp.ErrAuthentication,
+		) {
+			t.Fatalf("expected error %q, got %v", opaquehttp.ErrAuthentication, err)
+		}
+
+		if _, err := c.ChangePassword(ctx, other, clientID, []byte("other")); !errors.Is(
+			err,
+			opaquehttp.ErrRecordChanged,
+		) {
+			t.Fatalf("expected error %q, got %v", opaquehttp.ErrRecordChanged, err)
+		}
+
+		if _, err := c.Login(ctx, credID, clientID, oldPassword); !errors.Is(err, opaquehttp.ErrAuthentication) {
+			t.Fatalf("expected error %q, got %v", opaquehttp.ErrAuthentication, err)
+		}
+
+		session, err = c.Login(ctx, credID, clientID, newPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		<-h.sessions
+
+		if !bytes.Equal(session.ExportKey, exportKey) {
+			t.Fatal("login export key differs from the password change's one")
+		}
+	}
+}
+
+func TestHTTPClient_ReRegistration(t *testing.T) {
+	ctx := context.Background()
+	k := keyring(t, opaque.DefaultConfiguration(), 1)
+	h := newWrappedHTTPTest(t, false, nil, func(config *opaquehttp.Config) {
+		config.Keys = nil
+		config.Keyring = k
+	})
+	c := h.client(t, &opaquehttp.ClientConfig{})
+	credID := []byte("client")
+	password := []byte("password")
+
+	if _, err := c.Register(ctx, credID, nil, password); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := k.Add(2, serverKeys(t, h.conf)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The record of version 1 still logs in, and is asked to register again.
+	session, err := c.Login(ctx, credID, nil, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-h.sessions
+
+	if !session.ReRegister {
+		t.Fatal("expected the client to be asked to register again")
+	}
+
+	exportKey, err := c.ChangePassword(ctx, session, nil, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Once moved to version 2, version 1 can be removed.
+	if err := k.Remove(1); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err = c.Login(ctx, credID, nil, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-h.sessions
+
+	if session.ReRegister || !bytes.Equal(session.ExportKey, exportKey) {
+		t.Fatal("expected the client to be registered under the current version")
+	}
+}
+
+func TestHTTP_PasswordChange_NotFinished(t *testing.T) {
+	h := newHTTPTest(t, false)
+	credID := []byte("client")
+	password := []byte("password")
+	h.register(t, credID, password)
+
+	client, _ := h.conf.Client()
+	ke1, _ := client.LoginInit(password)
+
+	_, fields := h.post(t, opaquehttp.PathLoginStart, &httpFields{
+		CredentialIdentifier: encode64(credID),
+		Message:              encode64(ke1.Serialize()),
+	})
+
+	// The login session has not been finished, and can't be used to change the password.
+	request, _ := client.RegistrationInit([]byte("new"))
+
+	status, _ := h.post(t, opaquehttp.PathPasswordChangeStart, &httpFields{
+		Session: fields.Session,
+		Message: encode64(request.Serialize()),
+	})
+	if status != http.StatusUnauthorized {
+		t.Fatalf("unexpected status %d", status)
+	}
+}
+
+func TestHTTPClient_Negotiation(t *testing.T) {
+	var jsonRequests, rawRequests int
+
+	rawOnly := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.Header.Get("Content-Type"), opaquehttp.ContentTypeJSON) {
+				jsonRequests++
+
+				http.Error(w, "raw only", http.StatusUnsupportedMediaType)
+
+				return
+			}
+
+			rawRequests++
+
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	h := newWrappedHTTPTest(t, false, rawOnly, nil)
+	c := h.client(t, &opaquehttp.ClientConfig{ContentType: opaquehttp.ContentTypeJSON})
+
+	if _, err := c.Register(context.Background(), []byte("client"), nil, []byte("password")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Login(context.Background(), []byte("client"), nil, []byte("password")); err != nil {
+		t.Fatal(err)
+	}
+
+	<-h.sessions
+
+	// Only the first request is sent in JSON.
+	if jsonRequests != 1 || rawRequests != 4 {
+		t.Fatalf("unexpected requests: %d in JSON, %d raw", jsonRequests, rawRequests)
+	}
+}
+
+// flakyTransport fails the first requests before reaching the server.
+type flakyTransport struct {
+	next     http.RoundTripper
+	failures int
+}
+
+func (f *flakyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if f.failures > 0 {
+		f.failures--
+		return nil, errors.New("connection reset")
+	}
+
+	return f.next.RoundTrip(r)
+}
+
+func TestHTTPClient_Retries(t *testing.T) {
+	h := newHTTPTest(t, false)
+	transport := &flakyTransport{next: h.server.Client().Transport, failures: 2}
+	c := h.client(t, &opaquehttp.ClientConfig{
+		HTTPClient: &http.Client{Transport: transport},
+		RetryDelay: time.Millisecond,
+	})
+
+	if _, err := c.Register(context.Background(), []byte("client"), nil, []byte("password")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without retries.
+	transport.failures = 1
+	c = h.client(t, &opaquehttp.ClientConfig{HTTPClient: &http.Client{Transport: transport}, Retries: -1})
+
+	if _, err := c.Login(context.Background(), []byte("client"), nil, []byte("password")); err == nil {
+		t.Fatal("expected error without retries")
+	}
+}
+
+// lossyTransport loses the response to the first request to the path, after the server has handled it.
+type lossyTransport struct {
+	next     http.RoundTripper
+	path     string
+	requests int
+}
+
+func (l *lossyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := l.next.RoundTrip(r)
+	if err != nil || !strings.HasSuffix(r.URL.Path, l.path) {
+		return resp, err
+	}
+
+	l.requests++
+	if l.requests > 1 {
+		return resp, nil
+	}
+
+	_ = resp.Body.Close()
+
+	return nil, errors.New("connection reset")
+}
+
+func TestHTTPClient_LostFinishResponse(t *testing.T) {
+	ctx := context.Background()
+	h := newHTTPTest(t, false)
+	transport := &lossyTransport{next: h.server.Client().Transport, path: opaquehttp.PathRegisterFinish}
+	c := h.client(t, &opaquehttp.ClientConfig{
+		HTTPClient: &http.Client{Transport: transport},
+		RetryDelay: time.Millisecond,
+	})
+	credID := []byte("client")
+	password := []byte("password")
+
+	// The transport error is returned as is, without resending register-finish, which would be rejected.
+	if _, err := c.Register(ctx, credID, nil, password); err == nil || errors.Is(err, opaquehttp.ErrRecordExists) {
+		t.Fatalf("expected transport error, got %v", err)
+	}
+
+	if transport.requests != 1 {
+		t.Fatalf("register-finish was sent %d times", transport.requests)
+	}
+
+	// Logging in tells that the registration went through.
+	if _, err := c.Login(ctx, credID, nil, password); err != nil {
+		t.Fatal(err)
+	}
+
+	<-h.sessions
+}
+
+func TestHTTPClient_Context(t *testing.T) {
+	h := newHTTPTest(t, false)
+	c := h.client(t, &opaquehttp.ClientConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := c.Register(ctx, []byte("client"), nil, []byte("password")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected error %q, got %v", context.Canceled, err)
+	}
+
+	// Cancellation also stops retries.
+	transport := &flakyTransport{next: h.server.Client().Transport, failures: 10}
+	c = h.client(t, &opaquehttp.ClientConfig{
+		HTTPClient: &http.Client{Transport: transport},
+		Retries:    10,
+		RetryDelay: time.Hour,
+	})
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.Register(ctx, []byte("client"), nil, []byte("password")); !errors.Is(
+		err,
+		context.DeadlineExceeded,
+	) {
+		t.Fatalf("expected error %q, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestHTTPClient_Config(t *testing.T) {
+	client, _ := opaque.DefaultConfiguration().Client()
+
+	for _, config := range []*opaquehttp.ClientConfig{
+		nil,
+		{Client: client},
+		{URL: "http://localhost"},
+		{URL: "http://localhost", Client: client, ContentType: "text/plain"},
+	} {
+		if _, err := opaquehttp.NewClient(config); err == nil {
+			t.Fatal("expected error on invalid client configuration")
+		}
+	}
+}
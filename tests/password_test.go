@@ -0,0 +1,372 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bytemare/opaque"
+	"github.com/bytemare/opaque/internal"
+	"github.com/bytemare/opaque/internal/tag"
+	"github.com/bytemare/opaque/message"
+)
+
+type passwordChange struct {
+	client      *opaque.Client
+	server      *opaque.Server
+	keys        *opaque.ServerKeyMaterial
+	keyring     *opaque.ServerKeyring
+	record      *opaque.ClientRecord
+	store       *opaque.MemoryRecordStore
+	clientLogin *opaque.ClientLoginState
+	serverLogin *opaque.ServerLoginState
+}
+
+// loggedIn registers the password, and returns the states of a successful login.
+func loggedIn(t *testing.T, conf *opaque.Configuration, password []byte) *passwordChange {
+	return loggedInWithKeyring(t, conf, password, keyring(t, conf, 0))
+}
+
+// loggedInWithKeyring registers the password under the keyring's current key version, and returns the states of a
+// successful login.
+func loggedInWithKeyring(
+	t *testing.T,
+	conf *opaque.Configuration,
+	password []byte,
+	k *opaque.ServerKeyring,
+) *passwordChange {
+	client, _ := conf.Client()
+	server, _ := conf.Server()
+	version, keys := k.Current()
+	record := buildRecord(internal.RandomBytes(32), password, keys, client, server)
+	record.KeyVersion = version
+	store := opaque.NewMemoryRecordStore()
+
+	if err := store.Put(record); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &passwordChange{
+		client:  client,
+		server:  server,
+		keys:    keys,
+		keyring: k,
+		record:  record,
+		store:   store,
+	}
+	p.clientLogin, p.serverLogin = p.logIn(t, password)
+
+	return p
+}
+
+// logIn runs a successful login with the password for the record, with the key material of its version.
+func (p *passwordChange) logIn(t *testing.T, password []byte) (*opaque.ClientLoginState, *opaque.ServerLoginState) {
+	ke1, clientLogin := p.client.LoginInit(password)
+
+	ke2, serverLogin, err := p.server.LoginInitWithKeyring(ke1, nil, p.keyring, p.record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ke3, _, err := p.client.LoginFinish(nil, nil, ke2, clientLogin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.server.LoginFinish(ke3, serverLogin); err != nil {
+		t.Fatal(err)
+	}
+
+	return clientLogin, serverLogin
+}
+
+func (p *passwordChange) upload(t *testing.T, newPassword []byte) (*message.PasswordChangeRecord, []byte, []byte) {
+	req, state, err := p.client.PasswordChangeInit(newPassword, p.clientLogin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := p.server.PasswordChangeResponse(req, p.serverLogin, p.keys, p.record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The response goes through the wire.
+	decoded, err := p.client.Deserialize.PasswordChangeResponse(resp.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upload, exportKey, err := p.client.PasswordChangeFinalize(decoded, nil, nil, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return upload, state.OldExportKey(), exportKey
+}
+
+// passwordChangeMac returns the MAC authenticating the record with the session key.
+func passwordChangeMac(client *opaque.Client, sessionKey []byte, record *message.RegistrationRecord) []byte {
+	conf := client.GetConf()
+	macKey := conf.KDF.Expand(sessionKey, []byte(tag.PasswordChange), conf.KDF.Size())
+
+	return conf.MAC.MAC(macKey, record.Serialize())
+}
+
+// finish finishes the password change of the upload with the login state, under the record's key version.
+func (p *passwordChange) finish(
+	upload *message.PasswordChangeRecord,
+	state *opaque.ServerLoginState,
+) (*opaque.ClientRecord, error) {
+	return p.server.PasswordChangeFinish(upload, state, p.record, p.record.KeyVersion, p.store)
+}
+
+func TestPasswordChange(t *testing.T) {
+	for _, conf := range confs {
+		oldPassword, newPassword := []byte("old"), []byte("new")
+		p := loggedIn(t, conf.Conf, oldPassword)
+
+		upload, oldExportKey, newExportKey := p.upload(t, newPassword)
+
+		if !bytes.Equal(oldExportKey, p.clientLogin.ExportKey()) {
+			t.Fatal("old export key is not the login's export key")
+		}
+
+		// The upload goes through the wire.
+		decoded, err := p.server.Deserialize.PasswordChangeRecord(upload.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		updated, err := p.finish(decoded, p.serverLogin)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := p.store.Get(p.record.CredentialIdentifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !isSameRecord(stored, updated) {
+			t.Fatal("stored record was not replaced")
+		}
+
+		if _, exportKey := login(t, conf.Conf, newPassword, p.keys, stored); !bytes.Equal(exportKey, newExportKey) {
+			t.Fatal("login export key differs from the password change's one")
+		}
+
+		client, _ := conf.Conf.Client()
+		server, _ := conf.Conf.Server()
+		ke1, state := client.LoginInit(oldPassword)
+
+		ke2, _, err := server.LoginInit(ke1, nil, p.keys, stored)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := client.LoginFinish(nil, nil, ke2, state); err == nil {
+			t.Fatal("expected login with the old password to fail")
+		}
+	}
+}
+
+func TestPasswordChange_SealedState(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	sealingKey := internal.RandomBytes(32)
+	p := loggedIn(t, conf, []byte("old"))
+
+	// The finished login state is sealed, e.g. by a stateless server, and opened by another instance.
+	credID := p.record.CredentialIdentifier
+
+	sealed, err := p.server.SealState(p.serverLogin, sealingKey, credID, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, _ := conf.Server()
+
+	opened, err := server.OpenState(sealed, sealingKey, credID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !opened.Finished() {
+		t.Fatal("finished state was not opened as finished")
+	}
+
+	if _, err := server.Exporter(opened); err != nil {
+		t.Fatal(err)
+	}
+
+	upload, _, _ := p.upload(t, []byte("new"))
+	keyVersion := p.record.KeyVersion + 1
+
+	updated, err := server.PasswordChangeFinish(upload, opened, p.record, keyVersion, p.store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if updated.KeyVersion != keyVersion {
+		t.Fatalf("expected key version %d, got %d", keyVersion, updated.KeyVersion)
+	}
+}
+
+func TestPasswordChange_Tampered(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	p := loggedIn(t, conf, []byte("old"))
+	upload, _, _ := p.upload(t, []byte("new"))
+
+	// A record of another session is rejected.
+	other := loggedIn(t, conf, []byte("old"))
+	if _, err := p.finish(upload, other.serverLogin); !errors.Is(err, opaque.ErrPasswordChangeAuthentication) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrPasswordChangeAuthentication, err)
+	}
+
+	// A swapped record is rejected.
+	swapped := &message.PasswordChangeRecord{
+		RegistrationRecord: other.record.RegistrationRecord,
+		Mac:                upload.Mac,
+	}
+	if _, err := p.finish(swapped, p.serverLogin); !errors.Is(err, opaque.ErrPasswordChangeAuthentication) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrPasswordChangeAuthentication, err)
+	}
+
+	if _, err := p.finish(upload, nil); !errors.Is(err, opaque.ErrNoState) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrNoState, err)
+	}
+
+	req, _, err := p.client.PasswordChangeInit([]byte("new"), p.clientLogin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.server.PasswordChangeResponse(req, nil, p.keys, p.record); !errors.Is(err, opaque.ErrNoState) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrNoState, err)
+	}
+
+	// The stored record must not have changed.
+	stored, _ := p.store.Get(p.record.CredentialIdentifier)
+	if !isSameRecord(stored, p.record) {
+		t.Fatal("record was replaced after failure")
+	}
+}
+
+func TestPasswordChange_LoginNotFinished(t *testing.T) {
+	for _, conf := range append([]*opaque.Configuration{opaque.DefaultConfiguration()}, sigmaConfs()...) {
+		p := loggedIn(t, conf, []byte("old"))
+
+		// The client completes a new login, but its KE3 never reaches the server, which must therefore not accept a
+		// password change authenticated with the session key, which in SIGMA-I is known without authentication.
+		ke1, clientLogin := p.client.LoginInit([]byte("old"))
+
+		ke2, serverLogin, err := p.server.LoginInit(ke1, nil, p.keys, p.record)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := p.client.LoginFinish(nil, nil, ke2, clientLogin); err != nil {
+			t.Fatal(err)
+		}
+
+		req, _, err := p.client.PasswordChangeInit([]byte("new"), clientLogin)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := p.server.PasswordChangeResponse(req, serverLogin, p.keys, p.record); !errors.Is(
+			err, opaque.ErrLoginNotFinished) {
+			t.Fatalf("expected error %q, got %v", opaque.ErrLoginNotFinished, err)
+		}
+
+		// Neither is a record authenticated with the session key.
+		p.clientLogin, p.serverLogin = clientLogin, serverLogin
+		upload := &message.PasswordChangeRecord{RegistrationRecord: p.record.RegistrationRecord}
+		upload.Mac = passwordChangeMac(p.client, clientLogin.SessionKey(), upload.RegistrationRecord)
+
+		if _, err := p.finish(upload, serverLogin); !errors.Is(err, opaque.ErrLoginNotFinished) {
+			t.Fatalf("expected error %q, got %v", opaque.ErrLoginNotFinished, err)
+		}
+
+		stored, _ := p.store.Get(p.record.CredentialIdentifier)
+		if !isSameRecord(stored, p.record) {
+			t.Fatal("record was replaced without a finished login")
+		}
+	}
+}
+
+func TestPasswordChange_ConcurrentChange(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	p := loggedIn(t, conf, []byte("old"))
+	first, _, _ := p.upload(t, []byte("first"))
+	second, _, _ := p.upload(t, []byte("second"))
+
+	if _, err := p.finish(first, p.serverLogin); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second change was started from the now replaced record.
+	if _, err := p.finish(second, p.serverLogin); !errors.Is(err, opaque.ErrRecordChanged) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrRecordChanged, err)
+	}
+}
+
+func TestPasswordChange_ClientErrors(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	p := loggedIn(t, conf, []byte("old"))
+
+	_, unfinished := p.client.LoginInit([]byte("old"))
+	_, _, err := p.client.PasswordChangeInit([]byte("new"), unfinished)
+	if !errors.Is(err, opaque.ErrLoginNotFinished) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrLoginNotFinished, err)
+	}
+
+	req, state, err := p.client.PasswordChangeInit([]byte("new"), p.clientLogin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A response of another session, e.g. from a man-in-the-middle, is rejected.
+	other := loggedIn(t, conf, []byte("old"))
+
+	resp, err := other.server.PasswordChangeResponse(req, other.serverLogin, other.keys, other.record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := p.client.PasswordChangeFinalize(resp, nil, nil, state); !errors.Is(
+		err, opaque.ErrPasswordChangeResponseAuthentication) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrPasswordChangeResponseAuthentication, err)
+	}
+
+	// So is a response whose server public key has been swapped.
+	resp, err = p.server.PasswordChangeResponse(req, p.serverLogin, p.keys, p.record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.RegistrationResponse.Pks = other.record.RegistrationRecord.PublicKey
+
+	if _, _, err := p.client.PasswordChangeFinalize(resp, nil, nil, state); !errors.Is(
+		err, opaque.ErrPasswordChangeResponseAuthentication) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrPasswordChangeResponseAuthentication, err)
+	}
+
+	if _, _, err := p.client.PasswordChangeFinalize(nil, nil, nil, state); !errors.Is(
+		err, opaque.ErrPasswordChangeResponseAuthentication) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrPasswordChangeResponseAuthentication, err)
+	}
+
+	if _, _, err := p.client.PasswordChangeFinalize(resp, nil, nil, nil); err == nil {
+		t.Fatal("expected error on missing state")
+	}
+}
@@ -0,0 +1,182 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/bytemare/crypto/ksf"
+
+	"github.com/bytemare/opaque"
+	"github.com/bytemare/opaque/internal"
+)
+
+func isSameRecord(a, b *opaque.ClientRecord) bool {
+	return a.KeyVersion == b.KeyVersion &&
+		bytes.Equal(a.CredentialIdentifier, b.CredentialIdentifier) &&
+		bytes.Equal(a.ClientIdentity, b.ClientIdentity) &&
+		bytes.Equal(a.RegistrationRecord.Serialize(), b.RegistrationRecord.Serialize())
+}
+
+func TestClientRecord_Serialization(t *testing.T) {
+	for _, conf := range confs {
+		client, _ := conf.Conf.Client()
+		server, _ := conf.Conf.Server()
+		keys := serverKeys(t, conf.Conf)
+		rec := buildRecord(internal.RandomBytes(32), []byte("yo"), keys, client, server)
+		rec.ClientIdentity = []byte("client")
+		rec.KeyVersion = 7
+
+		encoded, err := rec.Serialize(conf.Conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, err := server.Deserialize.ClientRecord(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !isSameRecord(rec, decoded) {
+			t.Fatal("binary encoding: decoded record differs")
+		}
+
+		encoded, err = rec.SerializeJSON(conf.Conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, err = server.Deserialize.ClientRecordJSON(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !isSameRecord(rec, decoded) {
+			t.Fatal("JSON encoding: decoded record differs")
+		}
+	}
+}
+
+func TestClientRecord_OtherConfiguration(t *testing.T) {
+	conf := confs[0].Conf
+	other := confs[1].Conf
+	client, _ := conf.Client()
+	server, _ := conf.Server()
+	keys := serverKeys(t, conf)
+	rec := buildRecord(internal.RandomBytes(32), []byte("yo"), keys, client, server)
+
+	encoded, err := rec.Serialize(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recordConf, err := opaque.RecordConfiguration(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !isSameConf(conf, recordConf) {
+		t.Fatal("unexpected record configuration")
+	}
+
+	d, _ := other.Deserializer()
+	if _, err := d.ClientRecord(encoded); !errors.Is(err, opaque.ErrRecordConfiguration) {
+		t.Fatalf("expected %q, got %q", opaque.ErrRecordConfiguration, err)
+	}
+
+	encoded, err = rec.SerializeJSON(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.ClientRecordJSON(encoded); !errors.Is(err, opaque.ErrRecordConfiguration) {
+		t.Fatalf("expected %q, got %q", opaque.ErrRecordConfiguration, err)
+	}
+
+	// The record doesn't match the other configuration's lengths.
+	if _, err := rec.Serialize(other); err == nil {
+		t.Fatal("expected error when serializing a record under a different configuration")
+	}
+}
+
+func TestClientRecord_SameLengthConfiguration(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	client, _ := conf.Client()
+	server, _ := conf.Server()
+	keys := serverKeys(t, conf)
+	rec := buildRecord(internal.RandomBytes(32), []byte("yo"), keys, client, server)
+
+	// The other configuration only differs in its KSF, and has the same record length.
+	other := opaque.DefaultConfiguration()
+	other.KSF = ksf.Argon2id
+	d, _ := other.Deserializer()
+
+	encoded, err := rec.Serialize(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.ClientRecord(encoded); !errors.Is(err, opaque.ErrRecordConfiguration) {
+		t.Fatalf("expected %q, got %q", opaque.ErrRecordConfiguration, err)
+	}
+
+	encoded, err = rec.SerializeJSON(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.ClientRecordJSON(encoded); !errors.Is(err, opaque.ErrRecordConfiguration) {
+		t.Fatalf("expected %q, got %q", opaque.ErrRecordConfiguration, err)
+	}
+
+	// The configuration is never implied.
+	if _, err := rec.Serialize(nil); err == nil {
+		t.Fatal("expected error on nil configuration")
+	}
+
+	if _, err := rec.SerializeJSON(nil); err == nil {
+		t.Fatal("expected error on nil configuration")
+	}
+}
+
+func TestClientRecord_InvalidEncoding(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	client, _ := conf.Client()
+	server, _ := conf.Server()
+	keys := serverKeys(t, conf)
+	rec := buildRecord(internal.RandomBytes(32), []byte("yo"), keys, client, server)
+
+	encoded, err := rec.Serialize(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version := append([]byte{0xff}, encoded[1:]...)
+	if _, err := server.Deserialize.ClientRecord(version); !errors.Is(err, opaque.ErrRecordVersion) {
+		t.Fatalf("expected %q, got %q", opaque.ErrRecordVersion, err)
+	}
+
+	for _, bad := range [][]byte{nil, encoded[:len(encoded)-1], append(encoded, 0)} {
+		if _, err := server.Deserialize.ClientRecord(bad); err == nil {
+			t.Fatal("expected error on invalid encoding")
+		}
+	}
+
+	for _, bad := range []string{"", "{", `{"version":3}`, `{"version":1,"configuration":"!"}`} {
+		if _, err := server.Deserialize.ClientRecordJSON([]byte(bad)); err == nil {
+			t.Fatalf("expected error on invalid JSON encoding %q", bad)
+		}
+	}
+
+	if _, err := (&opaque.ClientRecord{}).Serialize(conf); err == nil {
+		t.Fatal("expected error on empty record")
+	}
+}
@@ -9,19 +9,20 @@
 package opaque_test
 
 import (
+	"bytes"
 	"errors"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/bytemare/opaque"
 	"github.com/bytemare/opaque/internal"
 	"github.com/bytemare/opaque/internal/encoding"
+	"github.com/bytemare/opaque/message"
 )
 
-var (
-	errInvalidStateLength = errors.New("invalid state length")
-	errStateExists        = errors.New("existing state is not empty")
-)
+var errInvalidStateLength = errors.New("invalid state length")
 
 /*
 	The following tests look for failing conditions.
@@ -48,100 +49,186 @@ func TestServer_BadRegistrationRequest(t *testing.T) {
 	}
 }
 
-func TestServerInit_InvalidPublicKey(t *testing.T) {
+func TestServerKeyMaterial_InvalidPublicKey(t *testing.T) {
 	/*
 		Nil and invalid server public key
 	*/
 	for _, conf := range confs {
-		server, _ := conf.Conf.Server()
 		sk, _ := conf.Conf.KeyGen()
 		oprfSeed := internal.RandomBytes(conf.Conf.Hash.Size())
 
 		expected := "input server public key's length is invalid"
-		if _, err := server.LoginInit(nil, nil, sk, nil, oprfSeed, nil); err == nil ||
+		if _, err := conf.Conf.NewServerKeyMaterial(sk, nil, oprfSeed); err == nil ||
 			!strings.HasPrefix(err.Error(), expected) {
 			t.Fatalf("expected error on nil pubkey - got %s", err)
 		}
 
 		expected = "invalid server public key: "
-		if _, err := server.LoginInit(nil, nil, sk, getBadElement(t, conf), oprfSeed, nil); err == nil ||
+		if _, err := conf.Conf.NewServerKeyMaterial(sk, getBadElement(t, conf), oprfSeed); err == nil ||
 			!strings.HasPrefix(err.Error(), expected) {
 			t.Fatalf("expected error on bad secret key - got %s", err)
 		}
 	}
 }
 
-func TestServerInit_InvalidOPRFSeedLength(t *testing.T) {
+func TestServerKeyMaterial_InvalidOPRFSeedLength(t *testing.T) {
 	/*
-		Nil and invalid server public key
+		Nil and invalid OPRF seed
 	*/
 	for _, conf := range confs {
-		server, _ := conf.Conf.Server()
 		sk, pk := conf.Conf.KeyGen()
 		expected := opaque.ErrInvalidOPRFSeedLength
 
-		if _, err := server.LoginInit(nil, nil, sk, pk, nil, nil); err == nil || !errors.Is(err, expected) {
+		if _, err := conf.Conf.NewServerKeyMaterial(sk, pk, nil); err == nil || !errors.Is(err, expected) {
 			t.Fatalf("expected error on nil seed - got %s", err)
 		}
 
 		seed := internal.RandomBytes(conf.Conf.Hash.Size() - 1)
-		if _, err := server.LoginInit(nil, nil, sk, pk, seed, nil); err == nil || !errors.Is(err, expected) {
+		if _, err := conf.Conf.NewServerKeyMaterial(sk, pk, seed); err == nil || !errors.Is(err, expected) {
 			t.Fatalf("expected error on bad seed - got %s", err)
 		}
 
 		seed = internal.RandomBytes(conf.Conf.Hash.Size() + 1)
-		if _, err := server.LoginInit(nil, nil, sk, pk, seed, nil); err == nil || !errors.Is(err, expected) {
+		if _, err := conf.Conf.NewServerKeyMaterial(sk, pk, seed); err == nil || !errors.Is(err, expected) {
 			t.Fatalf("expected error on bad seed - got %s", err)
 		}
 	}
 }
 
-func TestServerInit_NilSecretKey(t *testing.T) {
+func TestServerKeyMaterial_NilSecretKey(t *testing.T) {
 	/*
 		Nil server secret key
 	*/
 	for _, conf := range confs {
-		server, _ := conf.Conf.Server()
 		_, pk := conf.Conf.KeyGen()
 		expected := "invalid server secret key: "
 
-		if _, err := server.LoginInit(nil, nil, nil, pk, nil, nil); err == nil ||
+		if _, err := conf.Conf.NewServerKeyMaterial(nil, pk, nil); err == nil ||
 			!strings.HasPrefix(err.Error(), expected) {
 			t.Fatalf("expected error on nil secret key - got %s", err)
 		}
 	}
 }
 
-func TestServerInit_ZeroSecretKey(t *testing.T) {
+func TestServerKeyMaterial_ZeroSecretKey(t *testing.T) {
 	/*
-		Nil server secret key
+		Zero server secret key
 	*/
 	for _, conf := range confs {
-		server, _ := conf.Conf.Server()
 		sk := [32]byte{}
 		expected := "server private key is zero"
 
-		if _, err := server.LoginInit(nil, nil, sk[:], nil, nil, nil); err == nil ||
+		if _, err := conf.Conf.NewServerKeyMaterial(sk[:], nil, nil); err == nil ||
 			!strings.HasPrefix(err.Error(), expected) {
 			t.Fatalf("expected error on nil secret key - got %s", err)
 		}
 	}
 }
 
+func TestServerKeyMaterial_Serialization(t *testing.T) {
+	for _, conf := range confs {
+		keys := serverKeys(t, conf.Conf)
+
+		decoded, err := conf.Conf.DeserializeServerKeyMaterial(keys.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(keys.Serialize(), decoded.Serialize()) || !bytes.Equal(keys.PublicKey(), decoded.PublicKey()) {
+			t.Fatal("decoded key material differs")
+		}
+	}
+
+	conf := opaque.DefaultConfiguration()
+	encoded := serverKeys(t, conf).Serialize()
+
+	version := append([]byte{0xff}, encoded[1:]...)
+	if _, err := conf.DeserializeServerKeyMaterial(version); !errors.Is(err, opaque.ErrServerKeyMaterialVersion) {
+		t.Fatalf("expected %q, got %q", opaque.ErrServerKeyMaterialVersion, err)
+	}
+
+	if _, err := confs[1].Conf.DeserializeServerKeyMaterial(encoded); !errors.Is(
+		err,
+		opaque.ErrServerKeyMaterialConfiguration,
+	) {
+		t.Fatalf("expected %q, got %q", opaque.ErrServerKeyMaterialConfiguration, err)
+	}
+
+	for _, bad := range [][]byte{nil, encoded[:len(encoded)-1], append(encoded, 0)} {
+		if _, err := conf.DeserializeServerKeyMaterial(bad); err == nil {
+			t.Fatal("expected error on invalid encoding")
+		}
+	}
+}
+
+func TestServerKeyMaterial_KeyMismatch(t *testing.T) {
+	for _, conf := range confs {
+		sk, _ := conf.Conf.KeyGen()
+		_, pk := conf.Conf.KeyGen()
+
+		if _, err := conf.Conf.NewServerKeyMaterial(sk, pk, conf.Conf.GenerateOPRFSeed()); !errors.Is(
+			err,
+			opaque.ErrServerKeyMismatch,
+		) {
+			t.Fatalf("expected %q on mismatching key pair, got %q", opaque.ErrServerKeyMismatch, err)
+		}
+
+		// Key material loaded from a tampered encoding is rejected as well.
+		keys := serverKeys(t, conf.Conf)
+		encoded := keys.Serialize()
+		seedOffset := len(encoded) - 2 - conf.Conf.Hash.Size()
+		copy(encoded[seedOffset-len(pk):seedOffset], pk)
+
+		if _, err := conf.Conf.DeserializeServerKeyMaterial(encoded); !errors.Is(err, opaque.ErrServerKeyMismatch) {
+			t.Fatalf("expected %q on mismatching encoded key pair, got %q", opaque.ErrServerKeyMismatch, err)
+		}
+
+		if err := keys.Verify(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestServerKeyMaterial_OtherConfiguration(t *testing.T) {
+	server, _ := confs[0].Conf.Server()
+	keys := serverKeys(t, confs[1].Conf)
+	client, _ := confs[0].Conf.Client()
+	r1, _ := client.RegistrationInit([]byte("yo"))
+
+	if _, err := server.RegistrationResponse(r1, keys, []byte("id")); !errors.Is(
+		err,
+		opaque.ErrServerKeyMaterialConfiguration,
+	) {
+		t.Fatalf("expected %q, got %q", opaque.ErrServerKeyMaterialConfiguration, err)
+	}
+
+	if _, err := server.RegistrationResponse(r1, nil, []byte("id")); !errors.Is(err, opaque.ErrNoServerKeyMaterial) {
+		t.Fatalf("expected %q, got %q", opaque.ErrNoServerKeyMaterial, err)
+	}
+
+	if _, _, err := server.LoginInit(nil, nil, nil, nil); !errors.Is(err, opaque.ErrNoServerKeyMaterial) {
+		t.Fatalf("expected %q, got %q", opaque.ErrNoServerKeyMaterial, err)
+	}
+
+	var nilKeys *opaque.ServerKeyMaterial
+	if err := nilKeys.Verify(); !errors.Is(err, opaque.ErrNoServerKeyMaterial) {
+		t.Fatalf("expected %q, got %q", opaque.ErrNoServerKeyMaterial, err)
+	}
+}
+
 func TestServerInit_InvalidEnvelope(t *testing.T) {
 	/*
 		Record envelope of invalid length
 	*/
 	for _, conf := range confs {
 		server, _ := conf.Conf.Server()
-		sk, pk := conf.Conf.KeyGen()
-		oprfSeed := internal.RandomBytes(conf.Conf.Hash.Size())
+		keys := serverKeys(t, conf.Conf)
 		client, _ := conf.Conf.Client()
-		rec := buildRecord(internal.RandomBytes(32), oprfSeed, []byte("yo"), pk, client, server)
+		rec := buildRecord(internal.RandomBytes(32), []byte("yo"), keys, client, server)
 		rec.Envelope = internal.RandomBytes(15)
 
 		expected := "record has invalid envelope length"
-		if _, err := server.LoginInit(nil, nil, sk, pk, oprfSeed, rec); err == nil ||
+		if _, _, err := server.LoginInit(nil, nil, keys, rec); err == nil ||
 			!strings.HasPrefix(err.Error(), expected) {
 			t.Fatalf("expected error on nil secret key - got %s", err)
 		}
@@ -174,9 +261,10 @@ func TestServerInit_InvalidEPKU(t *testing.T) {
 	for _, conf := range confs {
 		server, _ := conf.Conf.Server()
 		client, _ := conf.Conf.Client()
-		ke1 := client.LoginInit([]byte("yo")).Serialize()
+		ke1, _ := client.LoginInit([]byte("yo"))
+		ke1s := ke1.Serialize()
 		badke1 := encoding.Concat(
-			ke1[:server.GetConf().OPRFPointLength+server.GetConf().NonceLen],
+			ke1s[:server.GetConf().OPRFPointLength+server.GetConf().NonceLen],
 			getBadElement(t, conf),
 		)
 		expected := "invalid ephemeral client public key"
@@ -192,29 +280,28 @@ func TestServerFinish_InvalidKE3Mac(t *testing.T) {
 	*/
 	conf := opaque.DefaultConfiguration()
 	credId := internal.RandomBytes(32)
-	oprfSeed := internal.RandomBytes(conf.Hash.Size())
 	client, _ := conf.Client()
 	server, _ := conf.Server()
-	sk, pk := conf.KeyGen()
-	rec := buildRecord(credId, oprfSeed, []byte("yo"), pk, client, server)
-	ke1 := client.LoginInit([]byte("yo"))
-	ke2, err := server.LoginInit(ke1, nil, sk, pk, oprfSeed, rec)
+	keys := serverKeys(t, conf)
+	rec := buildRecord(credId, []byte("yo"), keys, client, server)
+	ke1, clientState := client.LoginInit([]byte("yo"))
+	ke2, state, err := server.LoginInit(ke1, nil, keys, rec)
 	if err != nil {
 		t.Fatal(err)
 	}
-	ke3, _, err := client.LoginFinish(nil, nil, ke2)
+	ke3, _, err := client.LoginFinish(nil, nil, ke2, clientState)
 	if err != nil {
 		t.Fatal(err)
 	}
 	ke3.Mac[0] = ^ke3.Mac[0]
 
 	expected := opaque.ErrAkeInvalidClientMac
-	if err := server.LoginFinish(ke3); err == nil || err.Error() != expected.Error() {
+	if err := server.LoginFinish(ke3, state); err == nil || err.Error() != expected.Error() {
 		t.Fatalf("expected error on invalid mac - got %v", err)
 	}
 }
 
-func TestServerSetAKEState_InvalidInput(t *testing.T) {
+func TestServerDeserializeState_InvalidInput(t *testing.T) {
 	conf := opaque.DefaultConfiguration()
 
 	/*
@@ -224,24 +311,203 @@ func TestServerSetAKEState_InvalidInput(t *testing.T) {
 	buf := internal.RandomBytes(conf.MAC.Size() + conf.KDF.Size() + 1)
 
 	server, _ := conf.Server()
-	if err := server.SetAKEState(buf); err == nil || err.Error() != errInvalidStateLength.Error() {
-		t.Fatalf("Expected error for SetAKEState. want %q, got %q", errInvalidStateLength, err)
+	if _, err := server.DeserializeState(buf); err == nil || err.Error() != errInvalidStateLength.Error() {
+		t.Fatalf("Expected error for DeserializeState. want %q, got %q", errInvalidStateLength, err)
+	}
+}
+
+func TestServerFinish_MissingState(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	server, _ := conf.Server()
+
+	if err := server.LoginFinish(&message.KE3{}, nil); err == nil || !errors.Is(err, opaque.ErrNoState) {
+		t.Fatalf("expected error on missing state - got %v", err)
+	}
+}
+
+func TestServer_SealedState(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	credID := internal.RandomBytes(32)
+	sealingKey := internal.RandomBytes(32)
+	client, _ := conf.Client()
+	server, _ := conf.Server()
+	keys := serverKeys(t, conf)
+	rec := buildRecord(credID, []byte("yo"), keys, client, server)
+
+	ke1, clientState := client.LoginInit([]byte("yo"))
+	ke2, state, err := server.LoginInit(ke1, nil, keys, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := server.SealState(state, sealingKey, credID, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(sealed, state.SessionKey()) {
+		t.Fatal("sealed state contains the session key in the clear")
+	}
+
+	// Another server instance opens the state and finishes the login.
+	other, _ := conf.Server()
+
+	opened, err := other.OpenState(sealed, sealingKey, credID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if opened.Finished() {
+		t.Fatal("state sealed before LoginFinish was opened as finished")
+	}
+
+	ke3, _, err := client.LoginFinish(nil, nil, ke2, clientState)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := other.LoginFinish(ke3, opened); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(opened.SessionKey(), clientState.SessionKey()) {
+		t.Fatal("session keys differ")
+	}
+}
+
+func TestServer_SealedState_Invalid(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	credID := internal.RandomBytes(32)
+	sealingKey := internal.RandomBytes(32)
+	server, _ := conf.Server()
+
+	state, err := server.DeserializeState(internal.RandomBytes(conf.MAC.Size() + conf.KDF.Size()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := server.SealState(state, sealingKey, credID, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tampered state.
+	for _, i := range []int{0, 1, 10, len(sealed) - 1} {
+		tampered := make([]byte, len(sealed))
+		copy(tampered, sealed)
+		tampered[i] ^= 0xff
+
+		if _, err := server.OpenState(tampered, sealingKey, credID); !errors.Is(err, opaque.ErrInvalidSealedState) {
+			t.Fatalf("expected %q for tampered byte %d, got %q", opaque.ErrInvalidSealedState, i, err)
+		}
+	}
+
+	// Truncated state.
+	if _, err := server.OpenState(sealed[:20], sealingKey, credID); !errors.Is(err, opaque.ErrInvalidSealedState) {
+		t.Fatalf("expected %q for truncated state, got %q", opaque.ErrInvalidSealedState, err)
+	}
+
+	// Different user.
+	if _, err := server.OpenState(sealed, sealingKey, []byte("other")); !errors.Is(
+		err,
+		opaque.ErrInvalidSealedState,
+	) {
+		t.Fatalf("expected %q for another credential identifier, got %q", opaque.ErrInvalidSealedState, err)
+	}
+
+	// Server in another AKE mode sharing the sealing key.
+	other := opaque.DefaultConfiguration()
+	other.Mode = opaque.HMQV
+	otherServer, _ := other.Server()
+
+	if _, err := otherServer.OpenState(sealed, sealingKey, credID); !errors.Is(err, opaque.ErrInvalidSealedState) {
+		t.Fatalf("expected %q for another configuration, got %q", opaque.ErrInvalidSealedState, err)
+	}
+
+	// Wrong key.
+	if _, err := server.OpenState(sealed, internal.RandomBytes(32), credID); !errors.Is(
+		err,
+		opaque.ErrInvalidSealedState,
+	) {
+		t.Fatalf("expected %q for wrong key, got %q", opaque.ErrInvalidSealedState, err)
+	}
+
+	// Short key.
+	if _, err := server.SealState(state, sealingKey[:16], credID, time.Now()); !errors.Is(
+		err,
+		opaque.ErrInvalidSealingKey,
+	) {
+		t.Fatalf("expected %q for short key, got %q", opaque.ErrInvalidSealingKey, err)
+	}
+
+	// Expired state.
+	expired, err := server.SealState(state, sealingKey, credID, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := server.OpenState(expired, sealingKey, credID); !errors.Is(err, opaque.ErrSealedStateExpired) {
+		t.Fatalf("expected %q for expired state, got %q", opaque.ErrSealedStateExpired, err)
+	}
+
+	// Missing state.
+	if _, err := server.SealState(nil, sealingKey, credID, time.Now()); !errors.Is(err, opaque.ErrNoState) {
+		t.Fatalf("expected %q for missing state, got %q", opaque.ErrNoState, err)
 	}
+}
 
+func TestServer_ConcurrentLogins(t *testing.T) {
 	/*
-		A state already exists.
+		A single server instance serves many logins in parallel.
 	*/
+	conf := opaque.DefaultConfiguration()
+	conf.KSF = 0
+	keys := serverKeys(t, conf)
+	server, _ := conf.Server()
 
-	credId := internal.RandomBytes(32)
-	seed := internal.RandomBytes(conf.Hash.Size())
-	client, _ := conf.Client()
-	server, _ = conf.Server()
-	sk, pk := conf.KeyGen()
-	rec := buildRecord(credId, seed, []byte("yo"), pk, client, server)
-	ke1 := client.LoginInit([]byte("yo"))
-	_, _ = server.LoginInit(ke1, nil, sk, pk, seed, rec)
-	state := server.SerializeState()
-	if err := server.SetAKEState(state); err == nil || err.Error() != errStateExists.Error() {
-		t.Fatalf("Expected error for SetAKEState. want %q, got %q", errStateExists, err)
+	const sessions = 64
+	records := make([]*opaque.ClientRecord, sessions)
+	passwords := make([][]byte, sessions)
+
+	for i := range records {
+		client, _ := conf.Client()
+		passwords[i] = internal.RandomBytes(16)
+		records[i] = buildRecord(internal.RandomBytes(32), passwords[i], keys, client, server)
 	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < sessions; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			client, _ := conf.Client()
+			ke1, clientState := client.LoginInit(passwords[i])
+
+			ke2, state, err := server.LoginInit(ke1, nil, keys, records[i])
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			ke3, _, err := client.LoginFinish(nil, nil, ke2, clientState)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if err := server.LoginFinish(ke3, state); err != nil {
+				t.Error(err)
+				return
+			}
+
+			if !bytes.Equal(clientState.SessionKey(), state.SessionKey()) {
+				t.Error("session keys differ")
+			}
+		}(i)
+	}
+
+	wg.Wait()
 }
@@ -0,0 +1,334 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/bytemare/opaque"
+	"github.com/bytemare/opaque/internal"
+	"github.com/bytemare/opaque/message"
+)
+
+func exporters(t *testing.T, conf *opaque.Configuration) (client, server *opaque.SessionExporter) {
+	p := loggedIn(t, conf, []byte("password"))
+
+	client, err := p.client.Exporter(p.clientLogin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err = p.server.Exporter(p.serverLogin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client, server
+}
+
+func TestSessionExporter(t *testing.T) {
+	for _, conf := range confs {
+		client, server := exporters(t, conf.Conf)
+
+		c, err := client.Export("application", []byte("context"), 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s, _ := server.Export("application", []byte("context"), 100)
+		otherLabel, _ := client.Export("other", []byte("context"), 100)
+		otherContext, _ := client.Export("application", nil, 100)
+
+		if len(c) != 100 || !bytes.Equal(c, s) {
+			t.Fatal("client and server exported keys differ")
+		}
+
+		if bytes.Equal(c, otherLabel) || bytes.Equal(c, otherContext) {
+			t.Fatal("exported keys must depend on label and context")
+		}
+
+		cc, cs, err := client.TrafficKeys(32)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sc, ss, _ := server.TrafficKeys(32)
+
+		if !bytes.Equal(cc, sc) || !bytes.Equal(cs, ss) || bytes.Equal(cc, cs) {
+			t.Fatal("unexpected traffic keys")
+		}
+
+		// Another session yields other keys.
+		other, _ := exporters(t, conf.Conf)
+		if o, _ := other.Export("application", []byte("context"), 100); bytes.Equal(c, o) {
+			t.Fatal("sessions exported the same keys")
+		}
+	}
+}
+
+func TestSessionExporter_Errors(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	client, _ := exporters(t, conf)
+
+	for _, label := range []string{"", strings.Repeat("a", 256)} {
+		if _, err := client.Export(label, nil, 32); !errors.Is(err, opaque.ErrExportLabel) {
+			t.Fatalf("expected error %q, got %v", opaque.ErrExportLabel, err)
+		}
+	}
+
+	for _, length := range []int{0, -1, 1 << 16} {
+		if _, err := client.Export("label", nil, length); !errors.Is(err, opaque.ErrExportLength) {
+			t.Fatalf("expected error %q, got %v", opaque.ErrExportLength, err)
+		}
+	}
+
+	c, _ := conf.Client()
+	_, state := c.LoginInit([]byte("password"))
+
+	if _, err := c.Exporter(state); !errors.Is(err, opaque.ErrLoginNotFinished) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrLoginNotFinished, err)
+	}
+
+	s, _ := conf.Server()
+	if _, err := s.Exporter(nil); !errors.Is(err, opaque.ErrNoState) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrNoState, err)
+	}
+
+	// The server state of a login that didn't receive a valid KE3 doesn't export keys.
+	p := loggedIn(t, conf, []byte("password"))
+	ke1, _ := p.client.LoginInit([]byte("password"))
+
+	_, serverLogin, err := p.server.LoginInit(ke1, nil, p.keys, p.record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.server.Exporter(serverLogin); !errors.Is(err, opaque.ErrLoginNotFinished) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrLoginNotFinished, err)
+	}
+
+	if err := p.server.LoginFinish(&message.KE3{Mac: serverLogin.ExpectedMAC()[1:]}, serverLogin); err == nil {
+		t.Fatal("expected error on invalid KE3")
+	}
+
+	if _, err := p.server.Exporter(serverLogin); !errors.Is(err, opaque.ErrLoginNotFinished) {
+		t.Fatalf("expected error %q after a failed LoginFinish, got %v", opaque.ErrLoginNotFinished, err)
+	}
+}
+
+func channels(t *testing.T, client, server *opaque.SessionExporter, rw io.ReadWriter) (c, s *opaque.Channel) {
+	c, err := client.Channel(rw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = server.Channel(rw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c, s
+}
+
+func TestChannel(t *testing.T) {
+	client, server := exporters(t, opaque.DefaultConfiguration())
+	clientConn, serverConn := net.Pipe()
+
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	c, _ := channels(t, client, server, clientConn)
+	_, s := channels(t, client, server, serverConn)
+
+	request := internal.RandomBytes(40000) // spans several records
+	response := []byte("response")
+
+	go func() {
+		if _, err := c.Write(request); err != nil {
+			panic(err)
+		}
+	}()
+
+	received := make([]byte, len(request))
+	if _, err := io.ReadFull(s, received); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(received, request) {
+		t.Fatal("server received another message")
+	}
+
+	go func() {
+		if _, err := s.Write(response); err != nil {
+			panic(err)
+		}
+	}()
+
+	received = make([]byte, len(response))
+	if _, err := io.ReadFull(c, received); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(received, response) {
+		t.Fatal("client received another message")
+	}
+}
+
+func TestChannel_Tampering(t *testing.T) {
+	client, server := exporters(t, opaque.DefaultConfiguration())
+	buf := new(bytes.Buffer)
+	c, s := channels(t, client, server, buf)
+
+	if _, err := c.Write([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	first := append([]byte(nil), buf.Bytes()...)
+	received := make([]byte, 5)
+	if _, err := io.ReadFull(s, received); err != nil || string(received) != "first" {
+		t.Fatalf("unexpected read %q: %v", received, err)
+	}
+
+	// A replayed record is rejected.
+	buf.Write(first)
+
+	if _, err := s.Read(received); !errors.Is(err, opaque.ErrChannelAuthentication) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrChannelAuthentication, err)
+	}
+
+	// The error is sticky.
+	if _, err := s.Read(received); !errors.Is(err, opaque.ErrChannelAuthentication) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrChannelAuthentication, err)
+	}
+
+	// A reflected record is rejected.
+	_, s = channels(t, client, server, buf)
+	buf.Reset()
+
+	_, _ = s.Write([]byte("reflected"))
+
+	if _, err := s.Read(received); !errors.Is(err, opaque.ErrChannelAuthentication) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrChannelAuthentication, err)
+	}
+
+	// A tampered record is rejected.
+	c, s = channels(t, client, server, buf)
+	buf.Reset()
+
+	_, _ = c.Write([]byte("message"))
+	buf.Bytes()[buf.Len()-1] ^= 1
+
+	if _, err := s.Read(received); !errors.Is(err, opaque.ErrChannelAuthentication) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrChannelAuthentication, err)
+	}
+
+	// A truncated record is detected.
+	c, s = channels(t, client, server, buf)
+	buf.Reset()
+	_, _ = c.Write([]byte("message"))
+	buf.Truncate(buf.Len() - 1)
+
+	if _, err := s.Read(received); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected unexpected EOF, got %v", err)
+	}
+}
+
+func TestChannel_Close(t *testing.T) {
+	client, server := exporters(t, opaque.DefaultConfiguration())
+	buf := new(bytes.Buffer)
+	c, s := channels(t, client, server, buf)
+	received := make([]byte, 7)
+
+	// An empty read returns at once, without waiting for a record.
+	if n, err := s.Read(nil); n != 0 || err != nil {
+		t.Fatalf("unexpected empty read: %d, %v", n, err)
+	}
+
+	// The stream ends on a record boundary, but without the end record, as if the following ones were dropped.
+	_, _ = c.Write([]byte("message"))
+
+	if _, err := io.ReadFull(s, received); err != nil || string(received) != "message" {
+		t.Fatalf("unexpected read %q: %v", received, err)
+	}
+
+	if _, err := s.Read(received); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected unexpected EOF, got %v", err)
+	}
+
+	// A closed stream ends with EOF.
+	c, s = channels(t, client, server, buf)
+	_, _ = c.Write([]byte("message"))
+
+	if err := c.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := io.ReadFull(s, received); err != nil || string(received) != "message" {
+		t.Fatalf("unexpected read %q: %v", received, err)
+	}
+
+	if _, err := s.Read(received); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+
+	if _, err := c.Write([]byte("late")); !errors.Is(err, opaque.ErrChannelClosed) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrChannelClosed, err)
+	}
+
+	if err := c.CloseWrite(); !errors.Is(err, opaque.ErrChannelClosed) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrChannelClosed, err)
+	}
+}
+
+// failingWriter fails the writes to the buffer while fail is set.
+type failingWriter struct {
+	bytes.Buffer
+	fail bool
+}
+
+var errWrite = errors.New("write failure")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.fail {
+		return 0, errWrite
+	}
+
+	return w.Buffer.Write(p)
+}
+
+func TestChannel_WriteError(t *testing.T) {
+	client, server := exporters(t, opaque.DefaultConfiguration())
+	w := &failingWriter{fail: true}
+	c, _ := channels(t, client, server, w)
+
+	if _, err := c.Write([]byte("lost")); !errors.Is(err, errWrite) {
+		t.Fatalf("expected error %q, got %v", errWrite, err)
+	}
+
+	// The lost record consumed a sequence number, so the channel can't be written to anymore, even if the underlying
+	// writer recovers.
+	w.fail = false
+
+	if _, err := c.Write([]byte("message")); !errors.Is(err, errWrite) {
+		t.Fatalf("expected error %q, got %v", errWrite, err)
+	}
+
+	if err := c.CloseWrite(); !errors.Is(err, errWrite) {
+		t.Fatalf("expected error %q, got %v", errWrite, err)
+	}
+
+	if w.Len() != 0 {
+		t.Fatal("records were written after the failure")
+	}
+}
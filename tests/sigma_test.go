@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/bytemare/opaque"
+	"github.com/bytemare/opaque/internal"
+)
+
+// hsm is a crypto.Signer that only exposes signing, as a hardware security module would.
+type hsm struct {
+	key   *ecdsa.PrivateKey
+	count int
+}
+
+func (h *hsm) Public() crypto.PublicKey {
+	return h.key.Public()
+}
+
+func (h *hsm) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	h.count++
+	return h.key.Sign(rand, digest, opts)
+}
+
+func sigmaConfs() []*opaque.Configuration {
+	out := make([]*opaque.Configuration, 0, len(confs))
+
+	for _, c := range confs {
+		if c.Curve == nil {
+			continue
+		}
+
+		conf := *c.Conf
+		conf.Mode = opaque.SigmaI
+		out = append(out, &conf)
+	}
+
+	return out
+}
+
+func TestSigmaI(t *testing.T) {
+	for _, conf := range sigmaConfs() {
+		t.Run(string(conf.OPRF), func(t *testing.T) {
+			keys := serverKeys(t, conf)
+			test := &testParams{
+				Configuration: conf,
+				username:      []byte("client"),
+				userID:        []byte("client"),
+				serverID:      []byte("server"),
+				password:      []byte("password"),
+				serverKeys:    keys.Serialize(),
+			}
+
+			// Messages and the server state go through their encodings.
+			record, exportKeyReg := testRegistration(t, test)
+			exportKeyLogin := testAuthentication(t, test, record)
+
+			if !bytes.Equal(exportKeyReg, exportKeyLogin) {
+				t.Errorf("export keys differ")
+			}
+		})
+	}
+}
+
+func TestSigmaI_Signer(t *testing.T) {
+	for _, c := range confs {
+		if c.Curve == nil {
+			continue
+		}
+
+		conf := *c.Conf
+		conf.Mode = opaque.SigmaI
+
+		key, err := ecdsa.GenerateKey(c.Curve, cryptorand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signer := &hsm{key: key}
+
+		keys, err := conf.NewServerSigningKeyMaterial(signer, conf.GenerateOPRFSeed())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(keys.PublicKey(), elliptic.MarshalCompressed(c.Curve, key.X, key.Y)) {
+			t.Fatal("unexpected server public key")
+		}
+
+		client, _ := conf.Client()
+		server, _ := conf.Server()
+		record := buildRecord(internal.RandomBytes(32), []byte("password"), keys, client, server)
+
+		login(t, &conf, []byte("password"), keys, record)
+
+		if signer.count != 1 {
+			t.Fatalf("expected the signer to be used once, got %d", signer.count)
+		}
+
+		// Key material without a secret key can't be used in the other modes.
+		dh := *c.Conf
+		dhServer, _ := dh.Server()
+		ke1, _ := client.LoginInit([]byte("password"))
+
+		_, _, err = dhServer.LoginInit(ke1, nil, keys, record)
+		if !errors.Is(err, opaque.ErrServerKeyMaterialConfiguration) {
+			t.Fatalf("expected error %q, got %v", opaque.ErrServerKeyMaterialConfiguration, err)
+		}
+	}
+}
+
+func TestSigmaI_InvalidSigner(t *testing.T) {
+	conf := sigmaConfs()[0]
+
+	key, err := ecdsa.GenerateKey(elliptic.P384(), cryptorand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := conf.NewServerSigningKeyMaterial(key, conf.GenerateOPRFSeed()); !errors.Is(
+		err,
+		opaque.ErrServerSigningKey,
+	) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrServerSigningKey, err)
+	}
+
+	if _, err := conf.NewServerSigningKeyMaterial(nil, conf.GenerateOPRFSeed()); !errors.Is(
+		err,
+		opaque.ErrNoServerKeyMaterial,
+	) {
+		t.Fatalf("expected error %q, got %v", opaque.ErrNoServerKeyMaterial, err)
+	}
+}
+
+func TestSigmaI_Ristretto(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	conf.Mode = opaque.SigmaI
+
+	if _, err := conf.Client(); err == nil {
+		t.Fatal("expected error for SIGMA-I with Ristretto255")
+	}
+}
+
+func TestSigmaI_InvalidSignatures(t *testing.T) {
+	for _, conf := range sigmaConfs() {
+		client, _ := conf.Client()
+		server, _ := conf.Server()
+		keys := serverKeys(t, conf)
+		password := []byte("password")
+		record := buildRecord(internal.RandomBytes(32), password, keys, client, server)
+
+		// Bad server signature.
+		ke1, clientState := client.LoginInit(password)
+
+		ke2, _, err := server.LoginInit(ke1, nil, keys, record)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ke2.Signature[0] ^= 0xff
+
+		if _, _, err := client.LoginFinish(nil, nil, ke2, clientState); err == nil {
+			t.Fatal("expected error on invalid server signature")
+		}
+
+		// Bad client signature.
+		ke1, clientState = client.LoginInit(password)
+
+		ke2, serverState, err := server.LoginInit(ke1, nil, keys, record)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ke3, _, err := client.LoginFinish(nil, nil, ke2, clientState)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ke3.Signature[len(ke3.Signature)-1] ^= 0xff
+
+		if err := server.LoginFinish(ke3, serverState); !errors.Is(err, opaque.ErrAkeInvalidClientMac) {
+			t.Fatalf("expected error %q, got %v", opaque.ErrAkeInvalidClientMac, err)
+		}
+
+		// Missing client signature.
+		ke3.Signature = nil
+
+		if err := server.LoginFinish(ke3, serverState); !errors.Is(err, opaque.ErrAkeInvalidClientMac) {
+			t.Fatalf("expected error %q, got %v", opaque.ErrAkeInvalidClientMac, err)
+		}
+	}
+}
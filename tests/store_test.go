@@ -0,0 +1,368 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright (C) 2021 Daniel Bourdrez. All Rights Reserved.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree or at
+// https://spdx.org/licenses/MIT.html
+
+package opaque_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bytemare/crypto/group"
+
+	"github.com/bytemare/opaque"
+)
+
+func testRecordStore(t *testing.T, store opaque.RecordStore, conf *opaque.Configuration) {
+	client, _ := conf.Client()
+	server, _ := conf.Server()
+	keys := serverKeys(t, conf)
+
+	rec1 := buildRecord([]byte("b"), []byte("yo"), keys, client, server)
+	rec2 := buildRecord([]byte("a"), []byte("yo"), keys, client, server)
+	rec2.ClientIdentity = []byte("client")
+
+	if _, err := store.Get(rec1.CredentialIdentifier); !errors.Is(err, opaque.ErrRecordNotFound) {
+		t.Fatalf("expected %q on empty store, got %q", opaque.ErrRecordNotFound, err)
+	}
+
+	if err := store.Create(rec1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Create(rec1); !errors.Is(err, opaque.ErrRecordExists) {
+		t.Fatalf("expected %q on creating an existing record, got %q", opaque.ErrRecordExists, err)
+	}
+
+	if err := store.Put(rec2); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Get(rec2.CredentialIdentifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !isSameRecord(got, rec2) {
+		t.Fatal("stored and retrieved records differ")
+	}
+
+	// The store shares no memory with the records given to or returned by it.
+	stored := rec2.RegistrationRecord.Serialize()
+	rec2.MaskingKey[0] ^= 0xff
+	got.Envelope[0] ^= 0xff
+
+	if got, _ = store.Get(rec2.CredentialIdentifier); !bytes.Equal(got.RegistrationRecord.Serialize(), stored) {
+		t.Fatal("stored record was modified through a copy")
+	}
+
+	rec2.MaskingKey[0] ^= 0xff
+
+	list, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 2 || string(list[0]) != "a" || string(list[1]) != "b" {
+		t.Fatalf("unexpected list of credential identifiers: %q", list)
+	}
+
+	rec3 := buildRecord(rec2.CredentialIdentifier, []byte("yo"), keys, client, server)
+	if err := store.Replace(rec3, rec3); !errors.Is(err, opaque.ErrRecordChanged) {
+		t.Fatalf("expected %q on replacing another record, got %q", opaque.ErrRecordChanged, err)
+	}
+
+	if err := store.Replace(rec2, rec3); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ = store.Get(rec2.CredentialIdentifier); !isSameRecord(got, rec3) {
+		t.Fatal("record was not replaced")
+	}
+
+	if err := store.Replace(rec2, rec3); !errors.Is(err, opaque.ErrRecordChanged) {
+		t.Fatalf("expected %q on replacing a replaced record, got %q", opaque.ErrRecordChanged, err)
+	}
+
+	if err := store.Replace(rec3, rec1); err == nil {
+		t.Fatal("expected error on replacing with another credential identifier")
+	}
+
+	if err := store.Delete(rec1.CredentialIdentifier); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Get(rec1.CredentialIdentifier); !errors.Is(err, opaque.ErrRecordNotFound) {
+		t.Fatalf("expected %q after delete, got %q", opaque.ErrRecordNotFound, err)
+	}
+
+	if err := store.Delete(rec1.CredentialIdentifier); !errors.Is(err, opaque.ErrRecordNotFound) {
+		t.Fatalf("expected %q on deleting an absent record, got %q", opaque.ErrRecordNotFound, err)
+	}
+
+	if err := store.Put(nil); err == nil {
+		t.Fatal("expected error on nil record")
+	}
+
+	if err := store.Put(&opaque.ClientRecord{RegistrationRecord: rec1.RegistrationRecord}); err == nil {
+		t.Fatal("expected error on record without credential identifier")
+	}
+
+	noPublicKey := *rec3.RegistrationRecord
+	noPublicKey.PublicKey = nil
+	invalid := &opaque.ClientRecord{CredentialIdentifier: rec3.CredentialIdentifier, RegistrationRecord: &noPublicKey}
+
+	if err := store.Put(invalid); err == nil {
+		t.Fatal("expected error on record without public key")
+	}
+
+	if err := store.Replace(invalid, rec3); err == nil {
+		t.Fatal("expected error on replacing a record without public key")
+	}
+}
+
+// testConcurrentCreate checks that only one of concurrent creations of a record for a new credential identifier
+// succeeds, and that the others get ErrRecordExists.
+func testConcurrentCreate(t *testing.T, store opaque.RecordStore, conf *opaque.Configuration) {
+	client, _ := conf.Client()
+	server, _ := conf.Server()
+	keys := serverKeys(t, conf)
+
+	const creations = 8
+
+	records := make([]*opaque.ClientRecord, creations)
+	for i := range records {
+		records[i] = buildRecord([]byte("concurrent"), []byte("yo"), keys, client, server)
+	}
+
+	errs := make(chan error, creations)
+	for _, record := range records {
+		go func(record *opaque.ClientRecord) {
+			errs <- store.Create(record)
+		}(record)
+	}
+
+	created := 0
+
+	for range records {
+		err := <-errs
+
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, opaque.ErrRecordExists):
+			t.Fatal(err)
+		}
+	}
+
+	if created != 1 {
+		t.Fatalf("expected a single creation, got %d", created)
+	}
+}
+
+func TestMemoryRecordStore(t *testing.T) {
+	testRecordStore(t, opaque.NewMemoryRecordStore(), opaque.DefaultConfiguration())
+	testConcurrentCreate(t, opaque.NewMemoryRecordStore(), opaque.DefaultConfiguration())
+}
+
+func TestFileRecordStore(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	path := filepath.Join(t.TempDir(), "records")
+
+	store, err := opaque.NewFileRecordStore(path, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testRecordStore(t, store, conf)
+	testConcurrentCreate(t, store, conf)
+
+	if err := store.Delete([]byte("concurrent")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Delete([]byte("a")); !errors.Is(err, opaque.ErrStoreClosed) {
+		t.Fatalf("expected %q on closed store, got %q", opaque.ErrStoreClosed, err)
+	}
+
+	// Simulate a crash during a write: the incomplete entry must be dropped on reopening.
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := file.Write([]byte{1, 0, 0, 1, 0, 0xff}); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = file.Close()
+
+	store, err = opaque.NewFileRecordStore(path, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer store.Close()
+
+	list, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 1 || string(list[0]) != "a" {
+		t.Fatalf("unexpected records after reopening: %q", list)
+	}
+
+	// The store remains usable after the truncation.
+	if err := store.Delete([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := opaque.NewFileRecordStore(path, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer reopened.Close()
+
+	if list, _ = reopened.List(); len(list) != 0 {
+		t.Fatalf("unexpected records after reopening: %q", list)
+	}
+}
+
+func TestFileRecordStore_InvalidRecord(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	client, _ := conf.Client()
+	server, _ := conf.Server()
+	path := filepath.Join(t.TempDir(), "records")
+
+	store, err := opaque.NewFileRecordStore(path, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := buildRecord([]byte("a"), []byte("yo"), serverKeys(t, conf), client, server)
+	badEnvelope := *record.RegistrationRecord
+	badEnvelope.Envelope = badEnvelope.Envelope[1:]
+	identity := *record.RegistrationRecord
+	identity.PublicKey = group.Group(conf.AKE).NewElement()
+
+	for _, invalid := range []*opaque.ClientRecord{
+		{RegistrationRecord: record.RegistrationRecord},
+		{CredentialIdentifier: record.CredentialIdentifier, RegistrationRecord: &badEnvelope},
+		{CredentialIdentifier: record.CredentialIdentifier, RegistrationRecord: &identity},
+	} {
+		if err := store.Put(invalid); err == nil {
+			t.Fatal("expected error on invalid record")
+		}
+	}
+
+	if err := store.Delete(record.CredentialIdentifier); !errors.Is(err, opaque.ErrRecordNotFound) {
+		t.Fatalf("expected %q on deleting an absent record, got %q", opaque.ErrRecordNotFound, err)
+	}
+
+	_ = store.Close()
+
+	// Nothing has been written, and the file can be replayed.
+	if content, _ := os.ReadFile(path); len(content) != 0 {
+		t.Fatalf("rejected record was written: %v", content)
+	}
+
+	store, err = opaque.NewFileRecordStore(path, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = store.Close()
+}
+
+func TestFileRecordStore_Corrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records")
+	if err := os.WriteFile(path, []byte{9, 0, 0, 0, 1, 0}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := opaque.NewFileRecordStore(path, nil); err == nil {
+		t.Fatal("expected error on corrupted file")
+	}
+}
+
+func TestServer_LoginInitFromStore(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	client, _ := conf.Client()
+	server, _ := conf.Server()
+	keys := serverKeys(t, conf)
+	store := opaque.NewMemoryRecordStore()
+
+	if err := store.Put(buildRecord([]byte("known"), []byte("yo"), keys, client, server)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fakeRecordSeed := range [][]byte{nil, conf.GenerateFakeRecordSeed()} {
+		for _, credID := range [][]byte{[]byte("known"), []byte("unknown")} {
+			ke1, clientState := client.LoginInit([]byte("yo"))
+
+			ke2, _, err := server.LoginInitFromStore(ke1, nil, keys, fakeRecordSeed, credID, store)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, _, err = client.LoginFinish(nil, nil, ke2, clientState)
+			if string(credID) == "known" && err != nil {
+				t.Fatal(err)
+			}
+
+			if string(credID) == "unknown" && err == nil {
+				t.Fatal("expected login to fail on fake record")
+			}
+		}
+	}
+
+	if _, err := server.GetRecord(store, []byte("unknown"), []byte("short")); !errors.Is(
+		err,
+		opaque.ErrInvalidFakeRecordSeedLength,
+	) {
+		t.Fatalf("expected %q, got %q", opaque.ErrInvalidFakeRecordSeedLength, err)
+	}
+}
+
+func TestServer_GetRecord_DeterministicFake(t *testing.T) {
+	conf := opaque.DefaultConfiguration()
+	server, _ := conf.Server()
+	store := opaque.NewMemoryRecordStore()
+	fakeRecordSeed := conf.GenerateFakeRecordSeed()
+
+	r1, err := server.GetRecord(store, []byte("unknown"), fakeRecordSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r2, err := server.GetRecord(store, []byte("unknown"), fakeRecordSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !isSameRecord(r1, r2) {
+		t.Fatal("fake records for the same credential identifier differ")
+	}
+
+	expected, err := conf.GetDeterministicFakeRecord(fakeRecordSeed, []byte("unknown"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !isSameRecord(r1, expected) {
+		t.Fatal("server fake record differs from the configuration's")
+	}
+}